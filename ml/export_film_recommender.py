@@ -0,0 +1,55 @@
+"""Export a trained FilmRecommender for the pure Go inference of scraper/pkg/transformer.
+
+The weights are saved with safetensors from the state_dict of the model, along with reference outputs of the model on
+a sequence of the validation set, which scraper/pkg/transformer checks its parity against:
+
+    FILM_RECOMMENDER_REFERENCE_DIR=export go test ./pkg/transformer/
+
+Usage, at the end of ml/notebooks/model_dev.ipynb:
+
+    from export_film_recommender import export
+    export(model, embd_matrix, xv[0], "export")
+
+A model trained on the activities encoded by the encode command of the scraper is exported with their columns (e.g.
+activity_columns=["rating", "is_loved", ...]), the Go inference refuses the activities of another layout.
+"""
+
+import json
+import os
+
+import torch
+from safetensors.torch import save_file
+
+
+def export(model, embd_matrix, inputs, out_dir, activity_columns=None):
+    """Write model.safetensors and reference.json in out_dir.
+
+    inputs is one sequence of activities (block_size x n_embd), embd_matrix is the matrix of the encoded movies.
+    activity_columns are the columns of the activities the model was trained on, they are saved in the metadata.
+    """
+    os.makedirs(out_dir, exist_ok=True)
+    model.eval()
+
+    metadata = {"format": "pt"}
+    if activity_columns is not None:
+        metadata["activity_columns"] = ",".join(activity_columns)
+
+    state = {name: tensor.detach().float().cpu().contiguous() for name, tensor in model.state_dict().items()}
+    save_file(state, os.path.join(out_dir, "model.safetensors"), metadata=metadata)
+
+    with torch.no_grad():
+        inputs = inputs.float().cpu()
+        embd_matrix = embd_matrix.float().cpu()
+        outputs = model.cpu()(inputs.unsqueeze(0))[0]
+        logits = outputs[-1] @ embd_matrix.T
+
+    with open(os.path.join(out_dir, "reference.json"), "w") as f:
+        json.dump(
+            {
+                "inputs": inputs.tolist(),
+                "embd_matrix": embd_matrix.tolist(),
+                "outputs": outputs.tolist(),
+                "logits": logits.tolist(),
+            },
+            f,
+        )
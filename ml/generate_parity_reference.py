@@ -0,0 +1,62 @@
+"""Generate a small FilmRecommender with random weights and export it with PyTorch for the Go parity test.
+
+The modules are the ones of ml/notebooks/model_dev.ipynb, the model is exported by ml/export_film_recommender.py in
+scraper/pkg/transformer/testdata/torch, which TestParity checks along with the reference of generate_reference.py.
+
+    python3 ml/generate_parity_reference.py
+"""
+
+import json
+import os
+
+import torch
+import torch.nn as nn
+from torch.nn import functional as F
+
+from export_film_recommender import export
+
+N_EMBD = 14
+N_HEAD = 2
+N_LAYER = 2
+N_MOVIES = 6
+SEQ_LEN = 5
+
+ML_DIR = os.path.dirname(os.path.abspath(__file__))
+NOTEBOOK = os.path.join(ML_DIR, "notebooks", "model_dev.ipynb")
+OUT_DIR = os.path.join(ML_DIR, "..", "scraper", "pkg", "transformer", "testdata", "torch")
+MODULES = ("class Head(", "class MultiHeadAttention(", "class FeedFoward(", "class Block(", "class FilmRecommender(")
+
+
+def film_recommender():
+    """Return the FilmRecommender class defined by the notebook, so the reference follows the trained model."""
+    with open(NOTEBOOK) as f:
+        cells = json.load(f)["cells"]
+
+    scope = {"torch": torch, "nn": nn, "F": F}
+
+    for cell in cells:
+        source = "".join(cell["source"])
+        if cell["cell_type"] == "code" and source.lstrip().startswith(MODULES):
+            exec(source, scope)
+
+    return scope["FilmRecommender"]
+
+
+def main():
+    torch.manual_seed(42)
+
+    model = film_recommender()(N_EMBD, N_HEAD, N_LAYER)
+
+    # The parameters are random, the LayerNorm are not left to their identity initialization
+    with torch.no_grad():
+        for parameter in model.parameters():
+            parameter.normal_(0, 0.3)
+
+    inputs = torch.randn(SEQ_LEN, N_EMBD)
+    embd_matrix = torch.randn(N_MOVIES, N_EMBD - 6)
+
+    export(model, embd_matrix, inputs, OUT_DIR)
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,121 @@
+// Command serve run the recommendation API until it is interrupted, e.g.
+//
+//	go run ./cmd/serve --db-path letterboxd.db -addr :8080 -model item-knn
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/api"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/app"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/config"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/recommend"
+)
+
+func main() {
+	// The .env file is optional, the configuration can also come from a config file, the environment or the flags
+	if err := godotenv.Load(".env"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Fatal(err)
+	}
+
+	cfg, args, err := config.Load(os.Args[0], os.Args[1:])
+	if errors.Is(err, config.ErrPrintConfig) || errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", ":8080", "address the API listens on")
+	model := fs.String("model", "item-knn", fmt.Sprintf("recommender to serve (one of %s)", strings.Join(recommend.Models, ", ")))
+	modelFile := fs.String("model-file", "", "ALS model saved by the train-als command, served instead of -model")
+	importPages := fs.Int("import-pages", 2, "number of films pages of a user scraped by an import, the latest movies first")
+	importTTL := fs.Duration("import-ttl", 24*time.Hour, "how long the recommendations of an imported user are cached")
+
+	if err := fs.Parse(args); errors.Is(err, flag.ErrHelp) {
+		return
+	} else if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	a, err := app.NewApp(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = serve(ctx, a, *addr, *model, *modelFile, api.ImportOptions{MaxPages: *importPages, TTL: *importTTL})
+
+	if closeErr := a.Close(); closeErr != nil {
+		log.Println(closeErr)
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func serve(ctx context.Context, a *app.App, addr string, model string, modelFile string, importOpts api.ImportOptions) error {
+	store := a.Scraper.Storage()
+
+	data, err := recommend.LoadData(store.DB())
+	if err != nil {
+		return err
+	}
+
+	var recommender recommend.Recommender
+
+	if modelFile != "" {
+		recommender, err = recommend.LoadALS(modelFile)
+	} else {
+		recommender, err = recommend.New(model, data)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	handler := api.NewServer(store, data, recommender, a.Logger)
+
+	// The users are imported with the scraper of the app, the running import is stopped along with the server
+	handler.EnableImports(ctx, a.Scraper, importOpts)
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errs := make(chan error, 1)
+
+	go func() {
+		a.Logger.Info("api listening", "addr", addr, "model", model, "model_file", modelFile, "movies", len(data.Movies))
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	// The requests in progress are given some time to finish
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(a.Config.ShutdownTimeout)*time.Second)
+	defer cancel()
+
+	return server.Shutdown(shutdownCtx)
+}
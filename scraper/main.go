@@ -1,24 +1,58 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/joho/godotenv"
 	"github.com/leminhohoho/movie-lens/scraper/pkg/app"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/config"
 )
 
 func main() {
-	if err := godotenv.Load(".env"); err != nil {
+	// The .env file is optional, the configuration can also come from a config file, the environment or the flags
+	if err := godotenv.Load(".env"); err != nil && !errors.Is(err, os.ErrNotExist) {
 		log.Fatal(err)
 	}
 
-	app, err := app.NewApp()
+	cfg, args, err := config.Load(os.Args[0], os.Args[1:])
+	if errors.Is(err, config.ErrPrintConfig) || errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// The first signal stops the scraper gracefully, a second one kills the process right away
+	context.AfterFunc(ctx, stop)
+
+	// The migrate command opens the db on its own, the app would apply the pending migrations first
+	if len(args) > 0 && args[0] == "migrate" {
+		if err := app.Migrate(cfg, args[1:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	app, err := app.NewApp(cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	err = app.Run()
-	app.Close()
+	err = app.Run(ctx, args)
+
+	if closeErr := app.Close(); closeErr != nil {
+		log.Println(closeErr)
+	}
 
 	if err != nil {
 		log.Fatal(err)
@@ -0,0 +1,475 @@
+package ann
+
+import (
+	"cmp"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/leminhohoho/movie-lens/scraper/pkg/features"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/utils"
+)
+
+// IndexFile is the file of the movie index, saved next to the encoding of the movies.
+const IndexFile = "movies.hnsw"
+
+// Metric is the similarity of the vectors, the higher the closer.
+type Metric string
+
+const (
+	// Cosine is the cosine similarity, the vectors are normalized once they are inserted
+	Cosine Metric = "cosine"
+	// Dot is the dot product, e.g. the logit of a movie given the output of the transformer
+	Dot Metric = "dot"
+)
+
+var Metrics = []string{string(Cosine), string(Dot)}
+
+type Options struct {
+	Metric Metric `json:"metric"`
+	// M is the number of neighbours a node is linked to when it is inserted, a node keeps up to M neighbours on the
+	// upper layers and 2*M on the first layer
+	M int `json:"m"`
+	// EfConstruction and EfSearch are the number of candidates kept while inserting and searching, the higher the more
+	// accurate and the slower
+	EfConstruction int    `json:"ef_construction"`
+	EfSearch       int    `json:"ef_search"`
+	Seed           uint64 `json:"seed"`
+}
+
+func DefaultOptions() Options {
+	return Options{Metric: Cosine, M: 16, EfConstruction: 200, EfSearch: 64, Seed: 1}
+}
+
+// Validate check that the options are usable.
+func (o Options) Validate() error {
+	errs := []error{}
+
+	if o.Metric != Cosine && o.Metric != Dot {
+		errs = append(errs, fmt.Errorf("unknown metric %q, expected cosine or dot", o.Metric))
+	}
+
+	if o.M < 2 {
+		errs = append(errs, fmt.Errorf("m must be at least 2, got %d", o.M))
+	}
+
+	if o.EfConstruction < 1 || o.EfSearch < 1 {
+		errs = append(errs, fmt.Errorf("ef_construction and ef_search must be at least 1, got %d and %d", o.EfConstruction, o.EfSearch))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Result is a movie found by a search, with its similarity to the query.
+type Result struct {
+	Id    int
+	Score float32
+}
+
+type node struct {
+	Id     int
+	Vector []float32
+	// Neighbours are the nodes linked to the node on every layer it is in, the first layer first
+	Neighbours [][]int32
+}
+
+// Index is an in-process HNSW index (Malkov and Yashunin, 2016) of vectors keyed by movie id, e.g. the rows of the
+// encoded movie matrix. It is safe for concurrent use, the searches run in parallel with each other but not with
+// the inserts.
+type Index struct {
+	Options Options
+	// Dim is the size of the vectors
+	Dim int
+
+	mu       sync.RWMutex
+	nodes    []node
+	ids      map[int]int32
+	entry    int32
+	maxLevel int
+	rng      *rand.Rand
+}
+
+// New create an empty index of vectors of dim values.
+func New(dim int, opts Options) (*Index, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	if dim < 1 {
+		return nil, fmt.Errorf("the vectors must have at least one value, got %d", dim)
+	}
+
+	return &Index{
+		Options: opts,
+		Dim:     dim,
+		ids:     map[int]int32{},
+		entry:   -1,
+		rng:     rand.New(rand.NewPCG(opts.Seed, opts.Seed)),
+	}, nil
+}
+
+// Build index the encoded movies by id, their vectors are the rows of the encoded movie matrix.
+func Build(movies []features.EncodedMovie, opts Options) (*Index, error) {
+	if len(movies) == 0 {
+		return nil, errors.New("no movie to index")
+	}
+
+	x, err := New(len(movies[0].Vector()), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, movie := range movies {
+		if err := x.Insert(movie.Id, movie.Vector()); err != nil {
+			return nil, fmt.Errorf("unable to index the movie %d: %w", movie.Id, err)
+		}
+	}
+
+	return x, nil
+}
+
+// Len return the number of movies in the index.
+func (x *Index) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	return len(x.nodes)
+}
+
+// Insert add the vector of a movie to the index, the vector replaces the previous one if the movie is already in it
+// (e.g. a movie scraped again).
+func (x *Index) Insert(id int, vector []float32) error {
+	if len(vector) != x.Dim {
+		return fmt.Errorf("vector of %d values, expected %d", len(vector), x.Dim)
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	vector = x.prepare(vector)
+
+	if n, ok := x.ids[id]; ok {
+		x.nodes[n].Vector = vector
+		x.link(n, len(x.nodes[n].Neighbours)-1)
+
+		return nil
+	}
+
+	// The level of a node follows a geometric distribution, each layer has about 1/M of the nodes of the one below it
+	level := int(-math.Log(1-x.rng.Float64()) / math.Log(float64(x.Options.M)))
+
+	n := int32(len(x.nodes))
+	x.nodes = append(x.nodes, node{Id: id, Vector: vector, Neighbours: make([][]int32, level+1)})
+	x.ids[id] = n
+
+	if x.entry < 0 {
+		x.entry, x.maxLevel = n, level
+		return nil
+	}
+
+	x.link(n, level)
+
+	if level > x.maxLevel {
+		x.entry, x.maxLevel = n, level
+	}
+
+	return nil
+}
+
+// link connect the node n to its closest nodes on every layer up to level, and them back to it.
+func (x *Index) link(n int32, level int) {
+	q := x.nodes[n].Vector
+	entries := []candidate{{x.entry, x.similarity(q, x.entry)}}
+
+	for l := x.maxLevel; l > level; l-- {
+		entries = x.searchLayer(q, entries, 1, l)
+	}
+
+	for l := min(level, x.maxLevel); l >= 0; l-- {
+		found := x.searchLayer(q, entries, x.Options.EfConstruction, l)
+
+		// The node is found by the search when its vector is replaced
+		others := slices.DeleteFunc(slices.Clone(found), func(c candidate) bool { return c.node == n })
+		neighbours := x.selectNeighbours(others, x.Options.M)
+
+		x.nodes[n].Neighbours[l] = x.nodes[n].Neighbours[l][:0]
+		for _, neighbour := range neighbours {
+			x.nodes[n].Neighbours[l] = append(x.nodes[n].Neighbours[l], neighbour.node)
+			x.addLink(neighbour.node, n, l)
+		}
+
+		entries = found
+	}
+}
+
+// addLink link the node from to the node to on the layer l, the links of from are pruned once it has too many.
+func (x *Index) addLink(from int32, to int32, l int) {
+	links := x.nodes[from].Neighbours[l]
+	if slices.Contains(links, to) {
+		return
+	}
+
+	links = append(links, to)
+
+	maxLinks := x.Options.M
+	if l == 0 {
+		maxLinks = 2 * x.Options.M
+	}
+
+	if len(links) > maxLinks {
+		candidates := make([]candidate, len(links))
+		for i, link := range links {
+			candidates[i] = candidate{link, x.similarity(x.nodes[from].Vector, link)}
+		}
+
+		sortCandidates(candidates)
+
+		links = links[:0]
+		for _, c := range x.selectNeighbours(candidates, maxLinks) {
+			links = append(links, c.node)
+		}
+	}
+
+	x.nodes[from].Neighbours[l] = links
+}
+
+// selectNeighbours select up to m neighbours among the candidates, ordered by similarity. A candidate closer to an
+// already selected neighbour than to the query is skipped first, which keeps links toward the other clusters.
+func (x *Index) selectNeighbours(candidates []candidate, m int) []candidate {
+	var selected, skipped []candidate
+
+	for _, c := range candidates {
+		if len(selected) >= m {
+			break
+		}
+
+		diverse := true
+		for _, s := range selected {
+			if x.similarity(x.nodes[c.node].Vector, s.node) > c.score {
+				diverse = false
+				break
+			}
+		}
+
+		if diverse {
+			selected = append(selected, c)
+		} else {
+			skipped = append(skipped, c)
+		}
+	}
+
+	for _, c := range skipped {
+		if len(selected) >= m {
+			break
+		}
+
+		selected = append(selected, c)
+	}
+
+	return selected
+}
+
+// Search return the k movies the most similar to the query, the most similar first.
+func (x *Index) Search(query []float32, k int) ([]Result, error) {
+	if len(query) != x.Dim {
+		return nil, fmt.Errorf("query of %d values, expected %d", len(query), x.Dim)
+	}
+
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	if x.entry < 0 || k < 1 {
+		return nil, nil
+	}
+
+	q := x.prepare(query)
+	entries := []candidate{{x.entry, x.similarity(q, x.entry)}}
+
+	for l := x.maxLevel; l > 0; l-- {
+		entries = x.searchLayer(q, entries, 1, l)
+	}
+
+	found := x.searchLayer(q, entries, max(x.Options.EfSearch, k), 0)
+
+	results := make([]Result, min(k, len(found)))
+	for i := range results {
+		results[i] = Result{Id: x.nodes[found[i].node].Id, Score: found[i].score}
+	}
+
+	return results, nil
+}
+
+// Vector return the vector of a movie, normalized for the cosine metric.
+func (x *Index) Vector(id int) ([]float32, bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	n, ok := x.ids[id]
+	if !ok {
+		return nil, false
+	}
+
+	return slices.Clone(x.nodes[n].Vector), true
+}
+
+type candidate struct {
+	node  int32
+	score float32
+}
+
+// searchLayer return the ef nodes of the layer l the most similar to q found from the entries, the most similar first.
+func (x *Index) searchLayer(q []float32, entries []candidate, ef int, l int) []candidate {
+	visited := map[int32]bool{}
+
+	// candidates are the nodes to visit ordered by similarity, the most similar last
+	// and results are the nodes found ordered by similarity, the most similar first
+	var candidates, results []candidate
+
+	for _, entry := range entries {
+		visited[entry.node] = true
+		candidates = insertCandidate(candidates, entry, true)
+		results = insertCandidate(results, entry, false)
+	}
+
+	if len(results) > ef {
+		results = results[:ef]
+	}
+
+	for len(candidates) > 0 {
+		c := candidates[len(candidates)-1]
+		candidates = candidates[:len(candidates)-1]
+
+		// Every node left to visit is less similar than the results
+		if len(results) >= ef && c.score < results[len(results)-1].score {
+			break
+		}
+
+		for _, neighbour := range x.nodes[c.node].Neighbours[l] {
+			if visited[neighbour] {
+				continue
+			}
+
+			visited[neighbour] = true
+			next := candidate{neighbour, x.similarity(q, neighbour)}
+
+			if len(results) < ef || next.score > results[len(results)-1].score {
+				candidates = insertCandidate(candidates, next, true)
+				results = insertCandidate(results, next, false)
+
+				if len(results) > ef {
+					results = results[:ef]
+				}
+			}
+		}
+	}
+
+	return results
+}
+
+// insertCandidate insert c in the candidates ordered by similarity, ascending or descending.
+func insertCandidate(candidates []candidate, c candidate, ascending bool) []candidate {
+	i, _ := slices.BinarySearchFunc(candidates, c, func(a, b candidate) int {
+		if ascending {
+			return cmp.Compare(a.score, b.score)
+		}
+
+		return cmp.Compare(b.score, a.score)
+	})
+
+	return slices.Insert(candidates, i, c)
+}
+
+func sortCandidates(candidates []candidate) {
+	slices.SortStableFunc(candidates, func(a, b candidate) int { return cmp.Compare(b.score, a.score) })
+}
+
+func (x *Index) similarity(q []float32, n int32) float32 {
+	var dot float64
+	for i, v := range x.nodes[n].Vector {
+		dot += float64(q[i]) * float64(v)
+	}
+
+	return float32(dot)
+}
+
+// prepare return a copy of the vector as it is stored, normalized for the cosine metric.
+// A vector of zeros stays zeros, it is similar to no other.
+func (x *Index) prepare(vector []float32) []float32 {
+	vector = slices.Clone(vector)
+
+	if x.Options.Metric != Cosine {
+		return vector
+	}
+
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+
+	if norm > 0 {
+		norm = math.Sqrt(norm)
+		for i := range vector {
+			vector[i] = float32(float64(vector[i]) / norm)
+		}
+	}
+
+	return vector
+}
+
+// snapshot is what is saved of an index.
+type snapshot struct {
+	Options  Options
+	Dim      int
+	Nodes    []node
+	Entry    int32
+	MaxLevel int
+}
+
+// Save write the index to filePath, the previous file is replaced at once.
+func (x *Index) Save(filePath string) error {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	s := snapshot{Options: x.Options, Dim: x.Dim, Nodes: x.nodes, Entry: x.entry, MaxLevel: x.maxLevel}
+
+	return utils.WriteFileAtomic(filePath, func(w io.Writer) error {
+		return gob.NewEncoder(w).Encode(s)
+	})
+}
+
+// Load read an index written by [Index.Save].
+func Load(filePath string) (*Index, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var s snapshot
+
+	if err := gob.NewDecoder(f).Decode(&s); err != nil {
+		return nil, fmt.Errorf("unable to read the index %s: %w", filePath, err)
+	}
+
+	x, err := New(s.Dim, s.Options)
+	if err != nil {
+		return nil, fmt.Errorf("invalid index %s: %w", filePath, err)
+	}
+
+	x.nodes, x.entry, x.maxLevel = s.Nodes, s.Entry, s.MaxLevel
+
+	// The nodes inserted after the load don't get the same levels as the ones before it
+	x.rng = rand.New(rand.NewPCG(s.Options.Seed, uint64(len(s.Nodes))))
+
+	for n, node := range x.nodes {
+		x.ids[node.Id] = int32(n)
+	}
+
+	return x, nil
+}
@@ -0,0 +1,185 @@
+package ann
+
+import (
+	"cmp"
+	"math/rand/v2"
+	"path"
+	"slices"
+	"testing"
+
+	"github.com/leminhohoho/movie-lens/scraper/pkg/features"
+)
+
+func randomVectors(rng *rand.Rand, n int, dim int) [][]float32 {
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		vectors[i] = make([]float32, dim)
+		for j := range vectors[i] {
+			vectors[i][j] = float32(rng.NormFloat64())
+		}
+	}
+
+	return vectors
+}
+
+// exact return the ids of the k vectors the most similar to the query by brute force.
+func exact(x *Index, vectors [][]float32, query []float32, k int) []int {
+	q := x.prepare(query)
+	results := make([]Result, len(vectors))
+
+	for id, vector := range vectors {
+		v := x.prepare(vector)
+
+		var dot float32
+		for i := range v {
+			dot += q[i] * v[i]
+		}
+
+		results[id] = Result{Id: id, Score: dot}
+	}
+
+	slices.SortFunc(results, func(a, b Result) int { return cmp.Compare(b.Score, a.Score) })
+
+	ids := make([]int, k)
+	for i := range ids {
+		ids[i] = results[i].Id
+	}
+
+	return ids
+}
+
+func TestSearchRecall(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	vectors := randomVectors(rng, 1000, 16)
+	queries := randomVectors(rng, 50, 16)
+
+	for _, metric := range []Metric{Cosine, Dot} {
+		opts := DefaultOptions()
+		opts.Metric = metric
+
+		x, err := New(16, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for id, vector := range vectors {
+			if err := x.Insert(id, vector); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		hits := 0
+		for _, query := range queries {
+			results, err := x.Search(query, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.IsSortedFunc(results, func(a, b Result) int { return cmp.Compare(b.Score, a.Score) }) {
+				t.Fatalf("results of the %s metric not sorted %v", metric, results)
+			}
+
+			expected := exact(x, vectors, query, 10)
+			for _, result := range results {
+				if slices.Contains(expected, result.Id) {
+					hits++
+				}
+			}
+		}
+
+		if recall := float64(hits) / float64(10*len(queries)); recall < 0.9 {
+			t.Errorf("recall of the %s metric is %.2f, expected at least 0.9", metric, recall)
+		}
+	}
+}
+
+func TestInsert(t *testing.T) {
+	x, err := New(2, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if results, err := x.Search([]float32{1, 0}, 3); err != nil || len(results) != 0 {
+		t.Fatalf("expected no result from an empty index, got %v, %v", results, err)
+	}
+
+	for id, vector := range [][]float32{{1, 0}, {0, 1}, {-1, 0}} {
+		if err := x.Insert(id, vector); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The movie is scraped again, its vector changes
+	if err := x.Insert(0, []float32{0, -1}); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := x.Search([]float32{0, -2}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if x.Len() != 3 || len(results) != 1 || results[0].Id != 0 || results[0].Score < 0.99 {
+		t.Fatalf("expected the updated movie, got %v in an index of %d movies", results, x.Len())
+	}
+
+	if err := x.Insert(3, []float32{1, 2, 3}); err == nil {
+		t.Fatal("expected an error for a vector of the wrong size")
+	}
+
+	if _, err := x.Search([]float32{1}, 1); err == nil {
+		t.Fatal("expected an error for a query of the wrong size")
+	}
+
+	if _, err := New(2, Options{Metric: "euclidean", M: 16, EfConstruction: 1, EfSearch: 1}); err == nil {
+		t.Fatal("expected an error for an unknown metric")
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	movies := []features.EncodedMovie{
+		{Id: 0, Duration: 0.9, Genres: []float32{0, 1, 0}},
+		{Id: 1, Duration: 0.8, Genres: []float32{0, 1, 1}},
+		{Id: 2, Duration: 0.2, Genres: []float32{1, 0, 0}},
+	}
+
+	opts := DefaultOptions()
+	opts.Metric = Dot
+
+	x, err := Build(movies, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filePath := path.Join(t.TempDir(), IndexFile)
+
+	if err := x.Save(filePath); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := movies[0].Vector()
+
+	expected, _ := x.Search(query, 3)
+	got, err := loaded.Search(query, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Options != opts || !slices.Equal(got, expected) || got[0].Id != 0 {
+		t.Fatalf("expected %v from the loaded index, got %v", expected, got)
+	}
+
+	// The movies scraped after the build are inserted into the loaded index
+	if err := loaded.Insert(3, (features.EncodedMovie{Duration: 1, Genres: []float32{0, 2, 2}}).Vector()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := loaded.Search(query, 1); loaded.Len() != 4 || got[0].Id != 3 {
+		t.Fatalf("expected the inserted movie first, got %v", got)
+	}
+}
@@ -0,0 +1,440 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/leminhohoho/movie-lens/scraper/pkg/features"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/models"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/recommend"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/storage"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/utils"
+)
+
+const (
+	// defaultK is the number of movies recommended when the request doesn't say
+	defaultK = 10
+	maxK     = 100
+	// dislikedRating is the rating under which a watched movie is not used to find the recommendations
+	dislikedRating = 2.5
+	// maxBodySize is the size of the largest request body, in bytes
+	maxBodySize = 1 << 20
+)
+
+// Server answer the recommendation queries with a recommender trained on the scraped dataset.
+type Server struct {
+	store       storage.Storage
+	data        *recommend.Data
+	recommender recommend.Recommender
+	logger      *slog.Logger
+	mux         *http.ServeMux
+	// similarity give the movies similar to a movie whatever the recommender
+	similarity *recommend.Content
+	// imports are the imports of letterboxd users, nil until they are enabled
+	imports *imports
+}
+
+// NewServer create the server, data is what the recommender is trained on and give the details of the movies.
+func NewServer(store storage.Storage, data *recommend.Data, recommender recommend.Recommender, logger *slog.Logger) *Server {
+	s := &Server{
+		store:       store,
+		data:        data,
+		recommender: recommender,
+		logger:      logger,
+		mux:         http.NewServeMux(),
+	}
+
+	if content, ok := recommender.(*recommend.Content); ok {
+		s.similarity = content
+	} else {
+		s.similarity = recommend.NewContent(slices.Collect(maps.Values(data.Movies)), recommend.DefaultContentWeights())
+	}
+
+	s.mux.HandleFunc("POST /recommendations", s.recommendations)
+	s.mux.HandleFunc("GET /movies/{slug}", s.movie)
+	s.mux.HandleFunc("GET /movies/{slug}/similar", s.similar)
+	s.mux.HandleFunc("GET /users/{slug}/history", s.history)
+
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	rw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+
+	s.mux.ServeHTTP(rw, r)
+
+	s.logger.Debug("request served", "method", r.Method, "path", r.URL.Path, "status", rw.status, "duration", time.Since(start))
+}
+
+// statusWriter record the status of the response for the logs.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Watched is a movie watched by the user asking for recommendations, the rating is optional.
+type Watched struct {
+	// Url is the url of the movie (e.g. /film/dune-part-two/), its slug is enough (e.g. dune-part-two)
+	Url    string   `json:"url"`
+	Rating *float32 `json:"rating,omitempty"`
+	Loved  bool     `json:"loved,omitempty"`
+}
+
+type RecommendationsRequest struct {
+	Watched []Watched `json:"watched"`
+	K       int       `json:"k,omitempty"`
+}
+
+type Recommendation struct {
+	Url       string  `json:"url"`
+	Name      string  `json:"name"`
+	PosterUrl *string `json:"poster_url"`
+	Score     float64 `json:"score"`
+	// Contributions are the part of every feature in the similarity of a similar movie
+	Contributions []recommend.Contribution `json:"contributions,omitempty"`
+}
+
+type RecommendationsResponse struct {
+	Recommendations []Recommendation `json:"recommendations"`
+}
+
+type Movie struct {
+	Id          int      `json:"id"`
+	Url         string   `json:"url"`
+	Name        string   `json:"name"`
+	Duration    *int     `json:"duration"`
+	PosterUrl   *string  `json:"poster_url"`
+	BackdropUrl *string  `json:"backdrop_url"`
+	Desc        *string  `json:"desc"`
+	TrailerUrl  *string  `json:"trailer_url"`
+	ReleaseDate *string  `json:"release_date"`
+	Genres      []string `json:"genres"`
+	Themes      []string `json:"themes"`
+	Studios     []string `json:"studios"`
+	Countries   []string `json:"countries"`
+	Languages   []string `json:"languages"`
+}
+
+type Activity struct {
+	MovieUrl  string   `json:"movie_url"`
+	MovieName string   `json:"movie_name"`
+	Date      string   `json:"date"`
+	IsWatch   bool     `json:"is_watch"`
+	Rating    *float32 `json:"rating"`
+	IsLoved   bool     `json:"is_loved"`
+	Review    *string  `json:"review"`
+}
+
+type HistoryResponse struct {
+	Url     string     `json:"url"`
+	Name    string     `json:"name"`
+	History []Activity `json:"history"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// recommendations recommend movies given the watched ones. The movies rated under 2.5 are not used to find the
+// recommendations, but they are never recommended either.
+func (s *Server) recommendations(w http.ResponseWriter, r *http.Request) {
+	var req RecommendationsRequest
+
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+
+	k, err := checkK(req.K)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, RecommendationsResponse{Recommendations: s.recommend(req.Watched, k)})
+}
+
+// recommend recommend k movies given the watched ones, the movies rated under 2.5 are only excluded.
+// The recommenders those use the ratings are given the weights of the movies the way they are trained.
+func (s *Server) recommend(watched []Watched, k int) []Recommendation {
+	var liked []string
+	var weights []float32
+	disliked := map[string]bool{}
+
+	for _, w := range watched {
+		url := MovieUrl(w.Url)
+
+		if w.Rating != nil && *w.Rating < dislikedRating {
+			disliked[url] = true
+		} else {
+			liked = append(liked, url)
+			weights = append(weights, recommend.Weight(features.Activity{Rating: w.Rating, IsLoved: w.Loved}))
+		}
+	}
+
+	var found []recommend.Recommendation
+	if weighted, ok := s.recommender.(recommend.WeightedRecommender); ok {
+		found = weighted.RecommendWeighted(liked, weights, k+len(disliked))
+	} else {
+		found = s.recommender.Recommend(liked, k+len(disliked))
+	}
+
+	var recommendations []recommend.Recommendation
+	for _, recommendation := range found {
+		if !disliked[recommendation.Url] && len(recommendations) < k {
+			recommendations = append(recommendations, recommendation)
+		}
+	}
+
+	return s.withDetails(recommendations)
+}
+
+func (s *Server) movie(w http.ResponseWriter, r *http.Request) {
+	movie, ok := s.findMovie(w, MovieUrl(r.PathValue("slug")))
+	if !ok {
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, toMovie(movie))
+}
+
+// similar return the movies the most similar to the given movie by their metadata, whatever the recommender, with the
+// part of every feature in their similarity.
+func (s *Server) similar(w http.ResponseWriter, r *http.Request) {
+	k, err := queryK(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	movie, ok := s.findMovie(w, MovieUrl(r.PathValue("slug")))
+	if !ok {
+		return
+	}
+
+	similar := s.similarity.SimilarTo(movie, k)
+
+	recommendations := make([]recommend.Recommendation, len(similar))
+	for i, movie := range similar {
+		recommendations[i] = recommend.Recommendation{Url: movie.Url, Score: movie.Score}
+	}
+
+	result := s.withDetails(recommendations)
+	for i := range result {
+		result[i].Contributions = similar[i].Contributions
+	}
+
+	s.writeJSON(w, http.StatusOK, RecommendationsResponse{Recommendations: result})
+}
+
+// findMovie return the movie of the given url with its metadata, the error response is written if it is not found.
+func (s *Server) findMovie(w http.ResponseWriter, url string) (features.Movie, bool) {
+	if movie, ok := s.data.Movies[url]; ok {
+		return movie, true
+	}
+
+	// The movies scraped once the server is started are not in the data
+	m, err := s.store.MovieByUrl(url)
+	if errors.Is(err, storage.ErrNotFound) {
+		s.writeError(w, http.StatusNotFound, fmt.Errorf("movie %s not found", url))
+		return features.Movie{}, false
+	} else if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return features.Movie{}, false
+	}
+
+	movies, err := features.LoadMovies(s.store.DB(), m.Id)
+	if err == nil && len(movies) == 0 {
+		err = fmt.Errorf("movie %s not loaded", url)
+	}
+
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return features.Movie{}, false
+	}
+
+	return movies[0], true
+}
+
+// history return the activities of a user, the latest first.
+func (s *Server) history(w http.ResponseWriter, r *http.Request) {
+	url := "/" + strings.Trim(r.PathValue("slug"), "/") + "/"
+
+	user, err := s.store.UserByUrl(url)
+	if errors.Is(err, storage.ErrNotFound) {
+		s.writeError(w, http.StatusNotFound, fmt.Errorf("user %s not found", url))
+		return
+	} else if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	history, err := s.userHistory(user)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, HistoryResponse{Url: user.Url, Name: user.Name, History: history})
+}
+
+func (s *Server) userHistory(user models.User) ([]Activity, error) {
+	var rows []struct {
+		models.UserAndMovie
+		MovieUrl  string
+		MovieName string
+	}
+
+	if err := s.store.DB().Table("users_and_movies").
+		Select("users_and_movies.*, movies.url AS movie_url, movies.name AS movie_name").
+		Joins("JOIN movies ON movies.id = users_and_movies.movie_id").
+		Where("users_and_movies.user_id = ?", user.Id).
+		Order("users_and_movies.date DESC").
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	history := make([]Activity, len(rows))
+	for i, row := range rows {
+		history[i] = Activity{
+			MovieUrl:  row.MovieUrl,
+			MovieName: row.MovieName,
+			Date:      row.Date,
+			IsWatch:   row.IsWatch,
+			Rating:    row.Rating,
+			IsLoved:   row.IsLoved,
+			Review:    row.Review,
+		}
+	}
+
+	return history, nil
+}
+
+// withDetails add the name and the poster of the recommended movies.
+func (s *Server) withDetails(recommendations []recommend.Recommendation) []Recommendation {
+	result := make([]Recommendation, len(recommendations))
+
+	for i, recommendation := range recommendations {
+		movie := s.data.Movies[recommendation.Url]
+
+		result[i] = Recommendation{
+			Url:       recommendation.Url,
+			Name:      movie.Name,
+			PosterUrl: movie.PosterUrl,
+			Score:     recommendation.Score,
+		}
+	}
+
+	return result
+}
+
+func toMovie(movie features.Movie) Movie {
+	m := Movie{
+		Id:          movie.Id,
+		Url:         movie.Url,
+		Name:        movie.Name,
+		Duration:    movie.Duration,
+		PosterUrl:   movie.PosterUrl,
+		BackdropUrl: movie.BackdropUrl,
+		Desc:        movie.Desc,
+		TrailerUrl:  movie.TrailerUrl,
+		Genres:      utils.OrEmpty(movie.Genres),
+		Themes:      utils.OrEmpty(movie.Themes),
+		Studios:     utils.OrEmpty(movie.Studios),
+		Countries:   utils.OrEmpty(movie.Countries),
+		Languages:   utils.OrEmpty(movie.Languages),
+	}
+
+	if !movie.ReleaseDate.IsZero() {
+		date := movie.ReleaseDate.Format(time.DateOnly)
+		m.ReleaseDate = &date
+	}
+
+	return m
+}
+
+// MovieUrl turn the url or the slug of a movie (e.g. dune-part-two, film/dune-part-two or
+// https://letterboxd.com/film/dune-part-two/) into the url used by the scraper (/film/dune-part-two/).
+func MovieUrl(url string) string {
+	url = strings.TrimPrefix(url, "https://")
+	url = strings.TrimPrefix(url, "letterboxd.com")
+	url = strings.Trim(url, "/")
+	url = strings.TrimPrefix(url, "film/")
+
+	return "/film/" + url + "/"
+}
+
+func queryK(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("k")
+	if value == "" {
+		return defaultK, nil
+	}
+
+	k, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid k %s", value)
+	}
+
+	return checkK(k)
+}
+
+// checkK return the number of movies to recommend, 0 is the default.
+func checkK(k int) (int, error) {
+	if k == 0 {
+		return defaultK, nil
+	}
+
+	if k < 0 || k > maxK {
+		return 0, fmt.Errorf("k must be between 1 and %d, got %d", maxK, k)
+	}
+
+	return k, nil
+}
+
+// decodeBody decode the json body of a request, the body is cut at maxBodySize. The error response is written if the
+// body can't be decoded.
+func (s *Server) decodeBody(w http.ResponseWriter, r *http.Request, body any) bool {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(body)
+
+	var tooLarge *http.MaxBytesError
+
+	if errors.As(err, &tooLarge) {
+		s.writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("body larger than %d bytes", tooLarge.Limit))
+		return false
+	} else if err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid body: %w", err))
+		return false
+	}
+
+	return true
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		s.logger.Error("unable to write the response", "error", err)
+	}
+}
+
+func (s *Server) writeError(w http.ResponseWriter, status int, err error) {
+	if status >= http.StatusInternalServerError {
+		s.logger.Error("request failed", "error", err)
+	}
+
+	s.writeJSON(w, status, errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,409 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/leminhohoho/movie-lens/scraper/pkg/models"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/recommend"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/storage"
+)
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// newTestServer serve a popularity recommender over a db where dune is watched by 3 users, barbie by 2 and arrival by 1.
+func newTestServer(t *testing.T) *httptest.Server {
+	s, _ := newTestAPI(t)
+
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func newTestAPI(t *testing.T) (*Server, storage.Storage) {
+	store, err := storage.Open(path.Join(t.TempDir(), "letterboxd.db"), discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { store.Close() })
+
+	movieIds := map[string]int{}
+
+	for _, url := range []string{"/film/dune/", "/film/barbie/", "/film/arrival/"} {
+		id, err := store.SaveMovie(&models.MovieDetails{
+			Movie:  models.Movie{Url: url, Name: url},
+			Genres: []models.Genre{{Url: "/films/genre/drama/", Name: "Drama"}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		movieIds[url] = id
+	}
+
+	userIds, err := store.SaveUsers([]models.User{{Url: "/a/", Name: "A"}, {Url: "/b/", Name: "B"}, {Url: "/c/", Name: "C"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rating := float32(4)
+	var activities []models.UserAndMovie
+
+	for user, movies := range map[string][]string{
+		"/a/": {"/film/dune/", "/film/barbie/", "/film/arrival/"},
+		"/b/": {"/film/dune/", "/film/barbie/"},
+		"/c/": {"/film/dune/"},
+	} {
+		for _, movie := range movies {
+			activities = append(activities, models.UserAndMovie{
+				UserId: userIds[user], MovieId: movieIds[movie], Date: "2024-03-01T18:40:00.000Z", IsWatch: true, Rating: &rating,
+			})
+		}
+	}
+
+	if err := store.SaveActivities(activities); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := recommend.LoadData(store.DB())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewServer(store, data, recommend.NewPopularity(data.Interactions), discard), store
+}
+
+func getJSON(t *testing.T, url string, expectedStatus int, body any) {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != expectedStatus {
+		t.Fatalf("expected status %d for %s, got %d", expectedStatus, url, resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(body); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecommendations(t *testing.T) {
+	server := newTestServer(t)
+
+	low := float32(1)
+	body, _ := json.Marshal(RecommendationsRequest{
+		Watched: []Watched{{Url: "dune"}, {Url: "https://letterboxd.com/film/barbie/", Rating: &low}},
+		K:       5,
+	})
+
+	resp, err := http.Post(server.URL+"/recommendations", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var recommendations RecommendationsResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&recommendations); err != nil {
+		t.Fatal(err)
+	}
+
+	// Barbie is disliked, it is not recommended even if it is popular
+	if len(recommendations.Recommendations) != 1 || recommendations.Recommendations[0].Url != "/film/arrival/" {
+		t.Fatalf("unexpected recommendations %#v", recommendations)
+	}
+
+	resp, err = http.Post(server.URL+"/recommendations", "application/json", bytes.NewReader([]byte(`{"k": 1000}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected a bad request for a k too large, got %d", resp.StatusCode)
+	}
+
+	large := `{"watched": [` + strings.Repeat(`{"url": "dune"},`, maxBodySize/16) + `{"url": "dune"}]}`
+
+	resp, err = http.Post(server.URL+"/recommendations", "application/json", strings.NewReader(large))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected a body too large, got %d", resp.StatusCode)
+	}
+}
+
+func TestMovies(t *testing.T) {
+	s, store := newTestAPI(t)
+
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	var movie Movie
+	getJSON(t, server.URL+"/movies/dune", http.StatusOK, &movie)
+
+	if movie.Url != "/film/dune/" || len(movie.Genres) != 1 || movie.Genres[0] != "drama" {
+		t.Fatalf("unexpected movie %#v", movie)
+	}
+
+	// The similar movies are by content even with the popularity recommender, the drama movies tie and barbie is first
+	var similar RecommendationsResponse
+	getJSON(t, server.URL+"/movies/dune/similar?k=1", http.StatusOK, &similar)
+
+	if len(similar.Recommendations) != 1 || similar.Recommendations[0].Url != "/film/barbie/" || similar.Recommendations[0].Name != "/film/barbie/" ||
+		len(similar.Recommendations[0].Contributions) != 1 || similar.Recommendations[0].Contributions[0].Feature != recommend.FeatureGenres {
+		t.Fatalf("unexpected similar movies %#v", similar)
+	}
+
+	// A movie scraped once the server is started is found in the db
+	if _, err := store.SaveMovie(&models.MovieDetails{
+		Movie:  models.Movie{Url: "/film/her/", Name: "Her"},
+		Genres: []models.Genre{{Url: "/films/genre/drama/", Name: "Drama"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	getJSON(t, server.URL+"/movies/her", http.StatusOK, &movie)
+	getJSON(t, server.URL+"/movies/her/similar", http.StatusOK, &similar)
+
+	if movie.Name != "Her" || len(movie.Genres) != 1 || len(similar.Recommendations) != 3 {
+		t.Fatalf("unexpected new movie %#v, similar to %#v", movie, similar)
+	}
+
+	var e errorResponse
+	getJSON(t, server.URL+"/movies/unknown/similar", http.StatusNotFound, &e)
+	getJSON(t, server.URL+"/movies/unknown", http.StatusNotFound, &e)
+}
+
+func TestHistory(t *testing.T) {
+	server := newTestServer(t)
+
+	var history HistoryResponse
+	getJSON(t, server.URL+"/users/b/history", http.StatusOK, &history)
+
+	if history.Name != "B" || len(history.History) != 2 || history.History[0].Rating == nil || *history.History[0].Rating != 4 {
+		t.Fatalf("unexpected history %#v", history)
+	}
+
+	var e errorResponse
+	getJSON(t, server.URL+"/users/unknown/history", http.StatusNotFound, &e)
+}
+
+func TestMovieUrl(t *testing.T) {
+	for _, url := range []string{"dune", "/film/dune/", "film/dune", "https://letterboxd.com/film/dune/"} {
+		if got := MovieUrl(url); got != "/film/dune/" {
+			t.Errorf("expected /film/dune/ for %s, got %s", url, got)
+		}
+	}
+}
+
+// fakeImporter import the user /d/, who watched dune and barbie and disliked barbie.
+type fakeImporter struct {
+	store storage.Storage
+}
+
+func (f fakeImporter) ImportUser(ctx context.Context, userUrl string, maxPages int, progress func(done int, total int)) error {
+	if userUrl != "/d/" {
+		return errors.New("user not found")
+	}
+
+	userIds, err := f.store.SaveUsers([]models.User{{Url: "/d/", Name: "D"}})
+	if err != nil {
+		return err
+	}
+
+	progress(0, 2)
+
+	low := float32(1)
+
+	for i, watched := range []struct {
+		url    string
+		rating *float32
+	}{{"/film/dune/", nil}, {"/film/barbie/", &low}} {
+		movie, err := f.store.MovieByUrl(watched.url)
+		if err != nil {
+			return err
+		}
+
+		if err := f.store.SaveActivities([]models.UserAndMovie{
+			{UserId: userIds["/d/"], MovieId: movie.Id, Date: "2024-05-01T18:40:00.000Z", IsWatch: true, Rating: watched.rating},
+		}); err != nil {
+			return err
+		}
+
+		progress(i+1, 2)
+	}
+
+	return nil
+}
+
+func TestImports(t *testing.T) {
+	s, store := newTestAPI(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s.EnableImports(ctx, fakeImporter{store}, ImportOptions{MaxPages: 1, TTL: time.Hour})
+
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	post := func(body string, expectedStatus int) ImportJob {
+		resp, err := http.Post(server.URL+"/imports", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != expectedStatus {
+			t.Fatalf("expected status %d for %s, got %d", expectedStatus, body, resp.StatusCode)
+		}
+
+		var job ImportJob
+		json.NewDecoder(resp.Body).Decode(&job)
+
+		return job
+	}
+
+	// poll return the job once it is finished
+	poll := func(username string) ImportJob {
+		for range 100 {
+			var job ImportJob
+			getJSON(t, server.URL+"/imports/"+username, http.StatusOK, &job)
+
+			if job.Status == ImportDone || job.Status == ImportFailed {
+				return job
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		t.Fatalf("import of %s not finished", username)
+		return ImportJob{}
+	}
+
+	if job := post(`{"username": "https://letterboxd.com/d/"}`, http.StatusAccepted); job.Username != "d" || job.UserUrl != "/d/" {
+		t.Fatalf("unexpected job %#v", job)
+	}
+
+	job := poll("d")
+
+	// Barbie is disliked, dune is watched, arrival is the only movie left
+	if job.Status != ImportDone || job.Scraped != 2 || job.Total != 2 || len(job.Recommendations) != 1 ||
+		job.Recommendations[0].Url != "/film/arrival/" {
+		t.Fatalf("unexpected job %#v", job)
+	}
+
+	// The result is cached, the user is not imported again
+	if cached := post(`{"username": "d"}`, http.StatusOK); !cached.CreatedAt.Equal(job.CreatedAt) {
+		t.Fatalf("expected the cached job, got %#v", cached)
+	}
+
+	// The cached history is recommended again for another k
+	if cached := post(`{"username": "d", "k": 3}`, http.StatusOK); cached.K != 3 || len(cached.Recommendations) != 1 {
+		t.Fatalf("expected the cached job recommended again, got %#v", cached)
+	}
+
+	if job := poll("d"); job.K != 3 {
+		t.Fatalf("expected the k of the last request, got %#v", job)
+	}
+
+	post(`{"username": "unknown"}`, http.StatusAccepted)
+
+	if job := poll("unknown"); job.Status != ImportFailed || job.Error != "user not found" {
+		t.Fatalf("unexpected failed job %#v", job)
+	}
+
+	post(`{"username": "not a username"}`, http.StatusBadRequest)
+
+	var e errorResponse
+	getJSON(t, server.URL+"/imports/nobody", http.StatusNotFound, &e)
+
+	// The finished jobs are evicted once their retention is over, the failed ones first
+	expiredAt := time.Now().Add(-failedImportTTL - time.Minute)
+	s.imports.update("unknown", func(job *ImportJob) { job.FinishedAt = &expiredAt })
+	s.imports.evict()
+
+	getJSON(t, server.URL+"/imports/unknown", http.StatusNotFound, &e)
+	getJSON(t, server.URL+"/imports/d", http.StatusOK, &job)
+
+	expiredAt = time.Now().Add(-2 * time.Hour)
+	s.imports.update("d", func(job *ImportJob) { job.FinishedAt = &expiredAt })
+	s.imports.evict()
+
+	getJSON(t, server.URL+"/imports/d", http.StatusNotFound, &e)
+}
+
+// evictingImporter evict the job of the user while it is imported.
+type evictingImporter struct {
+	fakeImporter
+	imports *imports
+}
+
+func (e evictingImporter) ImportUser(ctx context.Context, userUrl string, maxPages int, progress func(done int, total int)) error {
+	e.imports.mu.Lock()
+	delete(e.imports.jobs, Username(userUrl))
+	e.imports.mu.Unlock()
+
+	return e.fakeImporter.ImportUser(ctx, userUrl, maxPages, progress)
+}
+
+func TestImportEvicted(t *testing.T) {
+	s, store := newTestAPI(t)
+
+	var logs bytes.Buffer
+	s.logger = slog.New(slog.NewTextHandler(&logs, nil))
+
+	// The imports are run by hand rather than by runImports
+	s.imports = &imports{
+		opts:  ImportOptions{MaxPages: 1, TTL: time.Hour},
+		jobs:  map[string]*ImportJob{},
+		queue: make(chan importRequest, importQueueSize),
+	}
+	s.imports.importer = evictingImporter{fakeImporter{store}, s.imports}
+
+	if _, status, err := s.imports.start("d", 1); err != nil || status != http.StatusAccepted {
+		t.Fatalf("unexpected status %d: %v", status, err)
+	}
+
+	s.runImport(context.Background(), <-s.imports.queue)
+
+	if job, ok := s.imports.job("d"); ok {
+		t.Fatalf("expected the evicted job to stay evicted, got %#v", job)
+	}
+
+	if !strings.Contains(logs.String(), "import result dropped") || strings.Contains(logs.String(), "import failed") {
+		t.Fatalf("expected the result of the evicted import to be dropped, got %s", logs.String())
+	}
+
+	// A new import of the user is not changed by the import of the evicted job
+	if _, _, err := s.imports.start("d", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	evicted := importRequest{username: "d", k: 1, createdAt: time.Now().Add(-time.Minute)}
+	if s.imports.updateRequest(evicted, func(job *ImportJob) { job.Status = ImportFailed }) {
+		t.Fatal("expected the job of another import not to be updated")
+	}
+
+	if job, _ := s.imports.job("d"); job.Status != ImportPending {
+		t.Fatalf("unexpected job %#v", job)
+	}
+}
@@ -0,0 +1,364 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// importQueueSize is the number of imports waiting for the running one, the next ones are refused
+	importQueueSize = 100
+	// failedImportTTL is how long a failed job is kept for its error to be polled
+	failedImportTTL = 10 * time.Minute
+	// evictInterval is the interval between the removals of the expired jobs
+	evictInterval = time.Minute
+)
+
+// usernamePattern is the pattern of the letterboxd usernames.
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// Importer scrape the history of a letterboxd user on demand, [scraper.Scraper] is one.
+type Importer interface {
+	ImportUser(ctx context.Context, userUrl string, maxPages int, progress func(done int, total int)) error
+}
+
+type ImportOptions struct {
+	// MaxPages is the number of films pages of the user scraped, the latest movies first
+	MaxPages int
+	// TTL is how long the result of an import is served before the user is imported again
+	TTL time.Duration
+}
+
+type ImportStatus string
+
+const (
+	ImportPending ImportStatus = "pending"
+	ImportRunning ImportStatus = "running"
+	ImportDone    ImportStatus = "done"
+	ImportFailed  ImportStatus = "failed"
+)
+
+type ImportRequest struct {
+	// Username is the letterboxd username (e.g. karsten), the url of the profile is also accepted
+	Username string `json:"username"`
+	K        int    `json:"k,omitempty"`
+}
+
+// ImportJob is the import of a user, it is polled until its status is done or failed.
+type ImportJob struct {
+	Username string       `json:"username"`
+	UserUrl  string       `json:"user_url"`
+	Status   ImportStatus `json:"status"`
+	// Scraped and Total are the activities of the user scraped so far and to scrape, Total is 0 until the films pages
+	// are listed
+	Scraped    int        `json:"scraped"`
+	Total      int        `json:"total"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// K is the number of recommendations asked by the last request of the user
+	K               int              `json:"k"`
+	Recommendations []Recommendation `json:"recommendations,omitempty"`
+}
+
+// imports run the imports one after the other, the scraper is throttled anyway.
+type imports struct {
+	importer Importer
+	opts     ImportOptions
+
+	mu    sync.Mutex
+	jobs  map[string]*ImportJob
+	queue chan importRequest
+}
+
+// importRequest is a queued import, it holds everything the import needs as the job of the user may be evicted or
+// replaced before the import finishes.
+type importRequest struct {
+	username  string
+	k         int
+	createdAt time.Time
+}
+
+// EnableImports serve the imports of letterboxd users on POST /imports and GET /imports/{username}, the history of
+// the imported user is stored and the movies recommended to it are cached along with the job until the TTL expires.
+// The imports run until ctx is done.
+func (s *Server) EnableImports(ctx context.Context, importer Importer, opts ImportOptions) {
+	s.imports = &imports{
+		importer: importer,
+		opts:     opts,
+		jobs:     map[string]*ImportJob{},
+		queue:    make(chan importRequest, importQueueSize),
+	}
+
+	s.mux.HandleFunc("POST /imports", s.createImport)
+	s.mux.HandleFunc("GET /imports/{username}", s.getImport)
+
+	go s.runImports(ctx)
+}
+
+// createImport start the import of a user, the job of the user is returned as is if it is still running or if its
+// result is not expired.
+func (s *Server) createImport(w http.ResponseWriter, r *http.Request) {
+	var req ImportRequest
+
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+
+	username := Username(req.Username)
+	if !usernamePattern.MatchString(username) {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid username %q", req.Username))
+		return
+	}
+
+	k, err := checkK(req.K)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	job, status, err := s.imports.start(username, k)
+	if err != nil {
+		s.writeError(w, status, err)
+		return
+	}
+
+	// The cached result is recommended again for another number of recommendations
+	if status == http.StatusOK && job.K != k {
+		recommendations, err := s.recommendUser(job.UserUrl, k)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		job.K, job.Recommendations = k, recommendations
+		s.imports.update(username, func(job *ImportJob) { job.K, job.Recommendations = k, recommendations })
+	}
+
+	w.Header().Set("Location", "/imports/"+username)
+	s.writeJSON(w, status, job)
+}
+
+// start queue the import of a user and return its job with the status of the response, the job of the user is
+// returned as is if it is still running or if its result is not expired.
+func (i *imports) start(username string, k int) (ImportJob, int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if job, ok := i.jobs[username]; ok && !i.expired(job) {
+		if job.Status == ImportDone {
+			return *job, http.StatusOK, nil
+		}
+
+		return *job, http.StatusAccepted, nil
+	}
+
+	request := importRequest{username: username, k: k, createdAt: time.Now()}
+
+	select {
+	case i.queue <- request:
+	default:
+		return ImportJob{}, http.StatusServiceUnavailable, errors.New("too many imports in progress, try again later")
+	}
+
+	job := &ImportJob{
+		Username:  username,
+		UserUrl:   "/" + username + "/",
+		Status:    ImportPending,
+		CreatedAt: request.createdAt,
+		K:         k,
+	}
+
+	i.jobs[username] = job
+
+	return *job, http.StatusAccepted, nil
+}
+
+func (s *Server) getImport(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.imports.job(Username(r.PathValue("username")))
+	if !ok {
+		s.writeError(w, http.StatusNotFound, fmt.Errorf("no import of %s", r.PathValue("username")))
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, job)
+}
+
+// expired tell if the job must be run again, the failed jobs are always run again.
+func (i *imports) expired(job *ImportJob) bool {
+	switch job.Status {
+	case ImportFailed:
+		return true
+	case ImportDone:
+		return time.Since(*job.FinishedAt) > i.opts.TTL
+	default:
+		return false
+	}
+}
+
+// retention return how long a finished job is kept, the failed jobs are kept for their error to be polled.
+func (i *imports) retention(job *ImportJob) time.Duration {
+	if job.Status == ImportFailed {
+		return min(i.opts.TTL, failedImportTTL)
+	}
+
+	return i.opts.TTL
+}
+
+// evict remove the finished jobs those are kept for longer than their retention, the jobs of any username posted would
+// be kept forever otherwise.
+func (i *imports) evict() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for username, job := range i.jobs {
+		if job.FinishedAt != nil && time.Since(*job.FinishedAt) > i.retention(job) {
+			delete(i.jobs, username)
+		}
+	}
+}
+
+func (s *Server) runImports(ctx context.Context) {
+	ticker := time.NewTicker(evictInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.imports.evict()
+		case request := <-s.imports.queue:
+			s.runImport(ctx, request)
+		}
+	}
+}
+
+func (s *Server) runImport(ctx context.Context, request importRequest) {
+	username := request.username
+
+	s.imports.updateRequest(request, func(job *ImportJob) { job.Status = ImportRunning })
+
+	userUrl := "/" + username + "/"
+
+	err := s.imports.importer.ImportUser(ctx, userUrl, s.imports.opts.MaxPages, func(done int, total int) {
+		s.imports.updateRequest(request, func(job *ImportJob) { job.Scraped, job.Total = done, total })
+	})
+
+	var recommendations []Recommendation
+	if err == nil {
+		recommendations, err = s.recommendUser(userUrl, request.k)
+	}
+
+	finishedAt := time.Now()
+
+	updated := s.imports.updateRequest(request, func(job *ImportJob) {
+		job.FinishedAt = &finishedAt
+
+		if err != nil {
+			job.Status, job.Error = ImportFailed, err.Error()
+			return
+		}
+
+		job.Status, job.Recommendations = ImportDone, recommendations
+	})
+
+	switch {
+	case err != nil:
+		s.logger.Error("import failed", "username", username, "error", err)
+	case !updated:
+		s.logger.Warn("import result dropped, the job was evicted", "username", username)
+	default:
+		s.logger.Info("user imported", "username", username, "duration", finishedAt.Sub(request.createdAt))
+	}
+}
+
+// recommendUser recommend movies to a user from its history in the db, the movies rated under 2.5 are not used to
+// find the recommendations but they are never recommended either.
+func (s *Server) recommendUser(userUrl string, k int) ([]Recommendation, error) {
+	user, err := s.store.UserByUrl(userUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := s.userHistory(user)
+	if err != nil {
+		return nil, err
+	}
+
+	// The history is the latest first, a movie is rated by its latest rating and loved if it was ever loved
+	var watched []Watched
+	seen := map[string]int{}
+
+	for _, activity := range history {
+		i, ok := seen[activity.MovieUrl]
+		if !ok {
+			i = len(watched)
+			seen[activity.MovieUrl] = i
+			watched = append(watched, Watched{Url: activity.MovieUrl})
+		}
+
+		if watched[i].Rating == nil {
+			watched[i].Rating = activity.Rating
+		}
+
+		watched[i].Loved = watched[i].Loved || activity.IsLoved
+	}
+
+	return s.recommend(watched, k), nil
+}
+
+// job return a copy of the job of a user, which is safe to read while the import runs.
+func (i *imports) job(username string) (ImportJob, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	job, ok := i.jobs[username]
+	if !ok {
+		return ImportJob{}, false
+	}
+
+	return *job, true
+}
+
+// update change the job of a user, nothing is done if the job was evicted meanwhile.
+func (i *imports) update(username string, update func(job *ImportJob)) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if job, ok := i.jobs[username]; ok {
+		update(job)
+	}
+}
+
+// updateRequest change the job of a queued import and tell if it was changed, nothing is done if the job was evicted
+// or replaced by another import of the user meanwhile.
+func (i *imports) updateRequest(request importRequest, update func(job *ImportJob)) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	job, ok := i.jobs[request.username]
+	if !ok || !job.CreatedAt.Equal(request.createdAt) {
+		return false
+	}
+
+	update(job)
+
+	return true
+}
+
+// Username turn a letterboxd username or the url of a profile (e.g. https://letterboxd.com/karsten/) into the
+// username (karsten).
+func Username(username string) string {
+	username = strings.TrimPrefix(username, "https://")
+	username = strings.TrimPrefix(username, "letterboxd.com")
+	username = strings.Trim(username, "/")
+
+	return strings.ToLower(username)
+}
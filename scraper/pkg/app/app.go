@@ -1,33 +1,42 @@
 package app
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
 
+	"github.com/leminhohoho/movie-lens/scraper/pkg/config"
 	"github.com/leminhohoho/movie-lens/scraper/pkg/logger"
 	"github.com/leminhohoho/movie-lens/scraper/pkg/scraper"
 )
 
 type App struct {
+	Config  *config.Config
 	Logger  *slog.Logger
 	Scraper *scraper.Scraper
-
-	ErrChan chan error
+	// Out is where the commands print their results
+	Out io.Writer
+	// movieIndex is the movie index updated with the scraped movies, it is nil until a scrape opens it
+	movieIndex *movieIndex
 }
 
-func NewApp() (*App, error) {
+func NewApp(cfg *config.Config) (*App, error) {
 	var err error
 
 	app := &App{
-		ErrChan: make(chan error),
+		Config: cfg,
+		Out:    os.Stdout,
 	}
 
-	app.Logger, err = logger.NewLogger()
+	app.Logger, err = logger.NewLogger(cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	app.Scraper, err = scraper.NewScraper(app.Logger, app.ErrChan)
+	app.Scraper, err = scraper.NewScraper(cfg, app.Logger)
 	if err != nil {
 		return nil, err
 	}
@@ -35,29 +44,44 @@ func NewApp() (*App, error) {
 	return app, nil
 }
 
-func (a *App) Run() error {
-	a.Logger.Info(
-		"scraper info",
-		"db_path", os.Getenv("DB_PATH"),
-		"proxy_url", os.Getenv("PROXY_URL"),
-		"headless", os.Getenv("HEADLESS") == "TRUE",
-		"browser_addr", os.Getenv("BROWSER_ADDR"),
-		"user_data_dir", os.Getenv("USER_DATA_DIR"),
-		"debug", os.Getenv("DEBUG") == "TRUE",
-		"silent", os.Getenv("SILENT") == "TRUE",
-	)
-
-	go a.Scraper.Run()
-
-	for {
-		select {
-		case err := <-a.ErrChan:
-			a.Logger.Error(err.Error())
-			return err
-		}
+// Run run the command given by args, the crawl is run if no command is given.
+// The command stops once ctx is done, the work in progress is saved before returning.
+func (a *App) Run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		args = []string{"crawl"}
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %s\n\n%s", args[0], Usage)
+	}
+
+	return cmd(a, ctx, args[1:])
+}
+
+// Close save the movie index updated by the scrapes and release the browser and the db connection.
+func (a *App) Close() error {
+	var err error
+	if a.movieIndex != nil {
+		err = a.movieIndex.save()
 	}
+
+	return errors.Join(err, a.Scraper.Close())
 }
 
-func (a *App) Close() {
-	close(a.ErrChan)
+// updateMovieIndex add the movies scraped from now on to the movie index of the encoded dir, if one is configured.
+func (a *App) updateMovieIndex() error {
+	if a.Config.EncodedDir == "" || a.movieIndex != nil {
+		return nil
+	}
+
+	index, err := openMovieIndex(a.Config.EncodedDir, a.Scraper.Storage().DB(), a.Logger)
+	if err != nil || index == nil {
+		return err
+	}
+
+	a.movieIndex = index
+	a.Scraper.OnMovieSaved(index.add)
+
+	return nil
 }
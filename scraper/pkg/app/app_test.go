@@ -0,0 +1,358 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"maps"
+	"math/rand/v2"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/leminhohoho/movie-lens/scraper/pkg/config"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/features"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/models"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/scraper"
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestCommands(t *testing.T) {
+	dir := t.TempDir()
+	filmUrl := "/film/godzilla-kong-the-new-empire/"
+
+	archive, err := scraper.NewArchive(path.Join(dir, "archive"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	html, err := os.ReadFile("../scraper/extractors/testdata/film.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := archive.Put(filmUrl, time.Now(), string(html)); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.Default()
+	cfg.DBPath = path.Join(dir, "letterboxd.db")
+	cfg.ArchiveMode = "replay"
+	cfg.ArchiveDir = path.Join(dir, "archive")
+
+	a, err := NewApp(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	var out bytes.Buffer
+	a.Out = &out
+
+	if err := a.Run(context.Background(), []string{"scrape", "movie", "https://letterboxd.com/film/godzilla-kong-the-new-empire"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Run(context.Background(), []string{"stats"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !regexp.MustCompile(`(?m)^movies\s+1\s*$`).MatchString(out.String()) ||
+		!regexp.MustCompile(`(?m)^genres_and_movies\s+2\s*$`).MatchString(out.String()) {
+		t.Errorf("unexpected stats\n%s", out.String())
+	}
+
+	exportDir := path.Join(dir, "export")
+
+	if err := a.Run(context.Background(), []string{"export", "-out", exportDir, "-tables", "movies,genres"}); err != nil {
+		t.Fatal(err)
+	}
+
+	movies, err := os.ReadFile(path.Join(exportDir, "movies.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(movies)), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "id,url,name") || !strings.Contains(lines[1], filmUrl) {
+		t.Errorf("unexpected movies export\n%s", movies)
+	}
+
+	if _, err := os.Stat(path.Join(exportDir, "users.csv")); !os.IsNotExist(err) {
+		t.Error("expected only the selected tables to be exported")
+	}
+
+	encodedDir := path.Join(dir, "encoded")
+
+	if err := a.Run(context.Background(), []string{"encode", "-out", encodedDir, "-min-freq", "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	out.Reset()
+
+	if err := a.Run(context.Background(), []string{"index", "build", "-encoded", encodedDir}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(out.String(), "1 movies indexed") {
+		t.Errorf("unexpected index build output\n%s", out.String())
+	}
+
+	out.Reset()
+
+	if err := a.Run(context.Background(), []string{"index", "search", "-encoded", encodedDir, filmUrl}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The only movie of the index is the query
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 1 {
+		t.Errorf("expected no similar movie in the index\n%s", out.String())
+	}
+
+	out.Reset()
+
+	if err := a.Run(context.Background(), []string{"similar", "-k", "5", filmUrl}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(out.String(), "url") {
+		t.Errorf("unexpected similar output\n%s", out.String())
+	}
+
+	// The movies scraped once the encoded dir is set are added to its index
+	a.Config.EncodedDir = encodedDir
+
+	if err := a.Run(context.Background(), []string{"scrape", "movie", filmUrl}); err != nil {
+		t.Fatal(err)
+	}
+
+	if a.movieIndex == nil || a.movieIndex.added != 1 || a.movieIndex.index.Len() != 1 {
+		t.Error("expected the scraped movie to be added to the movie index")
+	}
+
+	// A mistyped encoding must not give an empty dataset
+	if err := a.Run(context.Background(), []string{
+		"dataset", "-encoding", path.Join(dir, "encoding.json"), "-out", path.Join(dir, "dataset"),
+	}); !errors.Is(err, features.ErrNoEncoding) {
+		t.Fatalf("expected the missing encoding to fail the dataset, got %v", err)
+	}
+
+	if err := a.Run(context.Background(), []string{
+		"dataset", "-encoding", path.Join(encodedDir, "encoding.json"), "-out", path.Join(dir, "dataset"), "-split", "time",
+		"-validation-cutoff", "2024-01-01", "-test-cutoff", "2024-06-01",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(path.Join(dir, "dataset", "manifest.json")); err != nil {
+		t.Errorf("expected the manifest of the dataset to be written: %s", err)
+	}
+
+	out.Reset()
+
+	if err := a.Run(context.Background(), []string{
+		"evaluate", "-dataset", path.Join(dir, "dataset"), "-encoding", path.Join(encodedDir, "encoding.json"), "-models", "popularity",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !regexp.MustCompile(`(?m)^popularity\s+0\s`).MatchString(out.String()) {
+		t.Errorf("expected no user to be evaluated without activity\n%s", out.String())
+	}
+
+	if err := a.Run(context.Background(), []string{"unknown"}); err == nil {
+		t.Error("expected an error for an unknown command")
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	cfg := config.Default()
+	cfg.DBPath = path.Join(t.TempDir(), "letterboxd.db")
+
+	var out bytes.Buffer
+
+	// The db is not migrated by the migrate command itself
+	if err := Migrate(cfg, []string{"status"}, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if !regexp.MustCompile(`(?m)^0001\s+init\s+pending`).MatchString(out.String()) {
+		t.Fatalf("expected the first migration to be pending\n%s", out.String())
+	}
+
+	out.Reset()
+
+	if err := Migrate(cfg, []string{"up"}, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.String() == "0 migrations applied\n" {
+		t.Fatalf("expected the pending migrations to be applied\n%s", out.String())
+	}
+
+	out.Reset()
+
+	if err := Migrate(cfg, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if !regexp.MustCompile(`(?m)^0001\s+init\s+\d{4}-`).MatchString(out.String()) || strings.Contains(out.String(), "pending") {
+		t.Fatalf("expected every migration to be applied\n%s", out.String())
+	}
+
+	out.Reset()
+
+	if err := Migrate(cfg, []string{"down", "-steps", "1"}, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.String() != "1 migrations reverted\n" {
+		t.Fatalf("unexpected migrate down output\n%s", out.String())
+	}
+
+	out.Reset()
+
+	if err := Migrate(cfg, []string{"up"}, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.String() != "1 migrations applied\n" {
+		t.Fatalf("expected the reverted migration to be applied again\n%s", out.String())
+	}
+
+	if err := Migrate(cfg, []string{"sideways"}, &out); err == nil {
+		t.Fatal("expected an error for an unknown migrate action")
+	}
+}
+
+// writeTestModel write a FilmRecommender of a single block with random weights to filePath, in the safetensors format
+// of ml/export_film_recommender.py.
+func writeTestModel(t *testing.T, filePath string, embd int, out int, metadata map[string]string) {
+	rng := rand.New(rand.NewPCG(42, 0))
+	shapes := map[string][]int{
+		"ln_f.weight": {embd}, "ln_f.bias": {embd}, "lm_head.weight": {out, embd}, "lm_head.bias": {out},
+		"blocks.0.sa.heads.0.qkv.weight": {3 * embd, embd},
+		"blocks.0.sa.proj.weight":        {embd, embd}, "blocks.0.sa.proj.bias": {embd},
+		"blocks.0.ffwd.net.0.weight": {4 * embd, embd}, "blocks.0.ffwd.net.0.bias": {4 * embd},
+		"blocks.0.ffwd.net.2.weight": {embd, 4 * embd}, "blocks.0.ffwd.net.2.bias": {embd},
+		"blocks.0.ln1.weight": {embd}, "blocks.0.ln1.bias": {embd}, "blocks.0.ln2.weight": {embd}, "blocks.0.ln2.bias": {embd},
+	}
+
+	header := map[string]any{"__metadata__": metadata}
+	var data bytes.Buffer
+
+	for _, name := range slices.Sorted(maps.Keys(shapes)) {
+		start := data.Len()
+
+		size := 1
+		for _, dim := range shapes[name] {
+			size *= dim
+		}
+
+		for range size {
+			binary.Write(&data, binary.LittleEndian, float32(rng.NormFloat64()*0.3))
+		}
+
+		header[name] = map[string]any{"dtype": "F32", "shape": shapes[name], "data_offsets": []int{start, data.Len()}}
+	}
+
+	content, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var file bytes.Buffer
+	binary.Write(&file, binary.LittleEndian, uint64(len(content)))
+	file.Write(content)
+	file.Write(data.Bytes())
+
+	if err := os.WriteFile(filePath, file.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPredict(t *testing.T) {
+	dir := t.TempDir()
+
+	cfg := config.Default()
+	cfg.DBPath = path.Join(dir, "letterboxd.db")
+
+	a, err := NewApp(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	var out bytes.Buffer
+	a.Out = &out
+
+	store := a.Scraper.Storage()
+	movieIds := map[string]int{}
+
+	for _, url := range []string{"/film/dune/", "/film/barbie/", "/film/arrival/"} {
+		id, err := store.SaveMovie(&models.MovieDetails{
+			Movie:  models.Movie{Url: url, Name: url},
+			Genres: []models.Genre{{Url: "/films/genre/drama/", Name: "Drama"}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		movieIds[url] = id
+	}
+
+	userIds, err := store.SaveUsers([]models.User{{Url: "/karsten/", Name: "Karsten"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.SaveActivities([]models.UserAndMovie{
+		{UserId: userIds["/karsten/"], MovieId: movieIds["/film/dune/"], Date: "2024-03-01T18:40:00.000Z", IsWatch: true},
+		{UserId: userIds["/karsten/"], MovieId: movieIds["/film/barbie/"], Date: "2024-03-02T18:40:00.000Z", IsWatch: true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	encodedDir := path.Join(dir, "encoded")
+
+	if err := a.Run(context.Background(), []string{"encode", "-out", encodedDir, "-min-freq", "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	movies, err := parquet.ReadFile[features.EncodedMovie](path.Join(encodedDir, features.MoviesFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	movieFeatures := len(movies[0].Vector())
+	modelFile := path.Join(dir, "model.safetensors")
+
+	writeTestModel(t, modelFile, len(features.ActivityColumns)+movieFeatures, movieFeatures, map[string]string{
+		"format": "pt", "activity_columns": strings.Join(features.ActivityColumns, ","),
+	})
+
+	out.Reset()
+
+	if err := a.Run(context.Background(), []string{"predict", "-model", modelFile, "-encoded", encodedDir, "-k", "5", "karsten"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Arrival is the only movie the user didn't watch
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 2 || !strings.HasPrefix(lines[1], "/film/arrival/") {
+		t.Fatalf("unexpected predictions\n%s", out.String())
+	}
+
+	// The model of the notebook is trained on 6 activity features
+	writeTestModel(t, modelFile, 6+movieFeatures, movieFeatures, map[string]string{"format": "pt"})
+
+	if err := a.Run(context.Background(), []string{"predict", "-model", modelFile, "-encoded", encodedDir, "karsten"}); err == nil ||
+		!strings.Contains(err.Error(), "activities of 6 features") {
+		t.Fatalf("expected the model of the notebook to be refused, got %v", err)
+	}
+}
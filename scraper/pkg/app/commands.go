@@ -0,0 +1,871 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/leminhohoho/movie-lens/scraper/pkg/ann"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/config"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/dataset"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/evaluate"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/features"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/logger"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/migrations"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/recommend"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/scraper"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/storage"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/transformer"
+	"github.com/parquet-go/parquet-go"
+)
+
+// Usage is the help of the commands, printed when the command is unknown.
+const Usage = `Usage: movielens [flags] <command> [args]
+
+Commands:
+  crawl                  crawl the popular members and their activities (default)
+  scrape movie <url>...  scrape the given movies again (e.g. /film/dune-part-two/)
+  scrape user <url>...   scrape the given users and all their activities (e.g. /karsten/)
+  export [-format csv|parquet] [-out dir] [-tables users,movies] [-rows-per-file n]
+                         export the tables to CSV files, or the tables and the movies_view and activities_view
+                         to a new Parquet snapshot. The files have at most n rows, movies_view is partitioned by
+                         release_year and users_and_movies and activities_view by year, the other tables are only
+                         split by row count
+  stats                  print the number of rows of every table, the crawl jobs by status and the failed jobs by error class
+  requeue [-class http] [-kind activity]
+                         put the failed jobs back into the frontier for the next crawl
+  migrate [up|down [-steps n]|status]
+                         apply or revert the schema migrations, or print which are applied (default)
+  encode [-out dir] [-min-freq n]
+                         encode the movies and the activities to multihot_movies.parquet and multihot_activities.parquet,
+                         the ids of the previous encoding saved in the same dir are kept. They are not the files of
+                         the notebooks, the movies are multi-hot encoded
+  dataset [-encoding file] [-out dir] [-split leave-last|time] [-leave-out n] [-validation-cutoff date] [-test-cutoff date]
+          [-block-size n] [-stride n]
+                         build the chronological sequences of movies of every user, split them for the train,
+                         the validation and the test and write their windows to Parquet
+  recommend [-model popularity|genre-popularity|item-knn|als|content] [-model-file file] [-k n] <url>...
+                         recommend movies to a user who watched the given movies (e.g. /film/dune-part-two/)
+  similar [-k n] [-themes x] [-description x] [-directors x] [-actors x] [-genres x] <url>
+                         print the movies the most similar to the given movie by their metadata, with the part of
+                         every feature in their similarity
+  train-als [-factors n] [-regularization x] [-iterations n] [-alpha x] [-workers n] [-out file]
+                         train the implicit ALS matrix factorization on the activities and save it
+  index build [-encoded dir] [-metric cosine|dot] [-m n] [-ef-construction n] [-ef-search n]
+                         build the approximate nearest neighbour index of the encoded movies, the movies scraped
+                         afterward are added to it when the encoded-dir flag is set
+  index search [-encoded dir] [-k n] <url>
+                         print the movies the closest to the given movie in the index
+  predict [-model file] [-encoded dir] [-block-size n] [-k n] <user url>
+                         predict the next movies of a user from the latest encoded activities of the user, with a
+                         FilmRecommender trained on the encoded files and exported by ml/export_film_recommender.py
+  evaluate [-dataset dir] [-encoding file] [-split validation|test] [-models popularity,item-knn] [-k n] [-format table|json]
+                         train the recommenders on the movies before the split of the dataset and report how well they
+                         recommend the movies of the split, overall and by activity of the users
+
+Run movielens -h for the list of flags.`
+
+var commands = map[string]func(a *App, ctx context.Context, args []string) error{
+	"crawl":     (*App).crawl,
+	"scrape":    (*App).scrape,
+	"export":    (*App).export,
+	"stats":     (*App).stats,
+	"requeue":   (*App).requeue,
+	"encode":    (*App).encode,
+	"dataset":   (*App).dataset,
+	"recommend": (*App).recommend,
+	"similar":   (*App).similar,
+	"train-als": (*App).trainALS,
+	"evaluate":  (*App).evaluate,
+	"index":     (*App).index,
+	"predict":   (*App).predict,
+}
+
+func (a *App) crawl(ctx context.Context, args []string) error {
+	a.Logger.Info(
+		"scraper info",
+		"db_path", a.Config.DBPath,
+		"proxy_url", a.Config.ProxyURL,
+		"headless", a.Config.Headless,
+		"browser_addr", a.Config.BrowserAddr,
+		"user_data_dir", a.Config.UserDataDir,
+		"workers", a.Config.Workers,
+		"debug", a.Config.Debug,
+		"silent", a.Config.Silent,
+	)
+
+	if err := a.updateMovieIndex(); err != nil {
+		return err
+	}
+
+	summary, err := a.Scraper.Run(ctx)
+
+	state := "finished"
+	if summary.Interrupted {
+		state = "interrupted"
+	}
+
+	fmt.Fprintf(a.Out, "crawl %s after %s: %d jobs done, %d failed, %d pending\n",
+		state, summary.Duration.Round(time.Second), summary.Done, summary.Failed, summary.Pending,
+	)
+
+	if err != nil {
+		a.Logger.Error(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (a *App) scrape(ctx context.Context, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("scrape expects movie or user followed by at least one url\n\n%s", Usage)
+	}
+
+	var scrape func(ctx context.Context, url string) error
+
+	switch args[0] {
+	case "movie":
+		scrape = a.Scraper.ScrapeMovie
+	case "user":
+		scrape = a.Scraper.ScrapeUser
+	default:
+		return fmt.Errorf("unknown scrape target %s, expected movie or user", args[0])
+	}
+
+	if err := a.updateMovieIndex(); err != nil {
+		return err
+	}
+
+	for _, url := range args[1:] {
+		if err := scrape(ctx, normalizeUrl(url)); err != nil {
+			return fmt.Errorf("unable to scrape %s: %w", url, err)
+		}
+
+		a.Logger.Info("scraped", "target", args[0], "url", url)
+	}
+
+	return nil
+}
+
+// normalizeUrl turn the url given on the command line (e.g. https://letterboxd.com/film/dune-part-two or film/dune-part-two)
+// into the relative url used by the scraper (/film/dune-part-two/).
+func normalizeUrl(url string) string {
+	url = strings.TrimPrefix(url, "https://")
+	url = strings.TrimPrefix(url, "letterboxd.com")
+
+	return "/" + strings.Trim(url, "/") + "/"
+}
+
+func (a *App) export(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "csv", "format of the exported files (csv or parquet)")
+	out := fs.String("out", "export", "directory of the exported files")
+	tables := fs.String("tables", "", "comma separated tables (and views for parquet) to export, every one is exported if empty")
+	rowsPerFile := fs.Int("rows-per-file", 1000000, "maximum number of rows of a parquet file, the tables those are not partitioned are only split by it")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var selected []string
+	if *tables != "" {
+		selected = strings.Split(*tables, ",")
+	}
+
+	switch *format {
+	case "csv":
+		return a.Scraper.ExportCSV(*out, selected...)
+	case "parquet":
+		manifest, err := a.Scraper.ExportParquet(*out, *rowsPerFile, selected...)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(a.Out, "snapshot %s exported to %s\n", manifest.Snapshot, *out)
+
+		return nil
+	default:
+		return fmt.Errorf("unknown export format %s, expected csv or parquet", *format)
+	}
+}
+
+func (a *App) stats(ctx context.Context, args []string) error {
+	stats, err := a.Scraper.Stats()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(a.Out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "table\trows\t")
+	for _, table := range scraper.Tables {
+		fmt.Fprintf(w, "%s\t%d\t\n", table, stats.Rows[table])
+	}
+
+	fmt.Fprintln(w, "\t\t")
+	fmt.Fprintln(w, "crawl jobs\t\t")
+	for _, status := range []string{"pending", "in_progress", "done", "failed"} {
+		fmt.Fprintf(w, "%s\t%d\t\n", status, stats.Jobs[status])
+	}
+
+	fmt.Fprintln(w, "\t\t")
+	fmt.Fprintln(w, "failed jobs\t\t")
+	for _, class := range []scraper.ErrorClass{
+		scraper.ClassTransient, scraper.ClassHttp, scraper.ClassSelectorTimeout, scraper.ClassParse, scraper.ClassRemoved, scraper.ClassInternal,
+	} {
+		fmt.Fprintf(w, "%s\t%d\t\n", class, stats.Failures[string(class)])
+	}
+
+	return w.Flush()
+}
+
+func (a *App) requeue(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("requeue", flag.ContinueOnError)
+	class := fs.String("class", "", "error class of the jobs to re-queue (transient, http, selector_timeout, parse, removed or internal)")
+	kind := fs.String("kind", "", "kind of the jobs to re-queue (members_page, user, user_films or activity)")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	count, err := a.Scraper.Requeue(*class, *kind)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(a.Out, "%d failed jobs re-queued\n", count)
+
+	return nil
+}
+
+// Migrate run the migrate command on the db of the config. The db is opened without applying the migrations, unlike
+// [NewApp], so that the pending migrations are reported by status and applied by up.
+func Migrate(cfg *config.Config, args []string, out io.Writer) (err error) {
+	if len(args) == 0 {
+		args = []string{"status"}
+	}
+
+	l, err := logger.NewLogger(cfg)
+	if err != nil {
+		return err
+	}
+
+	dsn := cfg.DSN
+	if dsn == "" {
+		dsn = cfg.DBPath
+	}
+
+	store, err := storage.Connect(dsn, l)
+	if err != nil {
+		return err
+	}
+
+	defer func() { err = errors.Join(err, store.Close()) }()
+
+	switch args[0] {
+	case "up":
+		count, err := migrations.Up(store.DB(), l)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "%d migrations applied\n", count)
+	case "down":
+		fs := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+		steps := fs.Int("steps", 1, "number of migrations to revert")
+
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		count, err := migrations.Down(store.DB(), l, *steps)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "%d migrations reverted\n", count)
+	case "status":
+		statuses, err := migrations.Statuses(store.DB())
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+		fmt.Fprintln(w, "version\tname\tapplied at\t")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+
+			fmt.Fprintf(w, "%04d\t%s\t%s\t\n", status.Version, status.Name, appliedAt)
+		}
+
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown migrate action %s, expected up, down or status", args[0])
+	}
+
+	return nil
+}
+
+func (a *App) encode(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("encode", flag.ContinueOnError)
+	out := fs.String("out", "encoded", "directory of the encoded dataset and its encoding")
+	minFreq := fs.Int("min-freq", 5, "minimum number of movies a genre, theme, studio, country or language must appear in to get its own id")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	summary, err := features.Encode(a.Scraper.Storage().DB(), *out, *minFreq)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(a.Out, "%d movies, %d users and %d activities encoded to %s\n", summary.Movies, summary.Users, summary.Activities, *out)
+
+	w := tabwriter.NewWriter(a.Out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "vocabulary\ttokens\t")
+	for _, field := range features.Fields {
+		fmt.Fprintf(w, "%s\t%d\t\n", field, summary.Vocabularies[field])
+	}
+
+	return w.Flush()
+}
+
+func (a *App) dataset(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("dataset", flag.ContinueOnError)
+	encodingFile := fs.String("encoding", path.Join("encoded", features.EncodingFile), "encoding saved by the encode command, which gives the ids of the users and the movies")
+	out := fs.String("out", "dataset", "directory of the dataset")
+	split := fs.String("split", string(dataset.LeaveLastOut), "how the movies of the users are split (leave-last or time)")
+	leaveOut := fs.Int("leave-out", 1, "number of the last movies of every user held out for the validation and for the test with the leave-last split")
+	validationCutoff := fs.String("validation-cutoff", "", "date from which the movies are for the validation with the time split (e.g. 2024-01-01)")
+	testCutoff := fs.String("test-cutoff", "", "date from which the movies are for the test with the time split (e.g. 2024-06-01)")
+	blockSize := fs.Int("block-size", 16, "maximum number of movies before the target of a window")
+	stride := fs.Int("stride", 1, "gap between the targets of two train windows")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	opts := dataset.Options{
+		Strategy:  dataset.Strategy(*split),
+		LeaveOut:  *leaveOut,
+		BlockSize: *blockSize,
+		Stride:    *stride,
+	}
+
+	for _, cutoff := range []struct {
+		value string
+		date  *time.Time
+	}{{*validationCutoff, &opts.ValidationCutoff}, {*testCutoff, &opts.TestCutoff}} {
+		if cutoff.value == "" {
+			continue
+		}
+
+		date, err := time.Parse(time.DateOnly, cutoff.value)
+		if err != nil {
+			return fmt.Errorf("invalid cutoff %s: %w", cutoff.value, err)
+		}
+
+		*cutoff.date = date
+	}
+
+	if opts.Strategy == dataset.LeaveLastOut {
+		opts.ValidationCutoff, opts.TestCutoff = time.Time{}, time.Time{}
+	} else {
+		opts.LeaveOut = 0
+	}
+
+	encoding, err := features.LoadEncoding(*encodingFile)
+	if err != nil {
+		return err
+	}
+
+	activities, err := features.LoadActivities(a.Scraper.Storage().DB())
+	if err != nil {
+		return err
+	}
+
+	ds, err := dataset.Build(activities, encoding, opts)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := ds.Write(*out)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(a.Out, "%d users written to %s\n", manifest.Users, *out)
+
+	w := tabwriter.NewWriter(a.Out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "split\tusers\tmovies\twindows\t")
+	for _, split := range dataset.Splits {
+		stats := manifest.Splits[split]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t\n", split, stats.Users, stats.Movies, stats.Windows)
+	}
+
+	return w.Flush()
+}
+
+func (a *App) recommend(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("recommend", flag.ContinueOnError)
+	model := fs.String("model", "item-knn", fmt.Sprintf("recommender to use (one of %s)", strings.Join(recommend.Models, ", ")))
+	modelFile := fs.String("model-file", "", "ALS model saved by the train-als command, used instead of training the model again")
+	k := fs.Int("k", 10, "number of movies to recommend")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	data, err := recommend.LoadData(a.Scraper.Storage().DB())
+	if err != nil {
+		return err
+	}
+
+	var recommender recommend.Recommender
+
+	if *modelFile != "" {
+		recommender, err = recommend.LoadALS(*modelFile)
+	} else {
+		recommender, err = recommend.New(*model, data)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	watched := make([]string, fs.NArg())
+	for i, url := range fs.Args() {
+		watched[i] = normalizeUrl(url)
+	}
+
+	w := tabwriter.NewWriter(a.Out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "url\tname\tscore\t")
+	for _, recommendation := range recommender.Recommend(watched, *k) {
+		fmt.Fprintf(w, "%s\t%s\t%.4f\t\n", recommendation.Url, data.Movies[recommendation.Url].Name, recommendation.Score)
+	}
+
+	return w.Flush()
+}
+
+func (a *App) similar(ctx context.Context, args []string) error {
+	defaults := recommend.DefaultContentWeights()
+
+	fs := flag.NewFlagSet("similar", flag.ContinueOnError)
+	k := fs.Int("k", 10, "number of movies to print")
+	themes := fs.Float64("themes", defaults.Themes, "weight of the TF-IDF of the themes")
+	description := fs.Float64("description", defaults.Description, "weight of the TF-IDF of the descriptions")
+	directors := fs.Float64("directors", defaults.Directors, "weight of the overlap of the directors")
+	actors := fs.Float64("actors", defaults.Actors, "weight of the overlap of the actors")
+	genres := fs.Float64("genres", defaults.Genres, "weight of the Jaccard index of the genres")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("similar expects a movie url\n\n%s", Usage)
+	}
+
+	movies, err := features.LoadMovies(a.Scraper.Storage().DB())
+	if err != nil {
+		return err
+	}
+
+	url := normalizeUrl(fs.Arg(0))
+	idx := slices.IndexFunc(movies, func(movie features.Movie) bool { return movie.Url == url })
+
+	if idx < 0 {
+		return fmt.Errorf("movie %s not found", url)
+	}
+
+	content := recommend.NewContent(movies, recommend.ContentWeights{
+		Themes:      *themes,
+		Description: *description,
+		Directors:   *directors,
+		Actors:      *actors,
+		Genres:      *genres,
+	})
+
+	similar, err := content.SimilarMovies(movies[idx].Id, *k)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(a.Out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "url\tscore\tcontributions\t")
+	for _, movie := range similar {
+		contributions := make([]string, len(movie.Contributions))
+		for i, c := range movie.Contributions {
+			contributions[i] = fmt.Sprintf("%s %.3f (%s)", c.Feature, c.Score, strings.Join(c.Shared, ", "))
+		}
+
+		fmt.Fprintf(w, "%s\t%.4f\t%s\t\n", movie.Url, movie.Score, strings.Join(contributions, "; "))
+	}
+
+	return w.Flush()
+}
+
+func (a *App) trainALS(ctx context.Context, args []string) error {
+	defaults := recommend.DefaultALSOptions()
+
+	fs := flag.NewFlagSet("train-als", flag.ContinueOnError)
+	factors := fs.Int("factors", defaults.Factors, "size of the vectors of the users and the movies")
+	regularization := fs.Float64("regularization", defaults.Regularization, "L2 regularization of the vectors")
+	iterations := fs.Int("iterations", defaults.Iterations, "number of alternating least squares iterations")
+	alpha := fs.Float64("alpha", defaults.Alpha, "scale of the confidence of the interactions, loved and well rated movies weight more")
+	workers := fs.Int("workers", 0, "number of goroutines solving the vectors, the number of CPUs if 0")
+	out := fs.String("out", "als.gob", "file the model is saved to")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	data, err := recommend.LoadData(a.Scraper.Storage().DB())
+	if err != nil {
+		return err
+	}
+
+	opts := recommend.ALSOptions{
+		Factors:        *factors,
+		Regularization: *regularization,
+		Iterations:     *iterations,
+		Alpha:          *alpha,
+		Workers:        *workers,
+		Seed:           defaults.Seed,
+	}
+
+	als, err := recommend.TrainALS(data.Interactions, opts, a.Logger)
+	if err != nil {
+		return err
+	}
+
+	if err := als.Save(*out); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(a.Out, "model of %d users and %d movies saved to %s\n", als.Users.Len(), als.Movies.Len(), *out)
+
+	return nil
+}
+
+func (a *App) evaluate(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("evaluate", flag.ContinueOnError)
+	datasetDir := fs.String("dataset", "dataset", "directory of the dataset built by the dataset command")
+	encodingFile := fs.String("encoding", path.Join("encoded", features.EncodingFile), "encoding the dataset was built with")
+	split := fs.String("split", "test", "split to evaluate (validation or test)")
+	models := fs.String("models", strings.Join(recommend.Models, ","), "comma separated recommenders to evaluate")
+	k := fs.Int("k", 10, "number of movies recommended to every user")
+	format := fs.String("format", "table", "format of the reports (table or json)")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *format != "table" && *format != "json" {
+		return fmt.Errorf("unknown format %s, expected table or json", *format)
+	}
+
+	ds, err := dataset.Read(*datasetDir)
+	if err != nil {
+		return err
+	}
+
+	encoding, err := features.LoadEncoding(*encodingFile)
+	if err != nil {
+		return err
+	}
+
+	activities, err := features.LoadActivities(a.Scraper.Storage().DB())
+	if err != nil {
+		return err
+	}
+
+	movies, err := features.LoadMovies(a.Scraper.Storage().DB())
+	if err != nil {
+		return err
+	}
+
+	evaluated, err := evaluate.NewSplit(ds, encoding, activities, *split)
+	if err != nil {
+		return err
+	}
+
+	data := recommend.NewData(evaluated.Train, movies)
+
+	var reports []evaluate.Report
+
+	for _, model := range strings.Split(*models, ",") {
+		recommender, err := recommend.New(model, data)
+		if err != nil {
+			return err
+		}
+
+		report := evaluate.Evaluate(recommender, data.Interactions, evaluated, *k)
+		report.Model = model
+
+		a.Logger.Info("recommender evaluated", "model", model, "users", report.Overall.Users)
+
+		reports = append(reports, report)
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(a.Out)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(reports)
+	}
+
+	w := tabwriter.NewWriter(a.Out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "model\tusers\trecall@%[1]d\tprecision@%[1]d\tndcg@%[1]d\tmrr\tcoverage\tnovelty\tpopularity bias\t\n", *k)
+	for _, report := range reports {
+		rows := []struct {
+			name    string
+			metrics evaluate.Metrics
+		}{{report.Model, report.Overall}}
+
+		for _, bucket := range evaluate.Buckets {
+			rows = append(rows, struct {
+				name    string
+				metrics evaluate.Metrics
+			}{fmt.Sprintf("  %s movies", bucket.Name), report.Buckets[bucket.Name]})
+		}
+
+		for _, row := range rows {
+			m := row.metrics
+			fmt.Fprintf(w, "%s\t%d\t%.4f\t%.4f\t%.4f\t%.4f\t%.4f\t%.2f\t%.4f\t\n",
+				row.name, m.Users, m.Recall, m.Precision, m.NDCG, m.MRR, m.Coverage, m.Novelty, m.PopularityBias,
+			)
+		}
+	}
+
+	return w.Flush()
+}
+
+func (a *App) index(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("index expects build or search\n\n%s", Usage)
+	}
+
+	switch args[0] {
+	case "build":
+		defaults := ann.DefaultOptions()
+
+		fs := flag.NewFlagSet("index build", flag.ContinueOnError)
+		encodedDir := fs.String("encoded", "encoded", "directory of the movies encoded by the encode command, the index is saved in it")
+		metric := fs.String("metric", string(defaults.Metric), fmt.Sprintf("similarity of the movies (one of %s)", strings.Join(ann.Metrics, ", ")))
+		m := fs.Int("m", defaults.M, "number of neighbours a movie is linked to")
+		efConstruction := fs.Int("ef-construction", defaults.EfConstruction, "number of candidates kept while inserting a movie")
+		efSearch := fs.Int("ef-search", defaults.EfSearch, "number of candidates kept while searching")
+
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		movies, err := parquet.ReadFile[features.EncodedMovie](path.Join(*encodedDir, features.MoviesFile))
+		if err != nil {
+			return err
+		}
+
+		opts := ann.Options{
+			Metric:         ann.Metric(*metric),
+			M:              *m,
+			EfConstruction: *efConstruction,
+			EfSearch:       *efSearch,
+			Seed:           defaults.Seed,
+		}
+
+		start := time.Now()
+
+		index, err := ann.Build(movies, opts)
+		if err != nil {
+			return err
+		}
+
+		if err := index.Save(path.Join(*encodedDir, ann.IndexFile)); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(a.Out, "%d movies indexed in %s, index saved to %s\n",
+			index.Len(), time.Since(start).Round(time.Millisecond), path.Join(*encodedDir, ann.IndexFile),
+		)
+	case "search":
+		fs := flag.NewFlagSet("index search", flag.ContinueOnError)
+		encodedDir := fs.String("encoded", "encoded", "directory of the encoding and the movie index")
+		k := fs.Int("k", 10, "number of movies to print")
+
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		if fs.NArg() != 1 {
+			return fmt.Errorf("index search expects a movie url\n\n%s", Usage)
+		}
+
+		encoding, err := features.LoadEncoding(path.Join(*encodedDir, features.EncodingFile))
+		if err != nil {
+			return err
+		}
+
+		index, err := ann.Load(path.Join(*encodedDir, ann.IndexFile))
+		if err != nil {
+			return err
+		}
+
+		url := normalizeUrl(fs.Arg(0))
+
+		id, ok := encoding.Movies.Id(url)
+		vector, indexed := index.Vector(id)
+
+		if !ok || !indexed {
+			return fmt.Errorf("movie %s is not in the index", url)
+		}
+
+		// The movie is the closest to itself
+		results, err := index.Search(vector, *k+1)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(a.Out, 0, 0, 2, ' ', 0)
+
+		fmt.Fprintln(w, "url\tscore\t")
+
+		printed := 0
+		for _, result := range results {
+			// The query movie is not always among the results (e.g. movies with the same vector)
+			if printed == *k {
+				break
+			} else if result.Id == id {
+				continue
+			}
+
+			if result.Id >= len(encoding.Movies.Keys) {
+				a.Logger.Warn("movie of the index not in the encoding, the index is out of sync", "id", result.Id, "dir", *encodedDir)
+				continue
+			}
+
+			fmt.Fprintf(w, "%s\t%.4f\t\n", encoding.Movies.Keys[result.Id], result.Score)
+			printed++
+		}
+
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown index action %s, expected build or search", args[0])
+	}
+
+	return nil
+}
+
+func (a *App) predict(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("predict", flag.ContinueOnError)
+	modelFile := fs.String("model", "model.safetensors", "FilmRecommender exported by ml/export_film_recommender.py")
+	encodedDir := fs.String("encoded", "encoded", "directory of the movies and the activities encoded by the encode command")
+	blockSize := fs.Int("block-size", 16, "number of the latest activities of the user fed to the model")
+	k := fs.Int("k", 10, "number of movies to predict")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("predict expects a user url\n\n%s", Usage)
+	}
+
+	model, err := transformer.Load(*modelFile)
+	if err != nil {
+		return err
+	}
+
+	encoding, err := features.LoadEncoding(path.Join(*encodedDir, features.EncodingFile))
+	if err != nil {
+		return err
+	}
+
+	movies, err := parquet.ReadFile[features.EncodedMovie](path.Join(*encodedDir, features.MoviesFile))
+	if err != nil {
+		return err
+	}
+
+	activities, err := parquet.ReadFile[features.EncodedActivity](path.Join(*encodedDir, features.ActivitiesFile))
+	if err != nil {
+		return err
+	}
+
+	url := normalizeUrl(fs.Arg(0))
+
+	userId, ok := encoding.Users.Id(url)
+	if !ok {
+		return fmt.Errorf("user %s is not encoded", url)
+	}
+
+	// The activities of a user are ordered by date
+	var sequence []features.EncodedActivity
+	watched := map[int]bool{}
+
+	for _, activity := range activities {
+		if activity.UserId == userId {
+			sequence = append(sequence, activity)
+			watched[activity.MovieId] = true
+		}
+	}
+
+	if len(sequence) == 0 {
+		return fmt.Errorf("user %s has no encoded activity", url)
+	}
+
+	inputs, err := model.Inputs(sequence[max(len(sequence)-*blockSize, 0):], movies)
+	if err != nil {
+		return err
+	}
+
+	matrix := make([][]float32, len(movies))
+	for i, movie := range movies {
+		matrix[i] = movie.Vector()
+	}
+
+	// Every movie is ranked, the watched ones are skipped
+	predictions, err := model.Predict(inputs, matrix, len(matrix))
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(a.Out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "url\tlogit\t")
+
+	printed := 0
+	for _, prediction := range predictions {
+		if printed == *k {
+			break
+		}
+
+		movie := movies[prediction.Movie]
+		if watched[movie.Id] {
+			continue
+		}
+
+		fmt.Fprintf(w, "%s\t%.4f\t\n", encoding.Movies.Keys[movie.Id], prediction.Logit)
+		printed++
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,90 @@
+package app
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/leminhohoho/movie-lens/scraper/pkg/ann"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/features"
+	"gorm.io/gorm"
+)
+
+// movieIndex keep the movie index of the encoded dir up to date with the movies scraped, the movies are encoded with
+// the vocabularies of the last encode so their vectors have the size of the indexed ones.
+type movieIndex struct {
+	dir    string
+	db     *gorm.DB
+	logger *slog.Logger
+
+	// mu guards the encoding, which give the new movies their ids
+	mu       sync.Mutex
+	encoding *features.Encoding
+	index    *ann.Index
+	added    int
+}
+
+// openMovieIndex read the encoding and the movie index of dir, it returns nil if dir has no movie index.
+func openMovieIndex(dir string, db *gorm.DB, logger *slog.Logger) (*movieIndex, error) {
+	index, err := ann.Load(path.Join(dir, ann.IndexFile))
+	if errors.Is(err, os.ErrNotExist) {
+		logger.Warn("no movie index to update, it is built by the index build command", "dir", dir)
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	encoding, err := features.LoadEncoding(path.Join(dir, features.EncodingFile))
+	if err != nil {
+		return nil, err
+	}
+
+	return &movieIndex{dir: dir, db: db, logger: logger, encoding: encoding, index: index}, nil
+}
+
+// add encode the saved movie and insert it into the index, a movie which can't be indexed doesn't stop the scrape.
+func (m *movieIndex) add(movieId int) {
+	movies, err := features.LoadMovies(m.db, movieId)
+	if err != nil || len(movies) == 0 {
+		m.logger.Error("unable to load the movie to index", "movie_id", movieId, "error", err)
+		return
+	}
+
+	m.mu.Lock()
+	encoded := m.encoding.EncodeMovie(movies[0])
+	m.added++
+	m.mu.Unlock()
+
+	if err := m.index.Insert(encoded.Id, encoded.Vector()); err != nil {
+		m.logger.Error("unable to index the movie", "url", movies[0].Url, "error", err)
+		return
+	}
+
+	m.logger.Debug("movie indexed", "url", movies[0].Url, "id", encoded.Id)
+}
+
+// save write the encoding and the index back if movies were added, the encoding first since the index refers to the
+// ids it gives.
+func (m *movieIndex) save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.added == 0 {
+		return nil
+	}
+
+	if err := m.encoding.Save(path.Join(m.dir, features.EncodingFile)); err != nil {
+		return err
+	}
+
+	if err := m.index.Save(path.Join(m.dir, ann.IndexFile)); err != nil {
+		return err
+	}
+
+	m.logger.Info("movie index updated", "movies", m.added, "dir", m.dir)
+	m.added = 0
+
+	return nil
+}
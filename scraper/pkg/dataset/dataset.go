@@ -0,0 +1,208 @@
+package dataset
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/leminhohoho/movie-lens/scraper/pkg/features"
+)
+
+// Strategy is how the movies of every user are split between the train, the validation and the test.
+type Strategy string
+
+const (
+	// LeaveLastOut hold out the last movies of every user, the ones before are for the validation
+	LeaveLastOut Strategy = "leave-last"
+	// TimeCutoff split the movies of every user at the same dates, so no movie watched after the cutoff is trained on
+	TimeCutoff Strategy = "time"
+)
+
+// Splits are the names of the splits, in chronological order.
+var Splits = []string{"train", "validation", "test"}
+
+type Options struct {
+	Strategy Strategy `json:"strategy"`
+	// LeaveOut is the number of movies of every user held out for the validation and as many for the test with [LeaveLastOut].
+	// The users with at most 2*LeaveOut movies are only trained on.
+	LeaveOut int `json:"leave_out,omitempty"`
+	// ValidationCutoff and TestCutoff are the dates from which the movies are for the validation and for the test with [TimeCutoff]
+	ValidationCutoff time.Time `json:"validation_cutoff,omitzero"`
+	TestCutoff       time.Time `json:"test_cutoff,omitzero"`
+	// BlockSize is the maximum number of movies before the target of a window
+	BlockSize int `json:"block_size"`
+	// Stride is the gap between the targets of two train windows, every movie of the validation and the test is a target
+	Stride int `json:"stride"`
+}
+
+func (o Options) Validate() error {
+	switch o.Strategy {
+	case LeaveLastOut:
+		if o.LeaveOut < 1 {
+			return fmt.Errorf("leave_out must be at least 1, got %d", o.LeaveOut)
+		}
+	case TimeCutoff:
+		if o.ValidationCutoff.IsZero() || o.TestCutoff.IsZero() {
+			return fmt.Errorf("validation_cutoff and test_cutoff are required by the time strategy")
+		}
+
+		if o.TestCutoff.Before(o.ValidationCutoff) {
+			return fmt.Errorf("test_cutoff %s is before validation_cutoff %s", o.TestCutoff, o.ValidationCutoff)
+		}
+	default:
+		return fmt.Errorf("unknown strategy %s, expected %s or %s", o.Strategy, LeaveLastOut, TimeCutoff)
+	}
+
+	if o.BlockSize < 1 {
+		return fmt.Errorf("block_size must be at least 1, got %d", o.BlockSize)
+	}
+
+	if o.Stride < 1 {
+		return fmt.Errorf("stride must be at least 1, got %d", o.Stride)
+	}
+
+	return nil
+}
+
+// Sequence is the movies watched by a user in chronological order, every movie appears once at the date it is first logged.
+// The movies [0, TrainEnd) are for the train, [TrainEnd, ValidationEnd) for the validation and the rest for the test.
+type Sequence struct {
+	UserId   int32   `parquet:"user_id"`
+	MovieIds []int32 `parquet:"movie_ids,list"`
+	// Timestamps are the Unix times of the movies
+	Timestamps    []int64 `parquet:"timestamps,list"`
+	TrainEnd      int32   `parquet:"train_end"`
+	ValidationEnd int32   `parquet:"validation_end"`
+}
+
+// Bounds return the start and the end of split in the movies of the sequence.
+func (s Sequence) Bounds(split string) (int, int) {
+	switch split {
+	case "train":
+		return 0, int(s.TrainEnd)
+	case "validation":
+		return int(s.TrainEnd), int(s.ValidationEnd)
+	default:
+		return int(s.ValidationEnd), len(s.MovieIds)
+	}
+}
+
+// Window is a target movie with the movies watched right before it, the oldest first.
+// The inputs may come from an earlier split, they are always watched before the target.
+type Window struct {
+	UserId int32   `parquet:"user_id"`
+	Inputs []int32 `parquet:"inputs,list"`
+	Target int32   `parquet:"target"`
+}
+
+// Dataset is the sequences of the users split with the given options.
+type Dataset struct {
+	Options   Options
+	Sequences []Sequence
+	// Movies is the number of movie ids of the encoding, the ids of the sequences are all lower
+	Movies int
+}
+
+// Build make the sequence of every user from the activities, the users and the movies are identified by their id in encoding.
+// The activities of a user or a movie without an id (i.e. not encoded yet) and the ones without a date are skipped.
+func Build(activities []features.Activity, encoding *features.Encoding, opts Options) (*Dataset, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	type item struct {
+		movieId   int32
+		timestamp int64
+	}
+
+	byUser := map[int][]item{}
+
+	for _, activity := range activities {
+		userId, userOk := encoding.Users.Id(activity.UserUrl)
+		movieId, movieOk := encoding.Movies.Id(activity.MovieUrl)
+
+		if !userOk || !movieOk || activity.Date.IsZero() {
+			continue
+		}
+
+		byUser[userId] = append(byUser[userId], item{movieId: int32(movieId), timestamp: activity.Date.Unix()})
+	}
+
+	dataset := &Dataset{Options: opts, Movies: encoding.Movies.Len()}
+
+	for userId := range encoding.Users.Len() {
+		items := byUser[userId]
+		if len(items) == 0 {
+			continue
+		}
+
+		slices.SortStableFunc(items, func(a, b item) int {
+			if a.timestamp != b.timestamp {
+				return cmp.Compare(a.timestamp, b.timestamp)
+			}
+
+			return cmp.Compare(a.movieId, b.movieId)
+		})
+
+		sequence := Sequence{UserId: int32(userId)}
+		seen := map[int32]bool{}
+
+		for _, it := range items {
+			// A movie rated, reviewed or rewatched later is already in the sequence
+			if seen[it.movieId] {
+				continue
+			}
+
+			seen[it.movieId] = true
+			sequence.MovieIds = append(sequence.MovieIds, it.movieId)
+			sequence.Timestamps = append(sequence.Timestamps, it.timestamp)
+		}
+
+		sequence.TrainEnd, sequence.ValidationEnd = opts.split(sequence.Timestamps)
+		dataset.Sequences = append(dataset.Sequences, sequence)
+	}
+
+	return dataset, nil
+}
+
+// split return the end of the train and the end of the validation in the movies watched at timestamps.
+func (o Options) split(timestamps []int64) (int32, int32) {
+	n := len(timestamps)
+
+	if o.Strategy == LeaveLastOut {
+		if n <= 2*o.LeaveOut {
+			return int32(n), int32(n)
+		}
+
+		return int32(n - 2*o.LeaveOut), int32(n - o.LeaveOut)
+	}
+
+	trainEnd, _ := slices.BinarySearch(timestamps, o.ValidationCutoff.Unix())
+	validationEnd, _ := slices.BinarySearch(timestamps, o.TestCutoff.Unix())
+
+	return int32(trainEnd), int32(validationEnd)
+}
+
+// Windows return the windows of split, every movie of the split with at least one movie before it is a target.
+func (d *Dataset) Windows(split string) []Window {
+	var windows []Window
+
+	for _, sequence := range d.Sequences {
+		start, end := sequence.Bounds(split)
+
+		for target := max(start, 1); target < end; target++ {
+			if split == "train" && (target-1)%d.Options.Stride != 0 {
+				continue
+			}
+
+			windows = append(windows, Window{
+				UserId: sequence.UserId,
+				Inputs: sequence.MovieIds[max(0, target-d.Options.BlockSize):target],
+				Target: sequence.MovieIds[target],
+			})
+		}
+	}
+
+	return windows
+}
@@ -0,0 +1,141 @@
+package dataset
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/leminhohoho/movie-lens/scraper/pkg/features"
+	"github.com/parquet-go/parquet-go"
+)
+
+// newActivities return the activities of a user on the movies /film/0/, /film/1/, ... one day apart from 2024-01-01,
+// with the encoding giving the movie /film/n/ the id n.
+func newActivities(userUrl string, movies int) ([]features.Activity, *features.Encoding) {
+	encoding := features.NewEncoding()
+	encoding.Users.Add(userUrl)
+
+	var activities []features.Activity
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := range movies {
+		url := fmt.Sprintf("/film/%d/", i)
+		encoding.Movies.Add(url)
+		activities = append(activities, features.Activity{UserUrl: userUrl, MovieUrl: url, Date: start.AddDate(0, 0, i)})
+	}
+
+	return activities, encoding
+}
+
+func TestLeaveLastOut(t *testing.T) {
+	activities, encoding := newActivities("/karsten/", 6)
+
+	// A movie rated after it is watched appears once, at the date of the first activity
+	activities = append(activities, features.Activity{UserUrl: "/karsten/", MovieUrl: "/film/1/", Date: time.Now()})
+	// The activities of a user without an id are skipped
+	activities = append(activities, features.Activity{UserUrl: "/unknown/", MovieUrl: "/film/1/", Date: time.Now()})
+
+	ds, err := Build(activities, encoding, Options{Strategy: LeaveLastOut, LeaveOut: 1, BlockSize: 2, Stride: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ds.Sequences) != 1 {
+		t.Fatalf("expected a single sequence, got %d", len(ds.Sequences))
+	}
+
+	sequence := ds.Sequences[0]
+
+	if !slices.Equal(sequence.MovieIds, []int32{0, 1, 2, 3, 4, 5}) || sequence.TrainEnd != 4 || sequence.ValidationEnd != 5 {
+		t.Fatalf("unexpected sequence %#v", sequence)
+	}
+
+	train := ds.Windows("train")
+	if len(train) != 3 || !slices.Equal(train[2].Inputs, []int32{1, 2}) || train[2].Target != 3 {
+		t.Fatalf("unexpected train windows %#v", train)
+	}
+
+	test := ds.Windows("test")
+	if len(test) != 1 || !slices.Equal(test[0].Inputs, []int32{3, 4}) || test[0].Target != 5 {
+		t.Fatalf("unexpected test windows %#v", test)
+	}
+
+	// A user with too few movies is only trained on
+	activities, encoding = newActivities("/karsten/", 2)
+
+	ds, err = Build(activities, encoding, Options{Strategy: LeaveLastOut, LeaveOut: 1, BlockSize: 2, Stride: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ds.Sequences[0].TrainEnd != 2 || len(ds.Windows("test")) != 0 {
+		t.Fatalf("expected every movie to be trained on, got %#v", ds.Sequences[0])
+	}
+}
+
+func TestTimeCutoff(t *testing.T) {
+	activities, encoding := newActivities("/karsten/", 10)
+
+	opts := Options{
+		Strategy:         TimeCutoff,
+		ValidationCutoff: time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC),
+		TestCutoff:       time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC),
+		BlockSize:        16,
+		Stride:           2,
+	}
+
+	ds, err := Build(activities, encoding, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sequence := ds.Sequences[0]; sequence.TrainEnd != 4 || sequence.ValidationEnd != 7 {
+		t.Fatalf("unexpected split %#v", sequence)
+	}
+
+	// Every other movie of the train is a target
+	train := ds.Windows("train")
+	if len(train) != 2 || train[0].Target != 1 || train[1].Target != 3 {
+		t.Fatalf("unexpected train windows %#v", train)
+	}
+
+	dir := t.TempDir()
+
+	manifest, err := ds.Write(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats := manifest.Splits["validation"]; stats.Users != 1 || stats.Movies != 3 || stats.Windows != 3 {
+		t.Fatalf("unexpected validation stats %#v", stats)
+	}
+
+	read, err := Read(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if read.Options.Strategy != TimeCutoff || !read.Options.TestCutoff.Equal(opts.TestCutoff) || read.Movies != 10 {
+		t.Fatalf("unexpected dataset %#v", read)
+	}
+
+	if !slices.Equal(read.Sequences[0].MovieIds, ds.Sequences[0].MovieIds) {
+		t.Fatalf("unexpected sequence %#v", read.Sequences[0])
+	}
+
+	windows, err := parquet.ReadFile[Window](dir + "/test.parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(windows) != 3 || len(windows[0].Inputs) != 7 {
+		t.Fatalf("unexpected test windows %#v", windows)
+	}
+
+	opts.TestCutoff = opts.ValidationCutoff.AddDate(0, 0, -1)
+
+	if _, err := Build(activities, encoding, opts); err == nil {
+		t.Fatal("expected an error for a test cutoff before the validation cutoff")
+	}
+}
@@ -0,0 +1,101 @@
+package dataset
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// The files written by [Dataset.Write], the windows of every split are written to [split].parquet.
+const (
+	ManifestFile  = "manifest.json"
+	SequencesFile = "sequences.parquet"
+)
+
+// Manifest describe a dataset written by [Dataset.Write].
+type Manifest struct {
+	CreatedAt time.Time `json:"created_at"`
+	Options   Options   `json:"options"`
+	Movies    int       `json:"movies"`
+	Users     int       `json:"users"`
+	// Splits are the number of users, movies and windows of every split
+	Splits map[string]SplitStats `json:"splits"`
+}
+
+type SplitStats struct {
+	// Users are the users with at least one movie in the split
+	Users int `json:"users"`
+	// Movies are the movies of the sequences in the split, a movie watched by several users is counted once per user
+	Movies  int    `json:"movies"`
+	Windows int    `json:"windows"`
+	File    string `json:"file"`
+}
+
+// Write write the sequences to dir/sequences.parquet, the windows of every split to dir/[split].parquet and the manifest
+// to dir/manifest.json, which is written last. It returns the manifest.
+func (d *Dataset) Write(dir string) (Manifest, error) {
+	manifest := Manifest{
+		CreatedAt: time.Now().UTC(),
+		Options:   d.Options,
+		Movies:    d.Movies,
+		Users:     len(d.Sequences),
+		Splits:    map[string]SplitStats{},
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return manifest, err
+	}
+
+	if err := parquet.WriteFile(path.Join(dir, SequencesFile), d.Sequences); err != nil {
+		return manifest, err
+	}
+
+	for _, split := range Splits {
+		windows := d.Windows(split)
+		stats := SplitStats{Windows: len(windows), File: split + ".parquet"}
+
+		for _, sequence := range d.Sequences {
+			if start, end := sequence.Bounds(split); end > start {
+				stats.Users++
+				stats.Movies += end - start
+			}
+		}
+
+		if err := parquet.WriteFile(path.Join(dir, stats.File), windows); err != nil {
+			return manifest, err
+		}
+
+		manifest.Splits[split] = stats
+	}
+
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, err
+	}
+
+	return manifest, os.WriteFile(path.Join(dir, ManifestFile), content, 0644)
+}
+
+// Read read the dataset written to dir by [Dataset.Write], the windows are made again from the sequences when needed.
+func Read(dir string) (*Dataset, error) {
+	content, err := os.ReadFile(path.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, err
+	}
+
+	sequences, err := parquet.ReadFile[Sequence](path.Join(dir, SequencesFile))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Dataset{Options: manifest.Options, Sequences: sequences, Movies: manifest.Movies}, nil
+}
@@ -0,0 +1,247 @@
+package evaluate
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/leminhohoho/movie-lens/scraper/pkg/dataset"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/features"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/recommend"
+)
+
+// Buckets are the levels of activity of the users, by the number of movies they watched before the evaluated split.
+var Buckets = []Bucket{
+	{Name: "1-9", Min: 1, Max: 9},
+	{Name: "10-49", Min: 10, Max: 49},
+	{Name: "50-199", Min: 50, Max: 199},
+	{Name: "200+", Min: 200, Max: math.MaxInt},
+}
+
+type Bucket struct {
+	Name string
+	Min  int
+	Max  int
+}
+
+// Metrics are the averages of the metrics over the evaluated users.
+type Metrics struct {
+	Users     int     `json:"users"`
+	Recall    float64 `json:"recall"`
+	Precision float64 `json:"precision"`
+	NDCG      float64 `json:"ndcg"`
+	MRR       float64 `json:"mrr"`
+	// Coverage is the share of the movies of the training those are recommended to at least one user
+	Coverage float64 `json:"coverage"`
+	// Novelty is the average self-information -log2(share of the users of the movie) of the recommended movies
+	Novelty float64 `json:"novelty"`
+	// PopularityBias is the average share of the users of the recommended movies
+	PopularityBias float64 `json:"popularity_bias"`
+}
+
+// Report is the evaluation of a recommender on a split of a dataset.
+type Report struct {
+	Model   string             `json:"model"`
+	Split   string             `json:"split"`
+	K       int                `json:"k"`
+	Overall Metrics            `json:"overall"`
+	Buckets map[string]Metrics `json:"buckets"`
+}
+
+// Split is a split of a dataset ready to be evaluated: the history of every user and the movies to recommend.
+type Split struct {
+	Name  string
+	Users []User
+	// Train are the activities of the histories, the recommenders are trained on them
+	Train []features.Activity
+}
+
+// User is a user with the movies watched before the split, the oldest first, and the movies watched during the split.
+type User struct {
+	Url     string
+	History []string
+	Targets []string
+}
+
+// NewSplit make the split of the given name from the dataset. The history of a user is every movie before the split,
+// e.g. the train and the validation for the test. The activities are kept if they are on a movie of the history of
+// their user and before the first movie of the split, so nothing after the split start is trained on.
+func NewSplit(ds *dataset.Dataset, encoding *features.Encoding, activities []features.Activity, name string) (*Split, error) {
+	if name != "validation" && name != "test" {
+		return nil, fmt.Errorf("unknown split %s, expected validation or test", name)
+	}
+
+	if ds.Movies > encoding.Movies.Len() {
+		return nil, fmt.Errorf("the dataset has %d movies but the encoding %d, it was built with another encoding", ds.Movies, encoding.Movies.Len())
+	}
+
+	split := &Split{Name: name}
+
+	type history struct {
+		movies map[string]bool
+		// end is the Unix time of the first movie of the split, the activities after it are not trained on
+		end int64
+	}
+
+	histories := map[string]history{}
+
+	for _, sequence := range ds.Sequences {
+		if int(sequence.UserId) >= encoding.Users.Len() {
+			return nil, fmt.Errorf("the user %d of the dataset is not in the encoding, it was built with another encoding", sequence.UserId)
+		}
+
+		start, end := sequence.Bounds(name)
+		userUrl := encoding.Users.Keys[sequence.UserId]
+
+		h := history{movies: map[string]bool{}, end: math.MaxInt64}
+		if start < len(sequence.Timestamps) {
+			h.end = sequence.Timestamps[start]
+		}
+
+		user := User{Url: userUrl}
+
+		for i, movieId := range sequence.MovieIds[:end] {
+			url := encoding.Movies.Keys[movieId]
+
+			if i < start {
+				user.History = append(user.History, url)
+				h.movies[url] = true
+			} else {
+				user.Targets = append(user.Targets, url)
+			}
+		}
+
+		histories[userUrl] = h
+
+		if len(user.Targets) > 0 && len(user.History) > 0 {
+			split.Users = append(split.Users, user)
+		}
+	}
+
+	for _, activity := range activities {
+		h, ok := histories[activity.UserUrl]
+		if ok && h.movies[activity.MovieUrl] && activity.Date.Unix() <= h.end {
+			split.Train = append(split.Train, activity)
+		}
+	}
+
+	return split, nil
+}
+
+// Evaluate recommend k movies to every user of the split given its history and compare them with its targets.
+// interactions are the interactions the recommender is trained on, they give the popularity of the movies.
+func Evaluate(recommender recommend.Recommender, interactions *recommend.Interactions, split *Split, k int) Report {
+	report := Report{Split: split.Name, K: k, Buckets: map[string]Metrics{}}
+
+	overall := newAccumulator(interactions)
+	buckets := make([]*accumulator, len(Buckets))
+	for i := range buckets {
+		buckets[i] = newAccumulator(interactions)
+	}
+
+	for _, user := range split.Users {
+		recommendations := recommender.Recommend(user.History, k)
+
+		overall.add(recommendations, user.Targets, k)
+
+		for i, bucket := range Buckets {
+			if len(user.History) >= bucket.Min && len(user.History) <= bucket.Max {
+				buckets[i].add(recommendations, user.Targets, k)
+			}
+		}
+	}
+
+	report.Overall = overall.metrics()
+	for i, bucket := range Buckets {
+		report.Buckets[bucket.Name] = buckets[i].metrics()
+	}
+
+	return report
+}
+
+// accumulator sum the metrics of the users, the coverage and the popularity are about the movies of the training.
+type accumulator struct {
+	interactions *recommend.Interactions
+	sums         Metrics
+	// recommendations is the number of recommended movies, the novelty and the popularity bias are averaged over them
+	recommendations int
+	recommended     map[string]bool
+}
+
+func newAccumulator(interactions *recommend.Interactions) *accumulator {
+	return &accumulator{interactions: interactions, recommended: map[string]bool{}}
+}
+
+func (a *accumulator) add(recommendations []recommend.Recommendation, targets []string, k int) {
+	isTarget := make(map[string]bool, len(targets))
+	for _, target := range targets {
+		isTarget[target] = true
+	}
+
+	var hits, dcg, idcg, reciprocalRank float64
+
+	for i, recommendation := range recommendations {
+		a.recommended[recommendation.Url] = true
+		a.recommendations++
+
+		share := a.share(recommendation.Url)
+		a.sums.Novelty += -math.Log2(share)
+		a.sums.PopularityBias += share
+
+		if !isTarget[recommendation.Url] {
+			continue
+		}
+
+		hits++
+		dcg += 1 / math.Log2(float64(i+2))
+
+		if reciprocalRank == 0 {
+			reciprocalRank = 1 / float64(i+1)
+		}
+	}
+
+	for i := range min(len(targets), k) {
+		idcg += 1 / math.Log2(float64(i+2))
+	}
+
+	a.sums.Users++
+	a.sums.Recall += hits / float64(len(targets))
+	a.sums.Precision += hits / float64(k)
+	a.sums.NDCG += dcg / idcg
+	a.sums.MRR += reciprocalRank
+}
+
+// share return the share of the users of the training who interacted with the movie, the movies no one interacted with
+// count as one user so their novelty is finite.
+func (a *accumulator) share(url string) float64 {
+	users := max(a.interactions.Users.Len(), 1)
+
+	id, ok := a.interactions.Movies.Id(url)
+	if !ok {
+		return 1 / float64(users)
+	}
+
+	return float64(max(len(a.interactions.ByMovie[id]), 1)) / float64(users)
+}
+
+func (a *accumulator) metrics() Metrics {
+	metrics := Metrics{Users: a.sums.Users}
+
+	if a.sums.Users > 0 {
+		n := float64(a.sums.Users)
+		metrics.Recall = a.sums.Recall / n
+		metrics.Precision = a.sums.Precision / n
+		metrics.NDCG = a.sums.NDCG / n
+		metrics.MRR = a.sums.MRR / n
+	}
+
+	if a.recommendations > 0 {
+		metrics.Novelty = a.sums.Novelty / float64(a.recommendations)
+		metrics.PopularityBias = a.sums.PopularityBias / float64(a.recommendations)
+	}
+
+	if movies := a.interactions.Movies.Len(); movies > 0 {
+		metrics.Coverage = float64(len(a.recommended)) / float64(movies)
+	}
+
+	return metrics
+}
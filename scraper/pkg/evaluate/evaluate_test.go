@@ -0,0 +1,127 @@
+package evaluate
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/leminhohoho/movie-lens/scraper/pkg/dataset"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/features"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/recommend"
+)
+
+// fixed recommend the same movies to every user.
+type fixed []string
+
+func (f fixed) Recommend(watched []string, k int) []recommend.Recommendation {
+	var recommendations []recommend.Recommendation
+	for i, url := range f[:min(k, len(f))] {
+		recommendations = append(recommendations, recommend.Recommendation{Url: url, Score: float64(len(f) - i)})
+	}
+
+	return recommendations
+}
+
+func TestNewSplit(t *testing.T) {
+	encoding := features.NewEncoding()
+	encoding.Users.Add("/karsten/")
+
+	var activities []features.Activity
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := range 5 {
+		url := fmt.Sprintf("/film/%d/", i)
+		encoding.Movies.Add(url)
+		activities = append(activities, features.Activity{UserUrl: "/karsten/", MovieUrl: url, Date: start.AddDate(0, 0, i)})
+	}
+
+	// Rating a movie of the history after the split start leaks the future, it is not trained on
+	activities = append(activities, features.Activity{UserUrl: "/karsten/", MovieUrl: "/film/0/", Date: start.AddDate(0, 1, 0)})
+
+	ds, err := dataset.Build(activities, encoding, dataset.Options{Strategy: dataset.LeaveLastOut, LeaveOut: 1, BlockSize: 4, Stride: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	split, err := NewSplit(ds, encoding, activities, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(split.Users) != 1 || len(split.Users[0].History) != 4 || !slices.Equal(split.Users[0].Targets, []string{"/film/4/"}) {
+		t.Fatalf("unexpected users %#v", split.Users)
+	}
+
+	if len(split.Train) != 4 {
+		t.Fatalf("expected the 4 first activities to be trained on, got %#v", split.Train)
+	}
+
+	split, err = NewSplit(ds, encoding, activities, "validation")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(split.Users[0].History) != 3 || !slices.Equal(split.Users[0].Targets, []string{"/film/3/"}) || len(split.Train) != 3 {
+		t.Fatalf("unexpected validation split %#v", split)
+	}
+
+	if _, err := NewSplit(ds, encoding, activities, "train"); err == nil {
+		t.Fatal("expected an error for the train split")
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	var activities []features.Activity
+	for user, movies := range map[string][]string{"/a/": {"/film/1/", "/film/2/"}, "/b/": {"/film/1/"}} {
+		for _, movie := range movies {
+			activities = append(activities, features.Activity{UserUrl: user, MovieUrl: movie})
+		}
+	}
+
+	interactions := recommend.NewInteractions(activities)
+
+	split := &Split{Name: "test", Users: []User{
+		// The second recommendation is a hit
+		{Url: "/a/", History: []string{"/film/0/"}, Targets: []string{"/film/2/", "/film/3/"}},
+		// No hit
+		{Url: "/b/", History: make([]string, 20), Targets: []string{"/film/3/"}},
+	}}
+
+	report := Evaluate(fixed{"/film/1/", "/film/2/"}, interactions, split, 2)
+
+	expected := Metrics{
+		Users:     2,
+		Recall:    0.25,
+		Precision: 0.25,
+		NDCG:      (1 / math.Log2(3)) / (1 + 1/math.Log2(3)) / 2,
+		MRR:       0.25,
+		Coverage:  1,
+		// Every user watched the first movie and half the second
+		Novelty:        0.5,
+		PopularityBias: 0.75,
+	}
+
+	if !closeMetrics(report.Overall, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, report.Overall)
+	}
+
+	if report.Buckets["1-9"].Users != 1 || report.Buckets["10-49"].Users != 1 || report.Buckets["10-49"].Recall != 0 {
+		t.Fatalf("unexpected buckets %#v", report.Buckets)
+	}
+}
+
+func closeMetrics(a Metrics, b Metrics) bool {
+	values := func(m Metrics) []float64 {
+		return []float64{float64(m.Users), m.Recall, m.Precision, m.NDCG, m.MRR, m.Coverage, m.Novelty, m.PopularityBias}
+	}
+
+	for i, value := range values(a) {
+		if math.Abs(value-values(b)[i]) > 1e-9 {
+			return false
+		}
+	}
+
+	return true
+}
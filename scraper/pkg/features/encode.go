@@ -0,0 +1,294 @@
+package features
+
+import (
+	"cmp"
+	"errors"
+	"math"
+	"os"
+	"path"
+	"slices"
+
+	"github.com/parquet-go/parquet-go"
+	"gorm.io/gorm"
+)
+
+// The files written by [Encode]. They are not the encoded_movies_2.parquet and encoded_activities_2.parquet read by
+// ml/notebooks/model_dev.ipynb: the movies are multi-hot encoded rather than embedded with SBERT and the activities
+// which aren't rated are kept, so they are named apart and can't be fed to the notebook as is. The columns those are
+// in both (e.g. enc_year, enc_hour) are scaled like in ml/notebooks/feature engineering 01.ipynb.
+const (
+	EncodingFile   = "encoding.json"
+	MoviesFile     = "multihot_movies.parquet"
+	ActivitiesFile = "multihot_activities.parquet"
+)
+
+// EncodedMovie is a movie encoded as numbers, its id is the id given by the [Encoding].
+type EncodedMovie struct {
+	Id   int    `parquet:"id"`
+	Name string `parquet:"name"`
+	// Duration is tanh(log10(minutes)), it is 0 if the duration is unknown
+	Duration float32 `parquet:"duration"`
+	// EncYear, EncMonth and EncDay are the parts of the release date scaled to [0, 1], they are 0 if the date is unknown
+	EncYear   float32   `parquet:"enc_year"`
+	EncMonth  float32   `parquet:"enc_month"`
+	EncDay    float32   `parquet:"enc_day"`
+	Genres    []float32 `parquet:"genres,list"`
+	Themes    []float32 `parquet:"themes,list"`
+	Studios   []float32 `parquet:"studios,list"`
+	Countries []float32 `parquet:"countries,list"`
+	Languages []float32 `parquet:"languages,list"`
+}
+
+// EncodedActivity is an activity encoded as numbers, the user and the movie ids are the ids given by the [Encoding].
+type EncodedActivity struct {
+	UserId  int `parquet:"user_id"`
+	MovieId int `parquet:"movie_id"`
+	// Rating is the rating scaled to [0, 1], it is -1 if the movie is not rated
+	Rating  float32 `parquet:"rating"`
+	IsLoved float32 `parquet:"is_loved"`
+	// EncYear to EncMinute are the parts of the date of the activity scaled to [0, 1], but the hour which is divided by
+	// 31 like in the notebook
+	EncYear       float32 `parquet:"enc_year"`
+	EncMonth      float32 `parquet:"enc_month"`
+	EncDay        float32 `parquet:"enc_day"`
+	EncHour       float32 `parquet:"enc_hour"`
+	EncMinute     float32 `parquet:"enc_minute"`
+	RatingMissing float32 `parquet:"rating_missing"`
+}
+
+// Summary is the size of an encoded dataset.
+type Summary struct {
+	Movies     int
+	Users      int
+	Activities int
+	// Vocabularies are the number of tokens of every vocabulary, [Unknown] included
+	Vocabularies map[string]int
+}
+
+// Encode read the movies and the activities of db and write them encoded to dir/multihot_movies.parquet and
+// dir/multihot_activities.parquet. The encoding of the previous run is read from dir/encoding.json and saved back with
+// the new users, movies and tokens, the tokens are added to the vocabularies once they appear in at least minFreq movies.
+func Encode(db *gorm.DB, dir string, minFreq int) (Summary, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return Summary{}, err
+	}
+
+	// The first encode of dir starts from a new encoding
+	encoding, err := LoadEncoding(path.Join(dir, EncodingFile))
+	if errors.Is(err, ErrNoEncoding) {
+		encoding, err = NewEncoding(), nil
+	}
+
+	if err != nil {
+		return Summary{}, err
+	}
+
+	movies, err := LoadMovies(db)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	activities, err := LoadActivities(db)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	encodedMovies := encoding.EncodeMovies(movies, minFreq)
+	encodedActivities := encoding.EncodeActivities(activities)
+
+	if err := parquet.WriteFile(path.Join(dir, MoviesFile), encodedMovies); err != nil {
+		return Summary{}, err
+	}
+
+	if err := parquet.WriteFile(path.Join(dir, ActivitiesFile), encodedActivities); err != nil {
+		return Summary{}, err
+	}
+
+	// The encoding is saved last, the ids it gives are always the ones of the files
+	if err := encoding.Save(path.Join(dir, EncodingFile)); err != nil {
+		return Summary{}, err
+	}
+
+	summary := Summary{
+		Movies:       len(encodedMovies),
+		Users:        encoding.Users.Len(),
+		Activities:   len(encodedActivities),
+		Vocabularies: map[string]int{},
+	}
+
+	for field, vocabulary := range encoding.Vocabularies {
+		summary.Vocabularies[field] = vocabulary.Len()
+	}
+
+	return summary, nil
+}
+
+// EncodeMovies extend the vocabularies with the tokens of movies and encode them, the movies are given an id if they
+// don't have one yet. The encoded movies are ordered by id.
+func (e *Encoding) EncodeMovies(movies []Movie, minFreq int) []EncodedMovie {
+	for _, field := range Fields {
+		counts := map[string]int{}
+
+		for _, movie := range movies {
+			for _, token := range movieTokens(movie, field) {
+				counts[token]++
+			}
+		}
+
+		e.Vocabularies[field].Extend(counts, minFreq)
+	}
+
+	encoded := make([]EncodedMovie, 0, len(movies))
+	ids := map[int]int{}
+
+	for _, movie := range movies {
+		row := e.EncodeMovie(movie)
+		ids[row.Id] = len(encoded)
+		encoded = append(encoded, row)
+	}
+
+	// The movies are ordered by id, so the row of a movie is its id when every movie of the encoding is in the db
+	ordered := make([]EncodedMovie, 0, len(encoded))
+	for id := range e.Movies.Len() {
+		if i, ok := ids[id]; ok {
+			ordered = append(ordered, encoded[i])
+		}
+	}
+
+	return ordered
+}
+
+// EncodeMovie encode a single movie without extending the vocabularies, its tokens those are not in the vocabularies
+// are unknown. The movie is given an id if it doesn't have one yet.
+// The movies scraped after the last [Encode] (e.g. to be added to the movie index) are encoded with it, their vectors
+// have the same size as the encoded ones.
+func (e *Encoding) EncodeMovie(movie Movie) EncodedMovie {
+	row := EncodedMovie{
+		Id:        e.Movies.Add(movie.Url),
+		Name:      movie.Name,
+		Genres:    e.Vocabularies["genres"].MultiHot(movie.Genres),
+		Themes:    e.Vocabularies["themes"].MultiHot(movie.Themes),
+		Studios:   e.Vocabularies["studios"].MultiHot(movie.Studios),
+		Countries: e.Vocabularies["countries"].MultiHot(movie.Countries),
+		Languages: e.Vocabularies["languages"].MultiHot(movie.Languages),
+	}
+
+	if movie.Duration != nil && *movie.Duration > 0 {
+		row.Duration = EncodeDuration(*movie.Duration)
+	}
+
+	if !movie.ReleaseDate.IsZero() {
+		row.EncYear = float32(movie.ReleaseDate.Year()) / 3000
+		row.EncMonth = float32(movie.ReleaseDate.Month()) / 12
+		row.EncDay = float32(movie.ReleaseDate.Day()) / 31
+	}
+
+	return row
+}
+
+// EncodeActivities encode the activities, the users are given an id if they don't have one yet.
+// The activities without a date and the ones of a movie without an id are skipped, the others are ordered by user and date,
+// which make the sequence of activities of every user. [Encoding.EncodeMovies] must be called first.
+func (e *Encoding) EncodeActivities(activities []Activity) []EncodedActivity {
+	type activity struct {
+		EncodedActivity
+		date int64
+	}
+
+	byUser := map[int][]activity{}
+
+	for _, a := range activities {
+		movieId, ok := e.Movies.Id(a.MovieUrl)
+		if !ok || a.Date.IsZero() {
+			continue
+		}
+
+		userId := e.Users.Add(a.UserUrl)
+
+		row := EncodedActivity{
+			UserId:    userId,
+			MovieId:   movieId,
+			Rating:    -1,
+			EncYear:   float32(a.Date.Year()) / 3000,
+			EncMonth:  float32(a.Date.Month()) / 12,
+			EncDay:    float32(a.Date.Day()) / 31,
+			EncHour:   float32(a.Date.Hour()) / 31,
+			EncMinute: float32(a.Date.Minute()) / 60,
+		}
+
+		if a.Rating != nil {
+			row.Rating = *a.Rating / 5
+		} else {
+			row.RatingMissing = 1
+		}
+
+		if a.IsLoved {
+			row.IsLoved = 1
+		}
+
+		byUser[userId] = append(byUser[userId], activity{EncodedActivity: row, date: a.Date.Unix()})
+	}
+
+	encoded := make([]EncodedActivity, 0, len(activities))
+
+	for userId := range e.Users.Len() {
+		sequence := byUser[userId]
+
+		// The activities of a user are already ordered by date, the sort only break the ties the same way on every run
+		slices.SortStableFunc(sequence, func(a, b activity) int {
+			if a.date != b.date {
+				return cmp.Compare(a.date, b.date)
+			}
+
+			return cmp.Compare(a.MovieId, b.MovieId)
+		})
+
+		for _, a := range sequence {
+			encoded = append(encoded, a.EncodedActivity)
+		}
+	}
+
+	return encoded
+}
+
+// Vector return the features of the movie in the order of the columns, without the id and the name.
+// It is the row of the movie in the matrix of the encoded movies (e.g. for the movie index).
+func (m EncodedMovie) Vector() []float32 {
+	vector := []float32{m.Duration, m.EncYear, m.EncMonth, m.EncDay}
+	for _, hot := range [][]float32{m.Genres, m.Themes, m.Studios, m.Countries, m.Languages} {
+		vector = append(vector, hot...)
+	}
+
+	return vector
+}
+
+// ActivityColumns are the columns of the vector of an activity, in order. A model trained on the encoded activities is
+// exported with them, so that it is only fed activities of the same layout.
+var ActivityColumns = []string{"rating", "is_loved", "enc_year", "enc_month", "enc_day", "enc_hour", "enc_minute", "rating_missing"}
+
+// Vector return the features of the activity in the order of the columns, without the user and the movie ids.
+func (a EncodedActivity) Vector() []float32 {
+	return []float32{a.Rating, a.IsLoved, a.EncYear, a.EncMonth, a.EncDay, a.EncHour, a.EncMinute, a.RatingMissing}
+}
+
+// EncodeDuration scale the duration of a movie in minutes the way the notebooks do, it must be positive.
+func EncodeDuration(minutes int) float32 {
+	return float32(math.Tanh(math.Log10(float64(minutes))))
+}
+
+func movieTokens(movie Movie, field string) []string {
+	switch field {
+	case "genres":
+		return movie.Genres
+	case "themes":
+		return movie.Themes
+	case "studios":
+		return movie.Studios
+	case "countries":
+		return movie.Countries
+	case "languages":
+		return movie.Languages
+	default:
+		return nil
+	}
+}
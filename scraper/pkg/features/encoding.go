@@ -0,0 +1,187 @@
+package features
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/leminhohoho/movie-lens/scraper/pkg/utils"
+)
+
+// Unknown is the token of the vocabularies those stands for every token under the min frequency, its id is always 0.
+const Unknown = "<unk>"
+
+// Fields are the names of the movie fields those are encoded as multi-hot vectors.
+var Fields = []string{"genres", "themes", "studios", "countries", "languages"}
+
+// Index assign a dense id to every key (e.g. the url of a movie), in the order they are added.
+// The ids never change once assigned, so the ids of a dataset rebuilt with the same index are stable.
+type Index struct {
+	Keys []string `json:"keys"`
+	ids  map[string]int
+}
+
+// NewIndex return the index of the given keys, the id of a key is its position.
+func NewIndex(keys []string) Index {
+	x := Index{Keys: keys}
+	x.Id("")
+
+	return x
+}
+
+// UnmarshalJSON read the keys of the index and give them their ids at once, so the ids are never written by the readers.
+func (x *Index) UnmarshalJSON(data []byte) error {
+	var keys struct {
+		Keys []string `json:"keys"`
+	}
+
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+
+	*x = NewIndex(keys.Keys)
+
+	return nil
+}
+
+// Id return the id of key, and whether key is in the index.
+// It is safe for concurrent use once a key is added or the index is made by [NewIndex] or read from JSON.
+func (x *Index) Id(key string) (int, bool) {
+	if x.ids == nil {
+		x.ids = make(map[string]int, len(x.Keys))
+		for i, k := range x.Keys {
+			x.ids[k] = i
+		}
+	}
+
+	id, ok := x.ids[key]
+
+	return id, ok
+}
+
+// Add return the id of key, key is given the next id if it is not in the index yet.
+func (x *Index) Add(key string) int {
+	if id, ok := x.Id(key); ok {
+		return id
+	}
+
+	x.Keys = append(x.Keys, key)
+	x.ids[key] = len(x.Keys) - 1
+
+	return len(x.Keys) - 1
+}
+
+// Len return the number of keys of the index.
+func (x *Index) Len() int {
+	return len(x.Keys)
+}
+
+// Vocabulary is the index of the tokens of a field (e.g. the genres), its first token is always [Unknown].
+type Vocabulary struct {
+	Index
+}
+
+func NewVocabulary() *Vocabulary {
+	return &Vocabulary{Index: Index{Keys: []string{Unknown}}}
+}
+
+// Extend add the tokens those appear at least minFreq times and are not in the vocabulary yet, the most frequent first.
+// The tokens already in the vocabulary are kept even if they are now under minFreq. It returns the number of tokens added.
+func (v *Vocabulary) Extend(counts map[string]int, minFreq int) int {
+	var tokens []string
+
+	for token, count := range counts {
+		if _, ok := v.Id(token); !ok && count >= minFreq {
+			tokens = append(tokens, token)
+		}
+	}
+
+	slices.SortFunc(tokens, func(a, b string) int {
+		if counts[a] != counts[b] {
+			return counts[b] - counts[a]
+		}
+
+		if a < b {
+			return -1
+		}
+
+		return 1
+	})
+
+	for _, token := range tokens {
+		v.Add(token)
+	}
+
+	return len(tokens)
+}
+
+// Lookup return the id of token, or the id of [Unknown] if token is not in the vocabulary.
+func (v *Vocabulary) Lookup(token string) int {
+	id, _ := v.Id(token)
+	return id
+}
+
+// MultiHot return a vector of the size of the vocabulary with a 1 at the id of every token.
+func (v *Vocabulary) MultiHot(tokens []string) []float32 {
+	vector := make([]float32, v.Len())
+	for _, token := range tokens {
+		vector[v.Lookup(token)] = 1
+	}
+
+	return vector
+}
+
+// Encoding is the state of the encoder those is persisted between the runs: the ids of the users, the movies and the tokens.
+// The users and the movies are keyed by url, the ids stay the same even if the db is rebuilt or moved to another backend.
+type Encoding struct {
+	Users        Index                  `json:"users"`
+	Movies       Index                  `json:"movies"`
+	Vocabularies map[string]*Vocabulary `json:"vocabularies"`
+}
+
+func NewEncoding() *Encoding {
+	encoding := &Encoding{Vocabularies: map[string]*Vocabulary{}}
+	for _, field := range Fields {
+		encoding.Vocabularies[field] = NewVocabulary()
+	}
+
+	return encoding
+}
+
+// ErrNoEncoding is returned by [LoadEncoding] if there is no encoding at the given path, the encoding is written by
+// the encode command.
+var ErrNoEncoding = errors.New("encoding not found, run encode first")
+
+// LoadEncoding read the encoding saved at filePath, it returns [ErrNoEncoding] if the file doesn't exist.
+func LoadEncoding(filePath string) (*Encoding, error) {
+	content, err := os.ReadFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", filePath, ErrNoEncoding)
+	} else if err != nil {
+		return nil, err
+	}
+
+	encoding := NewEncoding()
+
+	if err := json.Unmarshal(content, encoding); err != nil {
+		return nil, err
+	}
+
+	return encoding, nil
+}
+
+// Save write the encoding to filePath, the previous file is replaced at once.
+func (e *Encoding) Save(filePath string) error {
+	content, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteFileAtomic(filePath, func(w io.Writer) error {
+		_, err := w.Write(content)
+		return err
+	})
+}
@@ -0,0 +1,174 @@
+package features
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/leminhohoho/movie-lens/scraper/pkg/models"
+	"gorm.io/gorm"
+)
+
+// releaseDateLayout is the layout of the release dates scraped from the releases tab of a movie.
+const releaseDateLayout = "02 Jan 2006"
+
+// Movie is a movie with the names of everything it is related to, the names are lowercase and sorted.
+type Movie struct {
+	models.Movie
+	// ReleaseDate is the earliest release of the movie, it is zero if none of the release dates can be parsed
+	ReleaseDate time.Time
+	Genres      []string
+	Themes      []string
+	Studios     []string
+	Countries   []string
+	Languages   []string
+	// Directors and Actors are the urls of the crews of the movie (e.g. /director/denis-villeneuve/), they are urls
+	// rather than names since two people can share a name
+	Directors []string
+	Actors    []string
+}
+
+// Activity is an activity of a user on a movie, the user and the movie are identified by their url.
+type Activity struct {
+	UserUrl  string
+	MovieUrl string
+	// Date is zero if the date of the activity can't be parsed
+	Date    time.Time
+	IsWatch bool
+	Rating  *float32
+	IsLoved bool
+}
+
+// LoadMovies read the movies of the given ids, or every movie of the db if no id is given, ordered by id.
+func LoadMovies(db *gorm.DB, ids ...int) ([]Movie, error) {
+	var movies []models.Movie
+
+	query := db.Table("movies").Order("id")
+	if len(ids) > 0 {
+		query = query.Where("id IN ?", ids)
+	}
+
+	if err := query.Find(&movies).Error; err != nil {
+		return nil, err
+	}
+
+	related := map[string]map[int][]string{}
+
+	for name, query := range map[string]*gorm.DB{
+		"genres": db.Table("genres_and_movies").Select("movie_id, genres.name").
+			Joins("JOIN genres ON genres.id = genre_id"),
+		"themes": db.Table("themes_and_movies").Select("movie_id, themes.name").
+			Joins("JOIN themes ON themes.id = theme_id"),
+		"studios": db.Table("studios_and_movies").Select("movie_id, studios.name").
+			Joins("JOIN studios ON studios.id = studio_id"),
+		"countries": db.Table("countries_and_movies").Select("movie_id, country AS name"),
+		"languages": db.Table("languages_and_movies").Select("movie_id, language AS name"),
+		"releases":  db.Table("releases").Select("movie_id, date AS name"),
+		"directors": db.Table("crews_and_movies").Select("movie_id, crews.url AS name").
+			Joins("JOIN crews ON crews.id = crew_id").Where("crews.role IN ?", []string{"Director", "Directors"}),
+		"actors": db.Table("crews_and_movies").Select("movie_id, crews.url AS name").
+			Joins("JOIN crews ON crews.id = crew_id").Where("crews.role = ?", "Actor"),
+	} {
+		if len(ids) > 0 {
+			query = query.Where("movie_id IN ?", ids)
+		}
+
+		var rows []struct {
+			MovieId int
+			Name    string
+		}
+
+		if err := query.Find(&rows).Error; err != nil {
+			return nil, err
+		}
+
+		related[name] = map[int][]string{}
+		for _, row := range rows {
+			related[name][row.MovieId] = append(related[name][row.MovieId], row.Name)
+		}
+	}
+
+	result := make([]Movie, len(movies))
+
+	for i, movie := range movies {
+		result[i] = Movie{
+			Movie:     movie,
+			Genres:    normalizeNames(related["genres"][movie.Id]),
+			Themes:    normalizeNames(related["themes"][movie.Id]),
+			Studios:   normalizeNames(related["studios"][movie.Id]),
+			Countries: normalizeNames(related["countries"][movie.Id]),
+			Languages: normalizeNames(related["languages"][movie.Id]),
+			Directors: normalizeNames(related["directors"][movie.Id]),
+			Actors:    normalizeNames(related["actors"][movie.Id]),
+		}
+
+		for _, date := range related["releases"][movie.Id] {
+			d, err := time.Parse(releaseDateLayout, strings.TrimSpace(date))
+			if err == nil && (result[i].ReleaseDate.IsZero() || d.Before(result[i].ReleaseDate)) {
+				result[i].ReleaseDate = d
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// LoadActivities read every activity of the db, ordered by user and date.
+func LoadActivities(db *gorm.DB) ([]Activity, error) {
+	var rows []struct {
+		models.UserAndMovie
+		UserUrl  string
+		MovieUrl string
+	}
+
+	if err := db.Table("users_and_movies").
+		Select("users_and_movies.*, users.url AS user_url, movies.url AS movie_url").
+		Joins("JOIN users ON users.id = users_and_movies.user_id").
+		Joins("JOIN movies ON movies.id = users_and_movies.movie_id").
+		Order("users_and_movies.user_id, users_and_movies.date").
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	activities := make([]Activity, len(rows))
+
+	for i, row := range rows {
+		activities[i] = Activity{
+			UserUrl:  row.UserUrl,
+			MovieUrl: row.MovieUrl,
+			Date:     ParseActivityDate(row.Date),
+			IsWatch:  row.IsWatch,
+			Rating:   row.Rating,
+			IsLoved:  row.IsLoved,
+		}
+	}
+
+	return activities, nil
+}
+
+// ParseActivityDate parse the date of an activity (e.g. 2024-03-01T18:40:00.123Z), it returns zero if the date can't be parsed.
+func ParseActivityDate(date string) time.Time {
+	// Letterboxd may add milliseconds to the activity dates, they are dropped
+	if len(date) < 19 {
+		return time.Time{}
+	}
+
+	t, err := time.Parse("2006-01-02T15:04:05", date[:19])
+	if err != nil {
+		return time.Time{}
+	}
+
+	return t
+}
+
+// normalizeNames lowercase the names, sort them and remove the duplicates (e.g. a language both primary and spoken).
+func normalizeNames(names []string) []string {
+	normalized := make([]string, len(names))
+	for i, name := range names {
+		normalized[i] = strings.ToLower(strings.TrimSpace(name))
+	}
+
+	slices.Sort(normalized)
+
+	return slices.Compact(normalized)
+}
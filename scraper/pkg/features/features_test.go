@@ -0,0 +1,201 @@
+package features
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"path"
+	"slices"
+	"testing"
+
+	"github.com/leminhohoho/movie-lens/scraper/pkg/models"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/storage"
+	"github.com/parquet-go/parquet-go"
+)
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func saveMovie(t *testing.T, store storage.Storage, url string, duration int, genres ...string) {
+	details := &models.MovieDetails{
+		Movie:     models.Movie{Url: url, Name: url, Duration: &duration},
+		Countries: []models.CountriesAndMovies{{Country: "USA"}},
+		Releases:  []models.Release{{Date: "29 Mar 2024", Country: "USA", ReleaseType: "Theatrical"}},
+		Crews: []models.Crew{
+			{Url: "/director/denis-villeneuve/", Name: "Denis Villeneuve", Role: "Director"},
+			{Url: "/actor/zendaya/", Name: "Zendaya", Role: "Actor"},
+			{Url: "/writer/jon-spaihts/", Name: "Jon Spaihts", Role: "Writers"},
+		},
+	}
+
+	for _, genre := range genres {
+		details.Genres = append(details.Genres, models.Genre{Url: "/films/genre/" + genre + "/", Name: genre})
+	}
+
+	if _, err := store.SaveMovie(details); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := storage.Open(path.Join(dir, "letterboxd.db"), discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	saveMovie(t, store, "/film/dune/", 155, "Science Fiction", "Adventure")
+	saveMovie(t, store, "/film/dune-part-two/", 166, "Science Fiction", "Drama")
+
+	userIds, err := store.SaveUsers([]models.User{{Url: "/karsten/", Name: "Karsten"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dune, _ := store.MovieByUrl("/film/dune/")
+	duneTwo, _ := store.MovieByUrl("/film/dune-part-two/")
+	rating := float32(4.5)
+
+	if err := store.SaveActivities([]models.UserAndMovie{
+		{UserId: userIds["/karsten/"], MovieId: duneTwo.Id, Date: "2024-03-02T20:15:00.000Z", IsWatch: true, Rating: &rating},
+		{UserId: userIds["/karsten/"], MovieId: dune.Id, Date: "2021-10-22T18:00:00.000Z", IsWatch: true, IsLoved: true},
+		{UserId: userIds["/karsten/"], MovieId: dune.Id, Date: "not a date", IsWatch: true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	out := path.Join(dir, "encoded")
+
+	summary, err := Encode(store.DB(), out, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summary.Movies != 2 || summary.Users != 1 || summary.Activities != 2 {
+		t.Fatalf("unexpected summary %#v", summary)
+	}
+
+	// Only science fiction is in both movies, the other genres are unknown
+	if summary.Vocabularies["genres"] != 2 || summary.Vocabularies["countries"] != 2 {
+		t.Fatalf("unexpected vocabularies %#v", summary.Vocabularies)
+	}
+
+	movies, err := parquet.ReadFile[EncodedMovie](path.Join(out, MoviesFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if movies[0].Name != "/film/dune/" || !slices.Equal(movies[0].Genres, []float32{1, 1}) || movies[0].Duration != EncodeDuration(155) {
+		t.Fatalf("unexpected movie %#v", movies[0])
+	}
+
+	if movies[0].EncYear != float32(2024)/3000 || movies[0].EncMonth != float32(3)/12 {
+		t.Fatalf("unexpected release date of %#v", movies[0])
+	}
+
+	activities, err := parquet.ReadFile[EncodedActivity](path.Join(out, ActivitiesFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The activities are in the order of their dates
+	if activities[0].MovieId != 0 || activities[0].Rating != -1 || activities[0].RatingMissing != 1 || activities[0].IsLoved != 1 {
+		t.Fatalf("unexpected first activity %#v", activities[0])
+	}
+
+	if activities[1].MovieId != 1 || activities[1].Rating != 0.9 || activities[1].EncHour != float32(20)/31 {
+		t.Fatalf("unexpected second activity %#v", activities[1])
+	}
+
+	// A movie scraped after the first encoding gets the next id, the others keep theirs
+	saveMovie(t, store, "/film/arrival/", 116, "Drama", "Science Fiction")
+
+	if _, err := Encode(store.DB(), out, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	encoding, err := LoadEncoding(path.Join(out, EncodingFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadEncoding(path.Join(t.TempDir(), EncodingFile)); !errors.Is(err, ErrNoEncoding) {
+		t.Fatalf("expected no encoding in an empty dir, got %v", err)
+	}
+
+	if !slices.Equal(encoding.Movies.Keys, []string{"/film/dune/", "/film/dune-part-two/", "/film/arrival/"}) {
+		t.Fatalf("unexpected movie ids %v", encoding.Movies.Keys)
+	}
+
+	if !slices.Equal(encoding.Vocabularies["genres"].Keys, []string{Unknown, "science fiction", "drama"}) {
+		t.Fatalf("unexpected genres %v", encoding.Vocabularies["genres"].Keys)
+	}
+
+	loaded, err := LoadMovies(store.DB(), duneTwo.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(loaded) != 1 || loaded[0].Url != "/film/dune-part-two/" || !slices.Equal(loaded[0].Genres, []string{"drama", "science fiction"}) ||
+		!slices.Equal(loaded[0].Directors, []string{"/director/denis-villeneuve/"}) || !slices.Equal(loaded[0].Actors, []string{"/actor/zendaya/"}) {
+		t.Fatalf("unexpected movie %#v", loaded)
+	}
+}
+
+func TestVocabulary(t *testing.T) {
+	vocabulary := NewVocabulary()
+
+	if added := vocabulary.Extend(map[string]int{"drama": 3, "horror": 5, "western": 1}, 2); added != 2 {
+		t.Fatalf("expected 2 tokens to be added, got %d", added)
+	}
+
+	if !slices.Equal(vocabulary.Keys, []string{Unknown, "horror", "drama"}) {
+		t.Fatalf("expected the most frequent tokens first, got %v", vocabulary.Keys)
+	}
+
+	// A token under the min frequency keeps its id
+	vocabulary.Extend(map[string]int{"drama": 1, "western": 2}, 2)
+
+	if vocabulary.Lookup("drama") != 2 || vocabulary.Lookup("western") != 3 || vocabulary.Lookup("anime") != 0 {
+		t.Fatalf("unexpected ids %v", vocabulary.Keys)
+	}
+
+	if hot := vocabulary.MultiHot([]string{"western", "anime"}); !slices.Equal(hot, []float32{1, 0, 0, 1}) {
+		t.Fatalf("unexpected multi-hot vector %v", hot)
+	}
+}
+
+// TestNotebookColumns pin the columns of the encoded files against the ones of encoded_movies_2.parquet and
+// encoded_activities_2.parquet written by ml/notebooks/feature engineering 01.ipynb.
+func TestNotebookColumns(t *testing.T) {
+	columns := func(row any) []string {
+		var names []string
+		for _, field := range parquet.SchemaOf(row).Fields() {
+			names = append(names, field.Name())
+		}
+
+		return names
+	}
+
+	// The review is not encoded, the other columns of the notebook are in the same order
+	notebookActivities := []string{
+		"user_id", "movie_id", "rating", "is_loved", "review", "enc_year", "enc_month", "enc_day", "enc_hour", "enc_minute", "rating_missing",
+	}
+
+	if got := columns(EncodedActivity{}); !slices.Equal(got, slices.DeleteFunc(notebookActivities, func(c string) bool { return c == "review" })) {
+		t.Fatalf("unexpected activity columns %v", got)
+	}
+
+	if got := columns(EncodedActivity{})[2:]; !slices.Equal(got, ActivityColumns) || len(EncodedActivity{}.Vector()) != len(got) {
+		t.Fatalf("expected every activity column but the ids in the vector, got %v", got)
+	}
+
+	// The movies are multi-hot encoded in place of the names and the SBERT embeddings of the notebook, the scaled
+	// duration and release date are the same
+	if got := columns(EncodedMovie{}); !slices.Equal(got, []string{
+		"id", "name", "duration", "enc_year", "enc_month", "enc_day", "genres", "themes", "studios", "countries", "languages",
+	}) {
+		t.Fatalf("unexpected movie columns %v", got)
+	}
+}
@@ -5,25 +5,21 @@ import (
 	"log/slog"
 	"os"
 
+	"github.com/leminhohoho/movie-lens/scraper/pkg/config"
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-func NewLogger() (*slog.Logger, error) {
+func NewLogger(cfg *config.Config) (*slog.Logger, error) {
 	opts := &slog.HandlerOptions{}
 	var output io.Writer
 
-	if os.Getenv("DEBUG") == "TRUE" {
+	if cfg.Debug {
 		opts.Level = slog.LevelDebug
 	}
 
-	if os.Getenv("SILENT") == "TRUE" {
-		logFilePath := os.Getenv("LOG_FILE_PATH")
-		if logFilePath == "" {
-			logFilePath = "/tmp/movie_lens.log"
-		}
-
+	if cfg.Silent {
 		output = &lumberjack.Logger{
-			Filename:   logFilePath,
+			Filename:   cfg.LogFilePath,
 			MaxSize:    500,
 			MaxAge:     30,
 			MaxBackups: 3,
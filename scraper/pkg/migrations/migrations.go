@@ -0,0 +1,229 @@
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// The migrations of every dialect are in their own directory (e.g. sqlite/), they are named [version]_[name].up.sql
+// and [version]_[name].down.sql and the versions are applied in ascending order.
+//
+//go:embed sqlite/*.sql postgres/*.sql
+var files embed.FS
+
+const migrationsSchema = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    applied_at TIMESTAMP NOT NULL
+);`
+
+// Migration is a versioned change of the schema, Down reverts what Up does.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration and whether it is applied to the db.
+type Status struct {
+	Migration
+	// AppliedAt is nil if the migration is not applied yet
+	AppliedAt *time.Time
+}
+
+// Load return every embedded migration of the given dialect (sqlite or postgres), sorted by version.
+func Load(dialect string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, dialect)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for the %s dialect: %w", dialect, err)
+	}
+
+	byVersion := map[int]*Migration{}
+
+	for _, entry := range entries {
+		base, direction, ok := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration file name %s, expected [version]_[name].(up|down).sql", entry.Name())
+		}
+
+		versionStr, name, _ := strings.Cut(base, "_")
+
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version of migration %s: %w", entry.Name(), err)
+		}
+
+		content, err := files.ReadFile(path.Join(dialect, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+
+		if m.Name != name {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, m.Name, name)
+		}
+
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both an up and a down file", m.Version, m.Name)
+		}
+
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// applied return the applied versions and when they were applied.
+func applied(db *gorm.DB) (map[int]time.Time, error) {
+	if err := db.Exec(migrationsSchema).Error; err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		Version   int
+		AppliedAt time.Time
+	}
+
+	if err := db.Table("schema_migrations").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	versions := map[int]time.Time{}
+	for _, row := range rows {
+		versions[row.Version] = row.AppliedAt
+	}
+
+	return versions, nil
+}
+
+// Up apply every migration those is not applied yet, each in its own transaction.
+// It returns the number of applied migrations.
+func Up(db *gorm.DB, logger *slog.Logger) (int, error) {
+	migrations, err := Load(db.Dialector.Name())
+	if err != nil {
+		return 0, err
+	}
+
+	versions, err := applied(db)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+
+	for _, m := range migrations {
+		if _, ok := versions[m.Version]; ok {
+			continue
+		}
+
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(m.Up).Error; err != nil {
+				return err
+			}
+
+			return tx.Exec(
+				"INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", m.Version, m.Name, time.Now(),
+			).Error
+		}); err != nil {
+			return count, fmt.Errorf("unable to apply migration %d_%s: %w", m.Version, m.Name, err)
+		}
+
+		logger.Info("migration applied", "version", m.Version, "name", m.Name)
+
+		count++
+	}
+
+	return count, nil
+}
+
+// Down revert the given number of the latest applied migrations, each in its own transaction.
+// It returns the number of reverted migrations.
+func Down(db *gorm.DB, logger *slog.Logger, steps int) (int, error) {
+	migrations, err := Load(db.Dialector.Name())
+	if err != nil {
+		return 0, err
+	}
+
+	versions, err := applied(db)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+
+	for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+		m := migrations[i]
+
+		if _, ok := versions[m.Version]; !ok {
+			continue
+		}
+
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(m.Down).Error; err != nil {
+				return err
+			}
+
+			return tx.Exec("DELETE FROM schema_migrations WHERE version = ?", m.Version).Error
+		}); err != nil {
+			return count, fmt.Errorf("unable to revert migration %d_%s: %w", m.Version, m.Name, err)
+		}
+
+		logger.Info("migration reverted", "version", m.Version, "name", m.Name)
+
+		count++
+	}
+
+	return count, nil
+}
+
+// Statuses return every embedded migration with whether it is applied to the db.
+func Statuses(db *gorm.DB) ([]Status, error) {
+	migrations, err := Load(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(migrations))
+
+	for i, m := range migrations {
+		statuses[i] = Status{Migration: m}
+
+		if appliedAt, ok := versions[m.Version]; ok {
+			statuses[i].AppliedAt = &appliedAt
+		}
+	}
+
+	return statuses, nil
+}
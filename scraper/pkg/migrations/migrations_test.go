@@ -0,0 +1,127 @@
+package migrations
+
+import (
+	"io"
+	"log/slog"
+	"path"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(path.Join(t.TempDir(), "letterboxd.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func hasTable(t *testing.T, db *gorm.DB, table string) bool {
+	var count int64
+
+	if err := db.Raw("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	return count > 0
+}
+
+func TestUpAndDown(t *testing.T) {
+	db := newTestDB(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	migrations, err := Load("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := Up(db, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != len(migrations) || !hasTable(t, db, "movies") || !hasTable(t, db, "crawl_jobs") {
+		t.Fatalf("expected the %d migrations to be applied, %d were", len(migrations), count)
+	}
+
+	// Applying the migrations again is a no-op
+	if count, err := Up(db, logger); err != nil || count != 0 {
+		t.Fatalf("expected no migration to be applied again, got %d (%v)", count, err)
+	}
+
+	count, err = Down(db, logger, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 1 || !hasTable(t, db, "movies") {
+		t.Fatal("expected only the latest migration to be reverted")
+	}
+
+	statuses, err := Statuses(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if statuses[0].AppliedAt == nil || statuses[len(statuses)-1].AppliedAt != nil {
+		t.Fatalf("unexpected statuses %#v", statuses)
+	}
+
+	if _, err := Down(db, logger, len(migrations)); err != nil {
+		t.Fatal(err)
+	}
+
+	if hasTable(t, db, "movies") || hasTable(t, db, "crawl_jobs") {
+		t.Fatal("expected every migration to be reverted")
+	}
+}
+
+// TestUpExistingDB apply the migrations to a db created by the old setup.sql,
+// its rows must be kept except for the duplicated activities and the activities of a missing movie.
+func TestUpExistingDB(t *testing.T) {
+	db := newTestDB(t)
+
+	if err := db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, url TEXT NOT NULL UNIQUE, name TEXT NOT NULL);
+CREATE TABLE movies (id INTEGER PRIMARY KEY, url TEXT NOT NULL UNIQUE, name TEXT NOT NULL);
+CREATE TABLE users_and_movies (
+    user_id INTEGER NOT NULL,
+    movie_id INTEGER NOT NULL,
+    date TEXT NOT NULL,
+    is_watch INTEGER NOT NULL,
+    rating REAL,
+    is_loved INTEGER NOT NULL,
+    review TEXT
+);
+INSERT INTO users (id, url, name) VALUES (1, '/karsten/', 'karsten');
+INSERT INTO movies (id, url, name) VALUES (1, '/film/dune-part-two/', 'Dune: Part Two');
+INSERT INTO users_and_movies (user_id, movie_id, date, is_watch, is_loved) VALUES
+    (1, 1, '2024-03-01', 1, 0),
+    (1, 1, '2024-03-01', 1, 0),
+    (1, 1, '2024-04-01', 1, 1),
+    (1, 2, '2024-03-01', 1, 0);`).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Up(db, slog.New(slog.NewTextHandler(io.Discard, nil))); err != nil {
+		t.Fatal(err)
+	}
+
+	for table, expected := range map[string]int64{"users": 1, "movies": 1, "users_and_movies": 2} {
+		var count int64
+
+		if err := db.Table(table).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		}
+
+		if count != expected {
+			t.Errorf("expected %d rows in %s, got %d", expected, table, count)
+		}
+	}
+
+	if err := db.Exec("INSERT INTO users_and_movies (user_id, movie_id, date, is_watch, is_loved) VALUES (1, 1, '2024-03-01', 1, 0)").Error; err == nil {
+		t.Error("expected a duplicated activity to be rejected")
+	}
+}
@@ -0,0 +1,141 @@
+-- The PostgreSQL schema starts from the state reached by the SQLite migrations, there is no legacy db to adopt
+
+CREATE TABLE users (
+    id BIGSERIAL PRIMARY KEY,
+    url TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL
+);
+
+CREATE TABLE movies (
+    id BIGSERIAL PRIMARY KEY,
+    url TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    duration INTEGER,
+    poster_url TEXT,
+    backdrop_url TEXT,
+    "desc" TEXT,
+    trailer_url TEXT
+);
+
+CREATE TABLE crews (
+    id BIGSERIAL PRIMARY KEY,
+    url TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    role TEXT NOT NULL
+);
+
+CREATE TABLE crews_and_movies (
+    crew_id BIGINT NOT NULL REFERENCES crews (id),
+    movie_id BIGINT NOT NULL REFERENCES movies (id),
+    PRIMARY KEY (crew_id, movie_id)
+);
+
+CREATE INDEX crews_and_movies_movie_id_idx ON crews_and_movies (movie_id);
+
+CREATE TABLE genres (
+    id BIGSERIAL PRIMARY KEY,
+    url TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL
+);
+
+CREATE TABLE genres_and_movies (
+    genre_id BIGINT NOT NULL REFERENCES genres (id),
+    movie_id BIGINT NOT NULL REFERENCES movies (id),
+    PRIMARY KEY (genre_id, movie_id)
+);
+
+CREATE INDEX genres_and_movies_movie_id_idx ON genres_and_movies (movie_id);
+
+CREATE TABLE themes (
+    id BIGSERIAL PRIMARY KEY,
+    url TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL
+);
+
+CREATE TABLE themes_and_movies (
+    theme_id BIGINT NOT NULL REFERENCES themes (id),
+    movie_id BIGINT NOT NULL REFERENCES movies (id),
+    PRIMARY KEY (theme_id, movie_id)
+);
+
+CREATE INDEX themes_and_movies_movie_id_idx ON themes_and_movies (movie_id);
+
+CREATE TABLE studios (
+    id BIGSERIAL PRIMARY KEY,
+    url TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL
+);
+
+CREATE TABLE studios_and_movies (
+    studio_id BIGINT NOT NULL REFERENCES studios (id),
+    movie_id BIGINT NOT NULL REFERENCES movies (id),
+    PRIMARY KEY (studio_id, movie_id)
+);
+
+CREATE INDEX studios_and_movies_movie_id_idx ON studios_and_movies (movie_id);
+
+CREATE TABLE countries_and_movies (
+    movie_id BIGINT NOT NULL REFERENCES movies (id),
+    country TEXT NOT NULL,
+    PRIMARY KEY (movie_id, country)
+);
+
+CREATE TABLE languages_and_movies (
+    movie_id BIGINT NOT NULL REFERENCES movies (id),
+    language TEXT NOT NULL,
+    is_primary BOOLEAN NOT NULL,
+    PRIMARY KEY (movie_id, language, is_primary)
+);
+
+CREATE TABLE releases (
+    movie_id BIGINT NOT NULL REFERENCES movies (id),
+    date TEXT NOT NULL,
+    country TEXT NOT NULL,
+    age_rating TEXT,
+    release_type TEXT NOT NULL
+);
+
+-- age_rating is nullable, it can't be part of the primary key, so the releases are unique by an index on an expression instead
+CREATE UNIQUE INDEX releases_unique_idx ON releases (movie_id, date, release_type, country, COALESCE(age_rating, ''));
+
+CREATE TABLE users_and_movies (
+    user_id BIGINT NOT NULL REFERENCES users (id),
+    movie_id BIGINT NOT NULL REFERENCES movies (id),
+    date TEXT NOT NULL,
+    is_watch BOOLEAN NOT NULL,
+    rating REAL,
+    is_loved BOOLEAN NOT NULL,
+    review TEXT,
+    PRIMARY KEY (user_id, movie_id, date)
+);
+
+CREATE INDEX users_and_movies_movie_id_idx ON users_and_movies (movie_id);
+
+CREATE TABLE crawl_jobs (
+    id BIGSERIAL PRIMARY KEY,
+    kind TEXT NOT NULL,
+    url TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'in_progress', 'done', 'failed')),
+    priority INTEGER NOT NULL DEFAULT 0,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    UNIQUE (kind, url)
+);
+
+CREATE INDEX crawl_jobs_status_idx ON crawl_jobs (status, priority, id);
+
+CREATE TABLE failed_jobs (
+    id BIGSERIAL PRIMARY KEY,
+    job_id BIGINT NOT NULL UNIQUE REFERENCES crawl_jobs (id),
+    kind TEXT NOT NULL,
+    url TEXT NOT NULL,
+    error_class TEXT NOT NULL,
+    error TEXT NOT NULL,
+    attempts INTEGER NOT NULL,
+    screenshot_path TEXT,
+    failed_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX failed_jobs_error_class_idx ON failed_jobs (error_class);
@@ -0,0 +1,14 @@
+DROP TABLE IF EXISTS users_and_movies;
+DROP TABLE IF EXISTS languages_and_movies;
+DROP TABLE IF EXISTS countries_and_movies;
+DROP TABLE IF EXISTS studios_and_movies;
+DROP TABLE IF EXISTS studios;
+DROP TABLE IF EXISTS releases;
+DROP TABLE IF EXISTS themes_and_movies;
+DROP TABLE IF EXISTS themes;
+DROP TABLE IF EXISTS genres_and_movies;
+DROP TABLE IF EXISTS genres;
+DROP TABLE IF EXISTS crews_and_movies;
+DROP TABLE IF EXISTS crews;
+DROP TABLE IF EXISTS movies;
+DROP TABLE IF EXISTS users;
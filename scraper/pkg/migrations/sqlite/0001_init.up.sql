@@ -1,13 +1,12 @@
-DROP TABLE IF EXISTS users;
-CREATE TABLE users (
+-- The tables are created only if they don't exist, so that the databases created before the migrations are adopted as is
+
+CREATE TABLE IF NOT EXISTS users (
     id INTEGER PRIMARY KEY,
     url TEXT NOT NULL UNIQUE,
     name TEXT NOT NULL
 );
 
-
-DROP TABLE IF EXISTS movies;
-CREATE TABLE movies (
+CREATE TABLE IF NOT EXISTS movies (
     id INTEGER PRIMARY KEY,
     url TEXT NOT NULL UNIQUE,
     name TEXT NOT NULL,
@@ -18,55 +17,41 @@ CREATE TABLE movies (
     trailer_url TEXT
 );
 
-
-DROP TABLE IF EXISTS crews;
-CREATE TABLE crews (
+CREATE TABLE IF NOT EXISTS crews (
     id INTEGER PRIMARY KEY,
     url TEXT NOT NULL UNIQUE,
     name TEXT NOT NULL,
     role TEXT NOT NULL
 );
 
-
-DROP TABLE IF EXISTS crews_and_movies;
-CREATE TABLE crews_and_movies (
+CREATE TABLE IF NOT EXISTS crews_and_movies (
     crew_id INTEGER NOT NULL,
     movie_id INTEGER NOT NULL
 );
 
-
-DROP TABLE IF EXISTS genres;
-CREATE TABLE genres (
+CREATE TABLE IF NOT EXISTS genres (
     id INTEGER PRIMARY KEY,
     url TEXT NOT NULL UNIQUE,
     name TEXT NOT NULL
 );
 
-
-DROP TABLE IF EXISTS genres_and_movies;
-CREATE TABLE genres_and_movies (
+CREATE TABLE IF NOT EXISTS genres_and_movies (
     genre_id INTEGER NOT NULL,
     movie_id INTEGER NOT NULL
 );
 
-
-DROP TABLE IF EXISTS themes;
-CREATE TABLE themes (
+CREATE TABLE IF NOT EXISTS themes (
     id INTEGER PRIMARY KEY,
     url TEXT NOT NULL UNIQUE,
     name TEXT NOT NULL
 );
 
-
-DROP TABLE IF EXISTS themes_and_movies;
-CREATE TABLE themes_and_movies (
+CREATE TABLE IF NOT EXISTS themes_and_movies (
     theme_id INTEGER NOT NULL,
     movie_id INTEGER NOT NULL
 );
 
-
-DROP TABLE IF EXISTS releases;
-CREATE TABLE releases (
+CREATE TABLE IF NOT EXISTS releases (
     movie_id INTEGER NOT NULL,
     date TEXT NOT NULL,
     country TEXT NOT NULL,
@@ -74,36 +59,26 @@ CREATE TABLE releases (
     release_type TEXT NOT NULL
 );
 
-
-DROP TABLE IF EXISTS studios;
-CREATE TABLE studios (
+CREATE TABLE IF NOT EXISTS studios (
     id INTEGER PRIMARY KEY,
     url TEXT NOT NULL UNIQUE,
     name TEXT NOT NULL
 );
 
-
-DROP TABLE IF EXISTS studios_and_movies;
-CREATE TABLE studios_and_movies (
+CREATE TABLE IF NOT EXISTS studios_and_movies (
     studio_id INTEGER NOT NULL,
     movie_id INTEGER NOT NULL
 );
 
+CREATE TABLE IF NOT EXISTS countries_and_movies (movie_id INTEGER NOT NULL, country TEXT NOT NULL);
 
-DROP TABLE IF EXISTS countries_and_movies;
-CREATE TABLE countries_and_movies (movie_id INTEGER NOT NULL, country TEXT NOT NULL);
-
-
-DROP TABLE IF EXISTS languages_and_movies;
-CREATE TABLE languages_and_movies (
+CREATE TABLE IF NOT EXISTS languages_and_movies (
     movie_id INTEGER NOT NULL,
     language TEXT NOT NULL,
     is_primary INTEGER NOT NULL CHECK (is_primary IN (0, 1))
 );
 
-
-DROP TABLE IF EXISTS users_and_movies;
-CREATE TABLE users_and_movies (
+CREATE TABLE IF NOT EXISTS users_and_movies (
     user_id INTEGER NOT NULL,
     movie_id INTEGER NOT NULL,
     date TEXT NOT NULL,
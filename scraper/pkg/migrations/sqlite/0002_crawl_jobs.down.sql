@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS failed_jobs;
+DROP TABLE IF EXISTS crawl_jobs;
@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS crawl_jobs (
+    id INTEGER PRIMARY KEY,
+    kind TEXT NOT NULL,
+    url TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'in_progress', 'done', 'failed')),
+    priority INTEGER NOT NULL DEFAULT 0,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    UNIQUE (kind, url)
+);
+
+CREATE INDEX IF NOT EXISTS crawl_jobs_status_idx ON crawl_jobs (status, priority, id);
+
+CREATE TABLE IF NOT EXISTS failed_jobs (
+    id INTEGER PRIMARY KEY,
+    job_id INTEGER NOT NULL UNIQUE REFERENCES crawl_jobs (id),
+    kind TEXT NOT NULL,
+    url TEXT NOT NULL,
+    error_class TEXT NOT NULL,
+    error TEXT NOT NULL,
+    attempts INTEGER NOT NULL,
+    screenshot_path TEXT,
+    failed_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS failed_jobs_error_class_idx ON failed_jobs (error_class);
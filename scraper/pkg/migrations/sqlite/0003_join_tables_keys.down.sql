@@ -0,0 +1,60 @@
+-- The join tables are created again without their keys, the rows are kept
+
+CREATE TABLE crews_and_movies_old (crew_id INTEGER NOT NULL, movie_id INTEGER NOT NULL);
+INSERT INTO crews_and_movies_old SELECT crew_id, movie_id FROM crews_and_movies;
+DROP TABLE crews_and_movies;
+ALTER TABLE crews_and_movies_old RENAME TO crews_and_movies;
+
+CREATE TABLE genres_and_movies_old (genre_id INTEGER NOT NULL, movie_id INTEGER NOT NULL);
+INSERT INTO genres_and_movies_old SELECT genre_id, movie_id FROM genres_and_movies;
+DROP TABLE genres_and_movies;
+ALTER TABLE genres_and_movies_old RENAME TO genres_and_movies;
+
+CREATE TABLE themes_and_movies_old (theme_id INTEGER NOT NULL, movie_id INTEGER NOT NULL);
+INSERT INTO themes_and_movies_old SELECT theme_id, movie_id FROM themes_and_movies;
+DROP TABLE themes_and_movies;
+ALTER TABLE themes_and_movies_old RENAME TO themes_and_movies;
+
+CREATE TABLE studios_and_movies_old (studio_id INTEGER NOT NULL, movie_id INTEGER NOT NULL);
+INSERT INTO studios_and_movies_old SELECT studio_id, movie_id FROM studios_and_movies;
+DROP TABLE studios_and_movies;
+ALTER TABLE studios_and_movies_old RENAME TO studios_and_movies;
+
+CREATE TABLE countries_and_movies_old (movie_id INTEGER NOT NULL, country TEXT NOT NULL);
+INSERT INTO countries_and_movies_old SELECT movie_id, country FROM countries_and_movies;
+DROP TABLE countries_and_movies;
+ALTER TABLE countries_and_movies_old RENAME TO countries_and_movies;
+
+CREATE TABLE languages_and_movies_old (
+    movie_id INTEGER NOT NULL,
+    language TEXT NOT NULL,
+    is_primary INTEGER NOT NULL CHECK (is_primary IN (0, 1))
+);
+INSERT INTO languages_and_movies_old SELECT movie_id, language, is_primary FROM languages_and_movies;
+DROP TABLE languages_and_movies;
+ALTER TABLE languages_and_movies_old RENAME TO languages_and_movies;
+
+CREATE TABLE releases_old (
+    movie_id INTEGER NOT NULL,
+    date TEXT NOT NULL,
+    country TEXT NOT NULL,
+    age_rating TEXT,
+    release_type TEXT NOT NULL
+);
+INSERT INTO releases_old SELECT movie_id, date, country, age_rating, release_type FROM releases;
+DROP TABLE releases;
+ALTER TABLE releases_old RENAME TO releases;
+
+CREATE TABLE users_and_movies_old (
+    user_id INTEGER NOT NULL,
+    movie_id INTEGER NOT NULL,
+    date TEXT NOT NULL,
+    is_watch INTEGER NOT NULL CHECK (is_loved IN (0, 1)),
+    rating REAL,
+    is_loved INTEGER NOT NULL CHECK (is_loved IN (0, 1)),
+    review TEXT
+);
+INSERT INTO users_and_movies_old
+SELECT user_id, movie_id, date, is_watch, rating, is_loved, review FROM users_and_movies;
+DROP TABLE users_and_movies;
+ALTER TABLE users_and_movies_old RENAME TO users_and_movies;
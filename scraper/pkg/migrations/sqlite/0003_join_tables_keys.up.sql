@@ -0,0 +1,113 @@
+-- SQLite can't add constraints to an existing table, so every join table is created again with its keys and filled
+-- with the rows of the old one. The duplicated rows and the rows referencing a missing movie, user or entity are dropped.
+
+CREATE TABLE crews_and_movies_new (
+    crew_id INTEGER NOT NULL REFERENCES crews (id),
+    movie_id INTEGER NOT NULL REFERENCES movies (id),
+    PRIMARY KEY (crew_id, movie_id)
+);
+INSERT OR IGNORE INTO crews_and_movies_new (crew_id, movie_id)
+SELECT crew_id, movie_id FROM crews_and_movies
+WHERE crew_id IN (SELECT id FROM crews) AND movie_id IN (SELECT id FROM movies)
+ORDER BY rowid;
+DROP TABLE crews_and_movies;
+ALTER TABLE crews_and_movies_new RENAME TO crews_and_movies;
+CREATE INDEX crews_and_movies_movie_id_idx ON crews_and_movies (movie_id);
+
+CREATE TABLE genres_and_movies_new (
+    genre_id INTEGER NOT NULL REFERENCES genres (id),
+    movie_id INTEGER NOT NULL REFERENCES movies (id),
+    PRIMARY KEY (genre_id, movie_id)
+);
+INSERT OR IGNORE INTO genres_and_movies_new (genre_id, movie_id)
+SELECT genre_id, movie_id FROM genres_and_movies
+WHERE genre_id IN (SELECT id FROM genres) AND movie_id IN (SELECT id FROM movies)
+ORDER BY rowid;
+DROP TABLE genres_and_movies;
+ALTER TABLE genres_and_movies_new RENAME TO genres_and_movies;
+CREATE INDEX genres_and_movies_movie_id_idx ON genres_and_movies (movie_id);
+
+CREATE TABLE themes_and_movies_new (
+    theme_id INTEGER NOT NULL REFERENCES themes (id),
+    movie_id INTEGER NOT NULL REFERENCES movies (id),
+    PRIMARY KEY (theme_id, movie_id)
+);
+INSERT OR IGNORE INTO themes_and_movies_new (theme_id, movie_id)
+SELECT theme_id, movie_id FROM themes_and_movies
+WHERE theme_id IN (SELECT id FROM themes) AND movie_id IN (SELECT id FROM movies)
+ORDER BY rowid;
+DROP TABLE themes_and_movies;
+ALTER TABLE themes_and_movies_new RENAME TO themes_and_movies;
+CREATE INDEX themes_and_movies_movie_id_idx ON themes_and_movies (movie_id);
+
+CREATE TABLE studios_and_movies_new (
+    studio_id INTEGER NOT NULL REFERENCES studios (id),
+    movie_id INTEGER NOT NULL REFERENCES movies (id),
+    PRIMARY KEY (studio_id, movie_id)
+);
+INSERT OR IGNORE INTO studios_and_movies_new (studio_id, movie_id)
+SELECT studio_id, movie_id FROM studios_and_movies
+WHERE studio_id IN (SELECT id FROM studios) AND movie_id IN (SELECT id FROM movies)
+ORDER BY rowid;
+DROP TABLE studios_and_movies;
+ALTER TABLE studios_and_movies_new RENAME TO studios_and_movies;
+CREATE INDEX studios_and_movies_movie_id_idx ON studios_and_movies (movie_id);
+
+CREATE TABLE countries_and_movies_new (
+    movie_id INTEGER NOT NULL REFERENCES movies (id),
+    country TEXT NOT NULL,
+    PRIMARY KEY (movie_id, country)
+);
+INSERT OR IGNORE INTO countries_and_movies_new (movie_id, country)
+SELECT movie_id, country FROM countries_and_movies
+WHERE movie_id IN (SELECT id FROM movies)
+ORDER BY rowid;
+DROP TABLE countries_and_movies;
+ALTER TABLE countries_and_movies_new RENAME TO countries_and_movies;
+
+CREATE TABLE languages_and_movies_new (
+    movie_id INTEGER NOT NULL REFERENCES movies (id),
+    language TEXT NOT NULL,
+    is_primary INTEGER NOT NULL CHECK (is_primary IN (0, 1)),
+    PRIMARY KEY (movie_id, language, is_primary)
+);
+INSERT OR IGNORE INTO languages_and_movies_new (movie_id, language, is_primary)
+SELECT movie_id, language, is_primary FROM languages_and_movies
+WHERE movie_id IN (SELECT id FROM movies)
+ORDER BY rowid;
+DROP TABLE languages_and_movies;
+ALTER TABLE languages_and_movies_new RENAME TO languages_and_movies;
+
+-- age_rating is nullable, it can't be part of the primary key, so the releases are unique by an index on an expression instead
+CREATE TABLE releases_new (
+    movie_id INTEGER NOT NULL REFERENCES movies (id),
+    date TEXT NOT NULL,
+    country TEXT NOT NULL,
+    age_rating TEXT,
+    release_type TEXT NOT NULL
+);
+CREATE UNIQUE INDEX releases_unique_idx ON releases_new (movie_id, date, release_type, country, COALESCE(age_rating, ''));
+INSERT OR IGNORE INTO releases_new (movie_id, date, country, age_rating, release_type)
+SELECT movie_id, date, country, age_rating, release_type FROM releases
+WHERE movie_id IN (SELECT id FROM movies)
+ORDER BY rowid;
+DROP TABLE releases;
+ALTER TABLE releases_new RENAME TO releases;
+
+CREATE TABLE users_and_movies_new (
+    user_id INTEGER NOT NULL REFERENCES users (id),
+    movie_id INTEGER NOT NULL REFERENCES movies (id),
+    date TEXT NOT NULL,
+    is_watch INTEGER NOT NULL CHECK (is_watch IN (0, 1)),
+    rating REAL,
+    is_loved INTEGER NOT NULL CHECK (is_loved IN (0, 1)),
+    review TEXT,
+    PRIMARY KEY (user_id, movie_id, date)
+);
+INSERT OR IGNORE INTO users_and_movies_new (user_id, movie_id, date, is_watch, rating, is_loved, review)
+SELECT user_id, movie_id, date, is_watch, rating, is_loved, review FROM users_and_movies
+WHERE user_id IN (SELECT id FROM users) AND movie_id IN (SELECT id FROM movies)
+ORDER BY rowid;
+DROP TABLE users_and_movies;
+ALTER TABLE users_and_movies_new RENAME TO users_and_movies;
+CREATE INDEX users_and_movies_movie_id_idx ON users_and_movies (movie_id);
@@ -1,32 +1,46 @@
 package models
 
+import "time"
+
 type User struct {
-	Id   int
-	Url  string `json:"url"`
-	Name string `json:"name"`
+	Id   int    `parquet:"id"`
+	Url  string `json:"url" parquet:"url"`
+	Name string `json:"name" parquet:"name"`
 }
 
 type Movie struct {
-	Id          int
-	Url         string
-	Name        string
-	Duration    *int
-	PosterUrl   *string
-	BackdropUrl *string
-	Desc        *string
-	TrailerUrl  *string
+	Id          int     `parquet:"id"`
+	Url         string  `parquet:"url"`
+	Name        string  `parquet:"name"`
+	Duration    *int    `parquet:"duration,optional"`
+	PosterUrl   *string `parquet:"poster_url,optional"`
+	BackdropUrl *string `parquet:"backdrop_url,optional"`
+	Desc        *string `parquet:"desc,optional"`
+	TrailerUrl  *string `parquet:"trailer_url,optional"`
+}
+
+// MovieDetails is a movie with everything scraped from its page, it is written to the db at once.
+type MovieDetails struct {
+	Movie     Movie
+	Crews     []Crew
+	Genres    []Genre
+	Themes    []Theme
+	Studios   []Studio
+	Countries []CountriesAndMovies
+	Languages []LanguagesAndMovies
+	Releases  []Release
 }
 
 type Crew struct {
-	Id   int
-	Url  string
-	Name string
-	Role string
+	Id   int    `parquet:"id"`
+	Url  string `parquet:"url"`
+	Name string `parquet:"name"`
+	Role string `parquet:"role"`
 }
 
 type CrewsAndMovies struct {
-	CrewId  int
-	MovieId int
+	CrewId  int `parquet:"crew_id"`
+	MovieId int `parquet:"movie_id"`
 }
 
 type UserAndMovie struct {
@@ -40,47 +54,47 @@ type UserAndMovie struct {
 }
 
 type Genre struct {
-	Id   int
-	Url  string
-	Name string
+	Id   int    `parquet:"id"`
+	Url  string `parquet:"url"`
+	Name string `parquet:"name"`
 }
 
 type GenresAndMovies struct {
-	GenreId int
-	MovieId int
+	GenreId int `parquet:"genre_id"`
+	MovieId int `parquet:"movie_id"`
 }
 
 type Theme struct {
-	Id   int
-	Url  string
-	Name string
+	Id   int    `parquet:"id"`
+	Url  string `parquet:"url"`
+	Name string `parquet:"name"`
 }
 
 type ThemesAndMovies struct {
-	ThemeId int
-	MovieId int
+	ThemeId int `parquet:"theme_id"`
+	MovieId int `parquet:"movie_id"`
 }
 
 type Studio struct {
-	Id   int
-	Url  string
-	Name string
+	Id   int    `parquet:"id"`
+	Url  string `parquet:"url"`
+	Name string `parquet:"name"`
 }
 
 type StudiosAndMovies struct {
-	StudioId int
-	MovieId  int
+	StudioId int `parquet:"studio_id"`
+	MovieId  int `parquet:"movie_id"`
 }
 
 type CountriesAndMovies struct {
-	MovieId int
-	Country string
+	MovieId int    `parquet:"movie_id"`
+	Country string `parquet:"country"`
 }
 
 type LanguagesAndMovies struct {
-	MovieId   int
-	Language  string
-	IsPrimary bool
+	MovieId   int    `parquet:"movie_id"`
+	Language  string `parquet:"language"`
+	IsPrimary bool   `parquet:"is_primary"`
 }
 
 type Release struct {
@@ -90,3 +104,27 @@ type Release struct {
 	AgeRating   *string
 	ReleaseType string
 }
+
+type CrawlJob struct {
+	Id        int
+	Kind      string
+	Url       string
+	Status    string
+	Priority  int
+	Attempts  int
+	Error     *string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type FailedJob struct {
+	Id             int
+	JobId          int
+	Kind           string
+	Url            string
+	ErrorClass     string
+	Error          string
+	Attempts       int
+	ScreenshotPath *string
+	FailedAt       time.Time
+}
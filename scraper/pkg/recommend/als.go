@@ -0,0 +1,319 @@
+package recommend
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"os"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/leminhohoho/movie-lens/scraper/pkg/features"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/utils"
+)
+
+type ALSOptions struct {
+	// Factors is the size of the vectors of the users and the movies
+	Factors        int     `json:"factors"`
+	Regularization float64 `json:"regularization"`
+	Iterations     int     `json:"iterations"`
+	// Alpha scale the [Weight] of the interactions to their confidence, which is 1 + Alpha * weight
+	Alpha float64 `json:"alpha"`
+	// Workers is the number of goroutines solving the vectors, it is the number of CPUs if 0
+	Workers int    `json:"workers"`
+	Seed    uint64 `json:"seed"`
+}
+
+func DefaultALSOptions() ALSOptions {
+	return ALSOptions{Factors: 64, Regularization: 0.1, Iterations: 15, Alpha: 10, Seed: 1}
+}
+
+// ALS is an implicit feedback matrix factorization (Hu, Koren and Volinsky, 2008) trained by alternating least squares.
+// Every user and every movie is a vector, the score of a movie for a user is the dot product of their vectors.
+type ALS struct {
+	Options ALSOptions
+	Users   features.Index
+	Movies  features.Index
+	// UserFactors and MovieFactors are the vectors of the users and the movies by id, one after the other
+	UserFactors  []float32
+	MovieFactors []float32
+
+	// gram is the Gram matrix of the movie vectors, computed once for every user vector
+	gramOnce sync.Once
+	gram     []float64
+}
+
+// TrainALS factorize the interactions, every interaction is a preference of 1 with its confidence and the movies
+// a user didn't interact with are a preference of 0 with a confidence of 1.
+func TrainALS(interactions *Interactions, opts ALSOptions, logger *slog.Logger) (*ALS, error) {
+	if opts.Factors < 1 || opts.Iterations < 1 || opts.Regularization <= 0 {
+		return nil, fmt.Errorf("factors and iterations must be at least 1 and regularization positive, got %d, %d and %f",
+			opts.Factors, opts.Iterations, opts.Regularization)
+	}
+
+	if opts.Workers < 1 {
+		opts.Workers = runtime.NumCPU()
+	}
+
+	als := &ALS{
+		Options: opts,
+		Users:   features.NewIndex(interactions.Users.Keys),
+		Movies:  features.NewIndex(interactions.Movies.Keys),
+	}
+
+	rng := rand.New(rand.NewPCG(opts.Seed, opts.Seed))
+	als.UserFactors = randomFactors(rng, interactions.Users.Len()*opts.Factors, opts.Factors)
+	als.MovieFactors = randomFactors(rng, interactions.Movies.Len()*opts.Factors, opts.Factors)
+
+	for iteration := range opts.Iterations {
+		start := time.Now()
+
+		als.solve(als.UserFactors, als.MovieFactors, interactions.ByUser)
+		als.solve(als.MovieFactors, als.UserFactors, interactions.ByMovie)
+
+		logger.Info("als iteration done", "iteration", iteration+1, "duration", time.Since(start))
+	}
+
+	return als, nil
+}
+
+func randomFactors(rng *rand.Rand, n int, factors int) []float32 {
+	scale := 0.1 / float32(factors)
+
+	values := make([]float32, n)
+	for i := range values {
+		values[i] = rng.Float32() * scale
+	}
+
+	return values
+}
+
+// solve compute the vector of every row given the fixed vectors of the columns, the items of a row are its columns.
+func (als *ALS) solve(rows []float32, columns []float32, items [][]Item) {
+	f := als.Options.Factors
+	gram := gramMatrix(columns, f)
+
+	ids := make(chan int, als.Options.Workers)
+	var wg sync.WaitGroup
+
+	for range als.Options.Workers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			a := make([]float64, f*f)
+			b := make([]float64, f)
+
+			for id := range ids {
+				als.solveRow(rows[id*f:(id+1)*f], columns, items[id], gram, a, b)
+			}
+		}()
+	}
+
+	for id := range items {
+		ids <- id
+	}
+
+	close(ids)
+	wg.Wait()
+}
+
+// solveRow set row to the vector minimizing the loss of its items: (Yt Y + Yt (C - I) Y + reg I) x = Yt C p.
+// a and b are buffers of f*f and f values.
+func (als *ALS) solveRow(row []float32, columns []float32, items []Item, gram []float64, a []float64, b []float64) {
+	f := als.Options.Factors
+
+	copy(a, gram)
+	clear(b)
+
+	for i := range f {
+		a[i*f+i] += als.Options.Regularization
+	}
+
+	for _, item := range items {
+		y := columns[item.Movie*f : (item.Movie+1)*f]
+		confidence := 1 + als.Options.Alpha*float64(item.Weight)
+
+		for i := range f {
+			yi := float64(y[i])
+			b[i] += confidence * yi
+
+			for j := range f {
+				a[i*f+j] += (confidence - 1) * yi * float64(y[j])
+			}
+		}
+	}
+
+	if !choleskySolve(a, b, f) {
+		clear(row)
+		return
+	}
+
+	for i := range f {
+		row[i] = float32(b[i])
+	}
+}
+
+// gramMatrix return Yt Y of the vectors of size f.
+func gramMatrix(vectors []float32, f int) []float64 {
+	gram := make([]float64, f*f)
+
+	for start := 0; start < len(vectors); start += f {
+		y := vectors[start : start+f]
+
+		for i := range f {
+			for j := range f {
+				gram[i*f+j] += float64(y[i]) * float64(y[j])
+			}
+		}
+	}
+
+	return gram
+}
+
+// choleskySolve solve a x = b for a symmetric positive definite matrix a of n*n values, x is written to b and a is overwritten.
+// It returns false if a is not positive definite.
+func choleskySolve(a []float64, b []float64, n int) bool {
+	// a = L Lt, L is written to the lower triangle of a
+	for j := range n {
+		sum := a[j*n+j]
+		for k := range j {
+			sum -= a[j*n+k] * a[j*n+k]
+		}
+
+		if sum <= 0 {
+			return false
+		}
+
+		a[j*n+j] = math.Sqrt(sum)
+
+		for i := j + 1; i < n; i++ {
+			sum := a[i*n+j]
+			for k := range j {
+				sum -= a[i*n+k] * a[j*n+k]
+			}
+
+			a[i*n+j] = sum / a[j*n+j]
+		}
+	}
+
+	// L z = b
+	for i := range n {
+		for k := range i {
+			b[i] -= a[i*n+k] * b[k]
+		}
+
+		b[i] /= a[i*n+i]
+	}
+
+	// Lt x = z
+	for i := n - 1; i >= 0; i-- {
+		for k := i + 1; k < n; k++ {
+			b[i] -= a[k*n+i] * b[k]
+		}
+
+		b[i] /= a[i*n+i]
+	}
+
+	return true
+}
+
+// UserVector compute the vector of a user who watched the given movies, as if the user was in the training. weights
+// are the [Weight] of the activities of the user on the movies, in the order of watched, every movie is weighted 1
+// (watched but not rated) if weights is nil. It returns nil if none of the movies is known.
+func (als *ALS) UserVector(watched []string, weights []float32) []float32 {
+	// A movie watched many times is weighted by its highest weight, like in the interactions
+	byMovie := map[int]float32{}
+	for i, url := range watched {
+		weight := float32(1)
+		if weights != nil {
+			weight = weights[i]
+		}
+
+		if id, ok := als.Movies.Id(url); ok {
+			byMovie[id] = max(byMovie[id], weight)
+		}
+	}
+
+	if len(byMovie) == 0 {
+		return nil
+	}
+
+	var items []Item
+	for _, id := range slices.Sorted(maps.Keys(byMovie)) {
+		items = append(items, Item{Movie: id, Weight: byMovie[id]})
+	}
+
+	f := als.Options.Factors
+	vector := make([]float32, f)
+
+	als.gramOnce.Do(func() { als.gram = gramMatrix(als.MovieFactors, f) })
+	als.solveRow(vector, als.MovieFactors, items, als.gram, make([]float64, f*f), make([]float64, f))
+
+	return vector
+}
+
+// Recommend score every movie by the dot product of its vector with the vector of a user who watched the given movies.
+// Every movie is weighted as watched but not rated, [ALS.RecommendWeighted] puts the user on the scale of the training.
+func (als *ALS) Recommend(watched []string, k int) []Recommendation {
+	return als.RecommendWeighted(watched, nil, k)
+}
+
+// RecommendWeighted is [ALS.Recommend] with the [Weight] of the activity of the user on every watched movie.
+func (als *ALS) RecommendWeighted(watched []string, weights []float32, k int) []Recommendation {
+	vector := als.UserVector(watched, weights)
+	if vector == nil {
+		return nil
+	}
+
+	return topK(&als.Movies, als.Scores(vector), watchedIds(&als.Movies, watched), k)
+}
+
+// Scores return the score of every movie for the user of the given vector, by movie id.
+func (als *ALS) Scores(vector []float32) []float64 {
+	f := als.Options.Factors
+	scores := make([]float64, als.Movies.Len())
+
+	for id := range scores {
+		y := als.MovieFactors[id*f : (id+1)*f]
+		for i := range f {
+			scores[id] += float64(vector[i]) * float64(y[i])
+		}
+	}
+
+	return scores
+}
+
+// Save write the model to filePath, the previous file is replaced at once.
+func (als *ALS) Save(filePath string) error {
+	return utils.WriteFileAtomic(filePath, func(w io.Writer) error {
+		return gob.NewEncoder(w).Encode(als)
+	})
+}
+
+// LoadALS read a model written by [ALS.Save].
+func LoadALS(filePath string) (*ALS, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var als ALS
+
+	if err := gob.NewDecoder(f).Decode(&als); err != nil {
+		return nil, fmt.Errorf("unable to read the model %s: %w", filePath, err)
+	}
+
+	als.Users = features.NewIndex(als.Users.Keys)
+	als.Movies = features.NewIndex(als.Movies.Keys)
+
+	return &als, nil
+}
@@ -0,0 +1,106 @@
+package recommend
+
+import (
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path"
+	"slices"
+	"testing"
+)
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestCholeskySolve(t *testing.T) {
+	// [4 2; 2 3] x = [2; 1] has x = [0.5; 0]
+	a := []float64{4, 2, 2, 3}
+	b := []float64{2, 1}
+
+	if !choleskySolve(a, b, 2) {
+		t.Fatal("expected the matrix to be positive definite")
+	}
+
+	if math.Abs(b[0]-0.5) > 1e-9 || math.Abs(b[1]) > 1e-9 {
+		t.Fatalf("unexpected solution %v", b)
+	}
+
+	if choleskySolve([]float64{1, 2, 2, 1}, []float64{1, 1}, 2) {
+		t.Fatal("expected the matrix not to be positive definite")
+	}
+}
+
+func TestALS(t *testing.T) {
+	data := newTestData(testWatches, testGenres)
+
+	opts := DefaultALSOptions()
+	opts.Factors = 4
+	opts.Workers = 2
+
+	als, err := TrainALS(data.Interactions, opts, discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recommendations := als.Recommend([]string{"/film/lady-bird/"}, 1)
+	if got := urls(recommendations); len(got) != 1 || got[0] != "/film/barbie/" {
+		t.Fatalf("unexpected recommendations %v", got)
+	}
+
+	if als.Recommend([]string{"/film/unknown/"}, 1) != nil {
+		t.Fatal("expected no recommendation when no watched movie is known")
+	}
+
+	// The movies are weighted like the interactions of the training, a movie watched twice by its highest weight
+	watched := []string{"/film/lady-bird/", "/film/dune/"}
+
+	if !slices.Equal(als.UserVector(watched, nil), als.UserVector(watched, []float32{1, 1})) {
+		t.Fatal("expected the movies weighted 1 by default")
+	}
+
+	if slices.Equal(als.UserVector(watched, []float32{2, 0.2}), als.UserVector(watched, nil)) {
+		t.Fatal("expected the weights to change the vector of the user")
+	}
+
+	if !slices.Equal(als.UserVector([]string{"/film/dune/", "/film/dune/"}, []float32{0.2, 2}), als.UserVector([]string{"/film/dune/"}, []float32{2})) {
+		t.Fatal("expected a movie watched twice to be weighted by its highest weight")
+	}
+
+	dir := t.TempDir()
+	filePath := path.Join(dir, "als.gob")
+
+	if err := als.Save(filePath); err != nil {
+		t.Fatal(err)
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("expected only the model in the dir, got %v", entries)
+	}
+
+	loaded, err := LoadALS(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(loaded.Recommend([]string{"/film/dune/"}, 3), als.Recommend([]string{"/film/dune/"}, 3)) {
+		t.Fatal("expected the loaded model to recommend the same movies")
+	}
+
+	// The training is the same on every run with the same seed, whatever the number of workers
+	opts.Workers = 1
+
+	again, err := TrainALS(data.Interactions, opts, discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(again.MovieFactors, als.MovieFactors) {
+		t.Fatal("expected the same vectors with the same seed")
+	}
+
+	opts.Factors = 0
+
+	if _, err := TrainALS(data.Interactions, opts, discard); err == nil {
+		t.Fatal("expected an error for 0 factors")
+	}
+}
@@ -0,0 +1,475 @@
+package recommend
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/leminhohoho/movie-lens/scraper/pkg/features"
+)
+
+// The features of the content similarity, in the order of the contributions of equal scores.
+const (
+	FeatureThemes      = "themes"
+	FeatureDescription = "description"
+	FeatureDirectors   = "directors"
+	FeatureActors      = "actors"
+	FeatureGenres      = "genres"
+)
+
+// maxShared is the number of shared themes, terms or crews given by a contribution.
+const maxShared = 5
+
+// ContentWeights are the weights of the features in the similarity of two movies, they sum to 1 by default so the
+// similarity is between 0 and 1.
+type ContentWeights struct {
+	// Themes and Description are the cosine of the TF-IDF of the themes and of the words of the descriptions
+	Themes      float64 `json:"themes"`
+	Description float64 `json:"description"`
+	// Directors and Actors are the overlap of the crews, the number of shared ones over the size of the smallest crew
+	Directors float64 `json:"directors"`
+	Actors    float64 `json:"actors"`
+	// Genres is the Jaccard index of the genres
+	Genres float64 `json:"genres"`
+}
+
+func DefaultContentWeights() ContentWeights {
+	return ContentWeights{Themes: 0.3, Description: 0.2, Directors: 0.15, Actors: 0.15, Genres: 0.2}
+}
+
+// Contribution is the part of a feature in the similarity of two movies.
+type Contribution struct {
+	Feature string `json:"feature"`
+	// Similarity is the similarity of the movies on the feature alone, Score is its weighted part of the similarity
+	Similarity float64 `json:"similarity"`
+	Score      float64 `json:"score"`
+	// Shared are what the movies share the most for the feature (e.g. the themes, the words or the directors)
+	Shared []string `json:"shared"`
+}
+
+// SimilarMovie is a movie similar to another, its score is the sum of the scores of the contributions.
+type SimilarMovie struct {
+	Id            int            `json:"id"`
+	Url           string         `json:"url"`
+	Score         float64        `json:"score"`
+	Contributions []Contribution `json:"contributions"`
+}
+
+// term is a weighted token of a sparse vector, the vectors are sorted by token.
+type term struct {
+	token  int32
+	weight float64
+}
+
+type contentMovie struct {
+	id          int
+	url         string
+	themes      []term
+	description []term
+	directors   []int32
+	actors      []int32
+	genres      []int32
+}
+
+// Content recommend the movies those are similar to the watched ones by their metadata, it needs no activity and so
+// recommends the movies no one watched yet.
+type Content struct {
+	Weights ContentWeights
+	movies  []contentMovie
+	// byUrl and byId are the positions of the movies in movies, by url and by the id of the movie in the db
+	byUrl map[string]int
+	byId  map[int]int
+	// tokens are the themes, words, crews and genres of the vectors, by token, ids are the tokens by kind and value
+	tokens []string
+	ids    map[string]int32
+	// frequencies are the number of movies of every theme and word, by token
+	frequencies map[int32]int
+}
+
+// NewContent compute the vectors of the movies, the idf of the themes and of the words are computed over the movies.
+func NewContent(movies []features.Movie, weights ContentWeights) *Content {
+	c := &Content{
+		Weights:     weights,
+		byUrl:       map[string]int{},
+		byId:        map[int]int{},
+		ids:         map[string]int32{},
+		frequencies: map[int32]int{},
+	}
+
+	token := func(key string, value string) int32 {
+		id, ok := c.ids[key]
+		if !ok {
+			id = int32(len(c.tokens))
+			c.ids[key] = id
+			c.tokens = append(c.tokens, value)
+		}
+
+		return id
+	}
+
+	// Movies are visited by id, so the tokens are the same on every run
+	movies = slices.SortedFunc(slices.Values(movies), func(a, b features.Movie) int { return cmp.Compare(a.Id, b.Id) })
+	counts := make([]tokenCounts, len(movies))
+
+	for i, movie := range movies {
+		var m contentMovie
+		m, counts[i] = newContentMovie(movie, token)
+
+		for theme := range counts[i].themes {
+			c.frequencies[theme]++
+		}
+
+		for word := range counts[i].words {
+			c.frequencies[word]++
+		}
+
+		c.byUrl[movie.Url] = i
+		c.byId[movie.Id] = i
+		c.movies = append(c.movies, m)
+	}
+
+	for i := range c.movies {
+		c.movies[i].themes = tfidf(counts[i].themes, c.frequencies, len(movies))
+		c.movies[i].description = tfidf(counts[i].words, c.frequencies, len(movies))
+	}
+
+	return c
+}
+
+// tokenCounts are the counts of the themes and of the words of a movie, by token.
+type tokenCounts struct {
+	themes map[int32]int
+	words  map[int32]int
+}
+
+// newContentMovie return a movie without its TF-IDF vectors and the counts those they are computed from, token give
+// the id of a token by its key (the kind and the value) and its value.
+func newContentMovie(movie features.Movie, token func(key string, value string) int32) (contentMovie, tokenCounts) {
+	tokens := func(kind string, values []string) []int32 {
+		result := make([]int32, len(values))
+		for i, value := range values {
+			result[i] = token(kind+":"+value, value)
+		}
+
+		slices.Sort(result)
+
+		return slices.Compact(result)
+	}
+
+	counts := tokenCounts{themes: map[int32]int{}, words: map[int32]int{}}
+
+	for _, theme := range tokens(FeatureThemes, movie.Themes) {
+		counts.themes[theme] = 1
+	}
+
+	if movie.Desc != nil {
+		for _, word := range Words(*movie.Desc) {
+			counts.words[token(FeatureDescription+":"+word, word)]++
+		}
+	}
+
+	return contentMovie{
+		id:        movie.Id,
+		url:       movie.Url,
+		directors: tokens(FeatureDirectors, movie.Directors),
+		actors:    tokens(FeatureActors, movie.Actors),
+		genres:    tokens(FeatureGenres, movie.Genres),
+	}, counts
+}
+
+// tfidf return the normalized TF-IDF of the counts of the tokens of a movie, the tf is sublinear and the idf smoothed.
+func tfidf(counts map[int32]int, frequencies map[int32]int, movies int) []term {
+	vector := make([]term, 0, len(counts))
+
+	var norm float64
+	for _, token := range slices.Sorted(maps.Keys(counts)) {
+		tf := 1 + math.Log(float64(counts[token]))
+		idf := math.Log(float64(movies+1)/float64(frequencies[token]+1)) + 1
+
+		vector = append(vector, term{token, tf * idf})
+		norm += tf * idf * tf * idf
+	}
+
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i].weight /= norm
+	}
+
+	return vector
+}
+
+// SimilarMovies return the k movies the most similar to the movie of the given id in the db, the most similar first,
+// with the contribution of every feature to their similarity.
+func (c *Content) SimilarMovies(movieId int, k int) ([]SimilarMovie, error) {
+	i, ok := c.byId[movieId]
+	if !ok {
+		return nil, fmt.Errorf("movie %d not found", movieId)
+	}
+
+	return c.similarMovies(&c.movies[i], k), nil
+}
+
+// SimilarTo return the k movies the most similar to the given movie like [Content.SimilarMovies], the movie doesn't
+// have to be one of the movies (e.g. a movie scraped since): its themes and words are then weighted with the idf of
+// the movies.
+func (c *Content) SimilarTo(movie features.Movie, k int) []SimilarMovie {
+	if i, ok := c.byUrl[movie.Url]; ok {
+		return c.similarMovies(&c.movies[i], k)
+	}
+
+	// The tokens no movie has are given ids of their own, they are never shared anyway
+	unknown := map[string]int32{}
+
+	m, counts := newContentMovie(movie, func(key string, value string) int32 {
+		if id, ok := c.ids[key]; ok {
+			return id
+		}
+
+		id, ok := unknown[key]
+		if !ok {
+			id = int32(len(c.tokens) + len(unknown))
+			unknown[key] = id
+		}
+
+		return id
+	})
+
+	m.themes = tfidf(counts.themes, c.frequencies, len(c.movies))
+	m.description = tfidf(counts.words, c.frequencies, len(c.movies))
+
+	return c.similarMovies(&m, k)
+}
+
+func (c *Content) similarMovies(movie *contentMovie, k int) []SimilarMovie {
+	scores := make([]float64, len(c.movies))
+	exclude := map[int]bool{}
+
+	for j := range c.movies {
+		if c.movies[j].url == movie.url {
+			exclude[j] = true
+		} else {
+			scores[j] = c.similarity(movie, &c.movies[j], false).score
+		}
+	}
+
+	var similar []SimilarMovie
+	for _, j := range topScores(scores, exclude, k) {
+		explained := c.similarity(movie, &c.movies[j], true)
+		similar = append(similar, SimilarMovie{
+			Id:            c.movies[j].id,
+			Url:           c.movies[j].url,
+			Score:         explained.score,
+			Contributions: explained.contributions,
+		})
+	}
+
+	return similar
+}
+
+// Recommend recommend the movies the most similar to the watched ones, the score of a movie is the sum of its
+// similarities to the watched movies.
+func (c *Content) Recommend(watched []string, k int) []Recommendation {
+	scores := make([]float64, len(c.movies))
+	exclude := map[int]bool{}
+
+	for _, url := range watched {
+		i, ok := c.byUrl[url]
+		if !ok || exclude[i] {
+			continue
+		}
+
+		exclude[i] = true
+
+		for j := range c.movies {
+			scores[j] += c.similarity(&c.movies[i], &c.movies[j], false).score
+		}
+	}
+
+	var recommendations []Recommendation
+	for _, j := range topScores(scores, exclude, k) {
+		recommendations = append(recommendations, Recommendation{Url: c.movies[j].url, Score: scores[j]})
+	}
+
+	return recommendations
+}
+
+type explanation struct {
+	score         float64
+	contributions []Contribution
+}
+
+// similarity compute the similarity of two movies, the contributions are only given if explain is set.
+func (c *Content) similarity(a *contentMovie, b *contentMovie, explain bool) explanation {
+	var result explanation
+
+	for _, feature := range []struct {
+		name   string
+		weight float64
+		// similarity return the similarity of the feature and the shared tokens, the most shared first
+		similarity func() (float64, []int32)
+	}{
+		{FeatureThemes, c.Weights.Themes, func() (float64, []int32) { return cosine(a.themes, b.themes, explain) }},
+		{FeatureDescription, c.Weights.Description, func() (float64, []int32) { return cosine(a.description, b.description, explain) }},
+		{FeatureDirectors, c.Weights.Directors, func() (float64, []int32) { return overlap(a.directors, b.directors, explain) }},
+		{FeatureActors, c.Weights.Actors, func() (float64, []int32) { return overlap(a.actors, b.actors, explain) }},
+		{FeatureGenres, c.Weights.Genres, func() (float64, []int32) { return jaccard(a.genres, b.genres, explain) }},
+	} {
+		if feature.weight == 0 {
+			continue
+		}
+
+		similarity, shared := feature.similarity()
+		if similarity <= 0 {
+			continue
+		}
+
+		result.score += feature.weight * similarity
+
+		if explain {
+			contribution := Contribution{Feature: feature.name, Similarity: similarity, Score: feature.weight * similarity}
+			for _, token := range shared[:min(maxShared, len(shared))] {
+				contribution.Shared = append(contribution.Shared, c.tokens[token])
+			}
+
+			result.contributions = append(result.contributions, contribution)
+		}
+	}
+
+	slices.SortStableFunc(result.contributions, func(a, b Contribution) int { return cmp.Compare(b.Score, a.Score) })
+
+	return result
+}
+
+// cosine return the cosine of two normalized vectors and, if withTokens is set, their shared tokens by contribution.
+func cosine(a []term, b []term, withTokens bool) (float64, []int32) {
+	var dot float64
+	var common []term
+
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i].token < b[j].token:
+			i++
+		case a[i].token > b[j].token:
+			j++
+		default:
+			dot += a[i].weight * b[j].weight
+			if withTokens {
+				common = append(common, term{a[i].token, a[i].weight * b[j].weight})
+			}
+
+			i++
+			j++
+		}
+	}
+
+	slices.SortStableFunc(common, func(x, y term) int { return cmp.Compare(y.weight, x.weight) })
+
+	tokens := make([]int32, len(common))
+	for i, t := range common {
+		tokens[i] = t.token
+	}
+
+	return dot, tokens
+}
+
+// overlap return the overlap coefficient of two sorted sets, the number of shared tokens over the size of the smallest.
+func overlap(a []int32, b []int32, withTokens bool) (float64, []int32) {
+	if len(a) == 0 || len(b) == 0 {
+		return 0, nil
+	}
+
+	common := intersection(a, b, withTokens)
+
+	return float64(common.count) / float64(min(len(a), len(b))), common.tokens
+}
+
+// jaccard return the Jaccard index of two sorted sets, the number of shared tokens over the size of their union.
+func jaccard(a []int32, b []int32, withTokens bool) (float64, []int32) {
+	if len(a) == 0 || len(b) == 0 {
+		return 0, nil
+	}
+
+	common := intersection(a, b, withTokens)
+
+	return float64(common.count) / float64(len(a)+len(b)-common.count), common.tokens
+}
+
+type shared struct {
+	count  int
+	tokens []int32
+}
+
+func intersection(a []int32, b []int32, withTokens bool) shared {
+	var result shared
+
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result.count++
+			if withTokens {
+				result.tokens = append(result.tokens, a[i])
+			}
+
+			i++
+			j++
+		}
+	}
+
+	return result
+}
+
+// topScores return the positions of the k highest scores those are not excluded, the ties are broken by position.
+// The scores of 0 or less are skipped.
+func topScores(scores []float64, exclude map[int]bool, k int) []int {
+	positions := make([]int, 0, len(scores))
+	for i, score := range scores {
+		if score > 0 && !exclude[i] {
+			positions = append(positions, i)
+		}
+	}
+
+	slices.SortStableFunc(positions, func(a, b int) int { return cmp.Compare(scores[b], scores[a]) })
+
+	return positions[:min(k, len(positions))]
+}
+
+// stopWords are the common english words those say nothing of a movie.
+var stopWords = map[string]bool{}
+
+func init() {
+	for _, word := range strings.Fields(`about after again against all also and any are because been before being
+		between both but can could did does doing down during each few for from further had has have having her here
+		hers herself him himself his how into its itself just more most must not now off once only other our ours out
+		over own same she should some such than that the their theirs them themselves then there these they this those
+		through too under until very was were what when where which while who whom why will with would you your yours
+		yourself film movie story`) {
+		stopWords[word] = true
+	}
+}
+
+// Words return the words of a description used by the TF-IDF, lowercase and without the stop words and the words of
+// less than 3 letters.
+func Words(text string) []string {
+	var words []string
+
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	}) {
+		word = strings.Trim(word, "'")
+		word = strings.TrimSuffix(word, "'s")
+
+		if len([]rune(word)) >= 3 && !stopWords[word] {
+			words = append(words, word)
+		}
+	}
+
+	return words
+}
@@ -0,0 +1,110 @@
+package recommend
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/leminhohoho/movie-lens/scraper/pkg/features"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/models"
+)
+
+func newTestMovie(id int, url string, desc string) features.Movie {
+	return features.Movie{Movie: models.Movie{Id: id, Url: url, Name: url, Desc: &desc}}
+}
+
+func TestContent(t *testing.T) {
+	dune := newTestMovie(1, "/film/dune/", "Paul Atreides travels to the desert planet Arrakis.")
+	dune.Genres = []string{"adventure", "science fiction"}
+	dune.Themes = []string{"epic heroes", "sci-fi monster"}
+	dune.Directors = []string{"/director/denis-villeneuve/"}
+	dune.Actors = []string{"/actor/timothee-chalamet/", "/actor/zendaya/"}
+
+	duneTwo := newTestMovie(2, "/film/dune-part-two/", "Paul Atreides unites with the Fremen of the desert planet Arrakis.")
+	duneTwo.Genres = []string{"adventure", "science fiction"}
+	duneTwo.Themes = []string{"epic heroes", "war"}
+	duneTwo.Directors = []string{"/director/denis-villeneuve/"}
+	duneTwo.Actors = []string{"/actor/austin-butler/", "/actor/timothee-chalamet/", "/actor/zendaya/"}
+
+	arrival := newTestMovie(3, "/film/arrival/", "A linguist works with the military to communicate with alien lifeforms.")
+	arrival.Genres = []string{"drama", "science fiction"}
+	arrival.Directors = []string{"/director/denis-villeneuve/"}
+
+	barbie := newTestMovie(4, "/film/barbie/", "Barbie and Ken are having the time of their lives.")
+	barbie.Genres = []string{"comedy"}
+
+	content := NewContent([]features.Movie{barbie, arrival, duneTwo, dune}, DefaultContentWeights())
+
+	similar, err := content.SimilarMovies(1, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Barbie shares nothing with dune
+	if len(similar) != 2 || similar[0].Url != "/film/dune-part-two/" || similar[1].Url != "/film/arrival/" {
+		t.Fatalf("unexpected similar movies %#v", similar)
+	}
+
+	var sum float64
+	byFeature := map[string]Contribution{}
+
+	for _, contribution := range similar[0].Contributions {
+		sum += contribution.Score
+		byFeature[contribution.Feature] = contribution
+	}
+
+	if math.Abs(sum-similar[0].Score) > 1e-9 || len(byFeature) != 5 {
+		t.Fatalf("expected the 5 features to contribute to the score, got %#v", similar[0])
+	}
+
+	if genres := byFeature[FeatureGenres]; genres.Similarity != 1 || !slices.Equal(genres.Shared, []string{"adventure", "science fiction"}) {
+		t.Fatalf("unexpected genres contribution %#v", genres)
+	}
+
+	if actors := byFeature[FeatureActors]; actors.Similarity != 1 || actors.Score != DefaultContentWeights().Actors {
+		t.Fatalf("expected the actors of dune to all be in dune part two, got %#v", actors)
+	}
+
+	// Epic heroes is in both movies, so it weights less than sci-fi monster and war
+	if themes := byFeature[FeatureThemes]; !slices.Equal(themes.Shared, []string{"epic heroes"}) || themes.Similarity <= 0 || themes.Similarity >= 0.5 {
+		t.Fatalf("unexpected themes contribution %#v", themes)
+	}
+
+	if description := byFeature[FeatureDescription]; !slices.Contains(description.Shared, "arrakis") || slices.Contains(description.Shared, "the") {
+		t.Fatalf("unexpected description contribution %#v", description)
+	}
+
+	if !slices.IsSortedFunc(similar[0].Contributions, func(a, b Contribution) int { return cmp.Compare(b.Score, a.Score) }) {
+		t.Fatalf("expected the contributions to be sorted %#v", similar[0].Contributions)
+	}
+
+	if _, err := content.SimilarMovies(42, 5); err == nil {
+		t.Fatal("expected an error for an unknown movie")
+	}
+
+	// A movie scraped since is compared with the idf of the movies, its new tokens are never shared
+	sequel := dune
+	sequel.Id, sequel.Url = 5, "/film/dune-messiah/"
+	sequel.Themes = append(slices.Clone(dune.Themes), "prophecy")
+
+	if got := content.SimilarTo(sequel, 5); len(got) != 3 || got[0].Url != "/film/dune/" || got[0].Score <= similar[0].Score {
+		t.Fatalf("unexpected movies similar to a new movie %#v", got)
+	}
+
+	if got := content.SimilarTo(dune, 5); len(got) != len(similar) || got[0].Score != similar[0].Score {
+		t.Fatalf("expected the movies similar to dune, got %#v", got)
+	}
+
+	// Both dunes are as similar to arrival, the tie is broken by id
+	if got := urls(content.Recommend([]string{"/film/arrival/", "/film/unknown/"}, 5)); !slices.Equal(got, []string{"/film/dune/", "/film/dune-part-two/"}) {
+		t.Fatalf("unexpected recommendations %v", got)
+	}
+}
+
+func TestWords(t *testing.T) {
+	got := Words("The Fremen's war: Paul and Chani fight for Arrakis, in 10191.")
+	if !slices.Equal(got, []string{"fremen", "war", "paul", "chani", "fight", "arrakis", "10191"}) {
+		t.Fatalf("unexpected words %v", got)
+	}
+}
@@ -0,0 +1,77 @@
+package recommend
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/leminhohoho/movie-lens/scraper/pkg/features"
+)
+
+// Item is a movie a user interacted with, and how much the interaction counts.
+type Item struct {
+	Movie  int
+	Weight float32
+}
+
+// Interactions are the movies every user interacted with, the users and the movies are given dense ids in the order they appear.
+type Interactions struct {
+	Users  features.Index
+	Movies features.Index
+	// ByUser are the items of every user by user id, there is at most one item per movie
+	ByUser [][]Item
+	// ByMovie are the items of every movie by movie id, with the user id as their movie
+	ByMovie [][]Item
+}
+
+// NewInteractions aggregate the activities by user and movie, the weight of a movie is the highest [Weight] of its activities.
+func NewInteractions(activities []features.Activity) *Interactions {
+	interactions := &Interactions{}
+	weights := []map[int]float32{}
+
+	for _, activity := range activities {
+		user := interactions.Users.Add(activity.UserUrl)
+		movie := interactions.Movies.Add(activity.MovieUrl)
+
+		if user == len(weights) {
+			weights = append(weights, map[int]float32{})
+		}
+
+		weights[user][movie] = max(weights[user][movie], Weight(activity))
+	}
+
+	interactions.ByUser = make([][]Item, len(weights))
+	interactions.ByMovie = make([][]Item, interactions.Movies.Len())
+
+	for user, movies := range weights {
+		for movie, weight := range movies {
+			interactions.ByUser[user] = append(interactions.ByUser[user], Item{Movie: movie, Weight: weight})
+		}
+
+		slices.SortFunc(interactions.ByUser[user], func(a, b Item) int { return cmp.Compare(a.Movie, b.Movie) })
+	}
+
+	// The users are visited in order, so the items of every movie are ordered by user
+	for user, items := range interactions.ByUser {
+		for _, item := range items {
+			interactions.ByMovie[item.Movie] = append(interactions.ByMovie[item.Movie], Item{Movie: user, Weight: item.Weight})
+		}
+	}
+
+	return interactions
+}
+
+// Weight return how much an activity tells about the taste of the user: 1 for a movie watched, scaled by the rating
+// from 0.2 for half a star to 2 for five stars, plus 1 if the movie is loved.
+func Weight(activity features.Activity) float32 {
+	weight := float32(1)
+
+	if activity.Rating != nil {
+		weight = *activity.Rating / 2.5
+	}
+
+	if activity.IsLoved {
+		weight++
+	}
+
+	return weight
+}
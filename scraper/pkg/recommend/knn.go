@@ -0,0 +1,111 @@
+package recommend
+
+import (
+	"cmp"
+	"math"
+	"slices"
+
+	"github.com/leminhohoho/movie-lens/scraper/pkg/features"
+)
+
+// DefaultNeighbours is the number of most similar movies kept for every movie by [New].
+const DefaultNeighbours = 50
+
+// Neighbour is a movie similar to another, with their similarity.
+type Neighbour struct {
+	Movie      int
+	Similarity float64
+}
+
+// ItemKNN recommend the movies similar to the watched ones, two movies are similar if the same users interacted with them.
+// The similarity is the cosine of the weights of the interactions of the users with the movies.
+type ItemKNN struct {
+	movies *features.Index
+	// neighbours are the most similar movies of every movie, the most similar first, by movie id
+	neighbours [][]Neighbour
+}
+
+// NewItemKNN compute the similarities between the movies and keep the given number of most similar movies for each of them.
+func NewItemKNN(interactions *Interactions, neighbours int) *ItemKNN {
+	n := interactions.Movies.Len()
+
+	norms := make([]float64, n)
+	for movie, items := range interactions.ByMovie {
+		for _, item := range items {
+			norms[movie] += float64(item.Weight) * float64(item.Weight)
+		}
+
+		norms[movie] = math.Sqrt(norms[movie])
+	}
+
+	knn := &ItemKNN{movies: &interactions.Movies, neighbours: make([][]Neighbour, n)}
+
+	// dots are the dot products of the current movie with every other, touched are the movies those are not 0
+	dots := make([]float64, n)
+	var touched []int
+
+	for movie, items := range interactions.ByMovie {
+		for _, item := range items {
+			for _, other := range interactions.ByUser[item.Movie] {
+				if other.Movie == movie {
+					continue
+				}
+
+				if dots[other.Movie] == 0 {
+					touched = append(touched, other.Movie)
+				}
+
+				dots[other.Movie] += float64(item.Weight) * float64(other.Weight)
+			}
+		}
+
+		candidates := make([]Neighbour, 0, len(touched))
+		for _, other := range touched {
+			candidates = append(candidates, Neighbour{Movie: other, Similarity: dots[other] / (norms[movie] * norms[other])})
+			dots[other] = 0
+		}
+
+		touched = touched[:0]
+
+		slices.SortFunc(candidates, func(a, b Neighbour) int {
+			if a.Similarity != b.Similarity {
+				return cmp.Compare(b.Similarity, a.Similarity)
+			}
+
+			return cmp.Compare(a.Movie, b.Movie)
+		})
+
+		knn.neighbours[movie] = slices.Clip(candidates[:min(neighbours, len(candidates))])
+	}
+
+	return knn
+}
+
+// Neighbours return the most similar movies of the movie with the given url, the most similar first.
+func (knn *ItemKNN) Neighbours(url string) []Recommendation {
+	id, ok := knn.movies.Id(url)
+	if !ok {
+		return nil
+	}
+
+	similar := make([]Recommendation, len(knn.neighbours[id]))
+	for i, neighbour := range knn.neighbours[id] {
+		similar[i] = Recommendation{Url: knn.movies.Keys[neighbour.Movie], Score: neighbour.Similarity}
+	}
+
+	return similar
+}
+
+// Recommend score every movie by the sum of its similarities with the watched movies it is a neighbour of.
+func (knn *ItemKNN) Recommend(watched []string, k int) []Recommendation {
+	exclude := watchedIds(knn.movies, watched)
+	scores := make([]float64, len(knn.neighbours))
+
+	for id := range exclude {
+		for _, neighbour := range knn.neighbours[id] {
+			scores[neighbour.Movie] += neighbour.Similarity
+		}
+	}
+
+	return topK(knn.movies, scores, exclude, k)
+}
@@ -0,0 +1,73 @@
+package recommend
+
+import (
+	"github.com/leminhohoho/movie-lens/scraper/pkg/features"
+)
+
+// Popularity recommend the movies the most users interacted with, whatever the user watched.
+type Popularity struct {
+	movies *features.Index
+	// counts are the number of users of every movie, by movie id
+	counts []float64
+}
+
+func NewPopularity(interactions *Interactions) *Popularity {
+	counts := make([]float64, interactions.Movies.Len())
+	for movie, items := range interactions.ByMovie {
+		counts[movie] = float64(len(items))
+	}
+
+	return &Popularity{movies: &interactions.Movies, counts: counts}
+}
+
+// Recommend return the most popular movies not watched, the score is the number of users of the movie.
+func (p *Popularity) Recommend(watched []string, k int) []Recommendation {
+	return topK(p.movies, p.counts, watchedIds(p.movies, watched), k)
+}
+
+// GenrePopularity recommend the popular movies of the genres the user watches the most.
+type GenrePopularity struct {
+	*Popularity
+	// genres are the genres of every movie, by movie id
+	genres [][]string
+}
+
+func NewGenrePopularity(interactions *Interactions, movies map[string]features.Movie) *GenrePopularity {
+	genres := make([][]string, interactions.Movies.Len())
+	for id, url := range interactions.Movies.Keys {
+		genres[id] = movies[url].Genres
+	}
+
+	return &GenrePopularity{Popularity: NewPopularity(interactions), genres: genres}
+}
+
+// Recommend score every movie by its number of users times the share of the watched movies in its genres, averaged over
+// its genres. The most popular movies are recommended if none of the watched movies is known.
+func (g *GenrePopularity) Recommend(watched []string, k int) []Recommendation {
+	exclude := watchedIds(g.movies, watched)
+	if len(exclude) == 0 {
+		return g.Popularity.Recommend(watched, k)
+	}
+
+	shares := map[string]float64{}
+	for id := range exclude {
+		for _, genre := range g.genres[id] {
+			shares[genre] += 1 / float64(len(exclude))
+		}
+	}
+
+	scores := make([]float64, len(g.counts))
+
+	for id, count := range g.counts {
+		var share float64
+		for _, genre := range g.genres[id] {
+			share += shares[genre]
+		}
+
+		if len(g.genres[id]) > 0 {
+			scores[id] = count * share / float64(len(g.genres[id]))
+		}
+	}
+
+	return topK(g.movies, scores, exclude, k)
+}
@@ -0,0 +1,124 @@
+package recommend
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+
+	"github.com/leminhohoho/movie-lens/scraper/pkg/features"
+	"gorm.io/gorm"
+)
+
+// Recommendation is a recommended movie with its score, the higher the better.
+// The scores are only comparable between the recommendations of the same recommender.
+type Recommendation struct {
+	Url   string  `json:"url"`
+	Score float64 `json:"score"`
+}
+
+// Recommender recommend movies to a user given the movies the user watched.
+type Recommender interface {
+	// Recommend return at most k movies those are not in watched, the best first.
+	// The watched movies those are unknown to the recommender are ignored.
+	Recommend(watched []string, k int) []Recommendation
+}
+
+// WeightedRecommender is a recommender those also uses how much the user liked the watched movies.
+type WeightedRecommender interface {
+	Recommender
+	// RecommendWeighted is Recommend with the [Weight] of the activity of the user on every watched movie, in the
+	// order of watched.
+	RecommendWeighted(watched []string, weights []float32, k int) []Recommendation
+}
+
+// Models are the names of the recommenders made by [New].
+var Models = []string{"popularity", "genre-popularity", "item-knn", "als", "content"}
+
+// Data is what the recommenders are trained on.
+type Data struct {
+	Interactions *Interactions
+	// Movies are the movies with their metadata, by url
+	Movies map[string]features.Movie
+}
+
+// LoadData read every activity and movie of db.
+func LoadData(db *gorm.DB) (*Data, error) {
+	activities, err := features.LoadActivities(db)
+	if err != nil {
+		return nil, err
+	}
+
+	movies, err := features.LoadMovies(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewData(activities, movies), nil
+}
+
+func NewData(activities []features.Activity, movies []features.Movie) *Data {
+	data := &Data{Interactions: NewInteractions(activities), Movies: make(map[string]features.Movie, len(movies))}
+	for _, movie := range movies {
+		data.Movies[movie.Url] = movie
+	}
+
+	return data
+}
+
+// New train the recommender of the given model, which is one of [Models], with its default options.
+func New(model string, data *Data) (Recommender, error) {
+	switch model {
+	case "popularity":
+		return NewPopularity(data.Interactions), nil
+	case "genre-popularity":
+		return NewGenrePopularity(data.Interactions, data.Movies), nil
+	case "item-knn":
+		return NewItemKNN(data.Interactions, DefaultNeighbours), nil
+	case "als":
+		return TrainALS(data.Interactions, DefaultALSOptions(), slog.New(slog.DiscardHandler))
+	case "content":
+		return NewContent(slices.Collect(maps.Values(data.Movies)), DefaultContentWeights()), nil
+	default:
+		return nil, fmt.Errorf("unknown model %s, expected one of %v", model, Models)
+	}
+}
+
+// topK return the k movies of the highest scores those are not excluded, the ties are broken by movie id.
+// The movies with a score of 0 or less are never recommended.
+func topK(movies *features.Index, scores []float64, exclude map[int]bool, k int) []Recommendation {
+	ids := make([]int, 0, len(scores))
+	for id, score := range scores {
+		if score > 0 && !exclude[id] {
+			ids = append(ids, id)
+		}
+	}
+
+	slices.SortFunc(ids, func(a, b int) int {
+		if scores[a] != scores[b] {
+			return cmp.Compare(scores[b], scores[a])
+		}
+
+		return cmp.Compare(a, b)
+	})
+
+	recommendations := make([]Recommendation, 0, min(k, len(ids)))
+	for _, id := range ids[:min(k, len(ids))] {
+		recommendations = append(recommendations, Recommendation{Url: movies.Keys[id], Score: scores[id]})
+	}
+
+	return recommendations
+}
+
+// watchedIds return the ids of the watched movies those are in movies.
+func watchedIds(movies *features.Index, watched []string) map[int]bool {
+	ids := make(map[int]bool, len(watched))
+	for _, url := range watched {
+		if id, ok := movies.Id(url); ok {
+			ids[id] = true
+		}
+	}
+
+	return ids
+}
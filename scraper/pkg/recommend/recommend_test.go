@@ -0,0 +1,112 @@
+package recommend
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/leminhohoho/movie-lens/scraper/pkg/features"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/models"
+)
+
+// newTestData return the activities of users those each watched the given movies, and the genres of the movies.
+func newTestData(watches map[string][]string, genres map[string][]string) *Data {
+	var activities []features.Activity
+
+	// The users are visited in order, so the ids of the movies are the same on every run
+	for _, user := range slices.Sorted(maps.Keys(watches)) {
+		for _, movie := range watches[user] {
+			activities = append(activities, features.Activity{UserUrl: user, MovieUrl: movie, Date: time.Now(), IsWatch: true})
+		}
+	}
+
+	var movies []features.Movie
+	for url, g := range genres {
+		movies = append(movies, features.Movie{Movie: models.Movie{Url: url, Name: url}, Genres: g})
+	}
+
+	return NewData(activities, movies)
+}
+
+func urls(recommendations []Recommendation) []string {
+	result := make([]string, len(recommendations))
+	for i, recommendation := range recommendations {
+		result[i] = recommendation.Url
+	}
+
+	return result
+}
+
+var testWatches = map[string][]string{
+	"/a/": {"/film/dune/", "/film/dune-part-two/", "/film/arrival/"},
+	"/b/": {"/film/dune/", "/film/dune-part-two/", "/film/barbie/"},
+	"/c/": {"/film/dune/", "/film/barbie/"},
+	"/d/": {"/film/barbie/", "/film/lady-bird/"},
+	"/e/": {"/film/barbie/", "/film/lady-bird/"},
+}
+
+var testGenres = map[string][]string{
+	"/film/dune/":          {"science fiction", "adventure"},
+	"/film/dune-part-two/": {"science fiction", "adventure"},
+	"/film/arrival/":       {"science fiction", "drama"},
+	"/film/barbie/":        {"comedy"},
+	"/film/lady-bird/":     {"comedy", "drama"},
+}
+
+func TestPopularity(t *testing.T) {
+	data := newTestData(testWatches, testGenres)
+
+	recommendations := NewPopularity(data.Interactions).Recommend([]string{"/film/barbie/"}, 2)
+
+	if got := urls(recommendations); len(got) != 2 || got[0] != "/film/dune/" || got[1] != "/film/dune-part-two/" {
+		t.Fatalf("unexpected recommendations %v", got)
+	}
+
+	if recommendations[0].Score != 3 {
+		t.Fatalf("expected the score to be the number of users, got %f", recommendations[0].Score)
+	}
+
+	// Lady bird is less popular than dune part two, but it is the only other comedy
+	recommendations = NewGenrePopularity(data.Interactions, data.Movies).Recommend([]string{"/film/barbie/"}, 1)
+
+	if got := urls(recommendations); len(got) != 1 || got[0] != "/film/lady-bird/" {
+		t.Fatalf("unexpected recommendations %v", got)
+	}
+}
+
+func TestItemKNN(t *testing.T) {
+	data := newTestData(testWatches, testGenres)
+
+	knn := NewItemKNN(data.Interactions, DefaultNeighbours)
+
+	if neighbours := knn.Neighbours("/film/dune-part-two/"); len(neighbours) == 0 || neighbours[0].Url != "/film/dune/" {
+		t.Fatalf("expected dune to be the most similar to dune part two, got %v", neighbours)
+	}
+
+	got := urls(knn.Recommend([]string{"/film/dune/", "/film/unknown/"}, 2))
+	if len(got) != 2 || got[0] != "/film/dune-part-two/" {
+		t.Fatalf("unexpected recommendations %v", got)
+	}
+
+	// The movies of no common user are never recommended
+	if got := urls(NewItemKNN(data.Interactions, 1).Recommend([]string{"/film/lady-bird/"}, 10)); len(got) != 1 || got[0] != "/film/barbie/" {
+		t.Fatalf("unexpected recommendations %v", got)
+	}
+
+	if _, err := New("unknown", data); err == nil {
+		t.Fatal("expected an error for an unknown model")
+	}
+}
+
+func TestWeight(t *testing.T) {
+	rating := float32(5)
+
+	if weight := Weight(features.Activity{Rating: &rating, IsLoved: true}); weight != 3 {
+		t.Fatalf("expected a loved five stars movie to weight 3, got %f", weight)
+	}
+
+	if weight := Weight(features.Activity{IsWatch: true}); weight != 1 {
+		t.Fatalf("expected a watched movie to weight 1, got %f", weight)
+	}
+}
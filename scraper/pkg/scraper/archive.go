@@ -0,0 +1,208 @@
+package scraper
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	archiveRecord = "record"
+	archiveReplay = "replay"
+)
+
+const archiveTimeFormat = "20060102T150405.000000000Z"
+
+var ErrNotArchived = errors.New("page not found in archive")
+
+// Archive store fetched pages on disk so that they can be replayed later.
+// Every snapshot is gzipped and stored at [dir]/[escaped url]/[fetch time].html.gz, a page can have many snapshots.
+type Archive struct {
+	dir string
+}
+
+func NewArchive(dir string) (*Archive, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &Archive{dir: dir}, nil
+}
+
+// Put store a snapshot of the page at url fetched at the given time.
+func (a *Archive) Put(pageUrl string, fetchedAt time.Time, html string) error {
+	pageDir := path.Join(a.dir, url.PathEscape(pageUrl))
+
+	if err := os.MkdirAll(pageDir, 0755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(pageDir, ".snapshot-*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	w := gzip.NewWriter(f)
+	w.Name = pageUrl
+	w.ModTime = fetchedAt
+
+	if _, err := io.WriteString(w, html); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	// The snapshot is written to a temporary file first so that a crash never leaves a truncated snapshot behind
+	return os.Rename(f.Name(), path.Join(pageDir, fetchedAt.UTC().Format(archiveTimeFormat)+".html.gz"))
+}
+
+// Snapshots list the fetch times of every snapshot of the page at url, from oldest to newest.
+func (a *Archive) Snapshots(pageUrl string) ([]time.Time, error) {
+	entries, err := os.ReadDir(path.Join(a.dir, url.PathEscape(pageUrl)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	snapshots := []time.Time{}
+
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".html.gz")
+		if !ok {
+			continue
+		}
+
+		fetchedAt, err := time.Parse(archiveTimeFormat, name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid snapshot %s of %s: %w", entry.Name(), pageUrl, err)
+		}
+
+		snapshots = append(snapshots, fetchedAt)
+	}
+
+	slices.SortFunc(snapshots, func(a, b time.Time) int { return a.Compare(b) })
+
+	return snapshots, nil
+}
+
+// Get read the snapshot of the page at url fetched at the given time.
+func (a *Archive) Get(pageUrl string, fetchedAt time.Time) (string, error) {
+	f, err := os.Open(path.Join(a.dir, url.PathEscape(pageUrl), fetchedAt.UTC().Format(archiveTimeFormat)+".html.gz"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("%w: %s at %s", ErrNotArchived, pageUrl, fetchedAt.Format(time.RFC3339))
+		}
+
+		return "", err
+	}
+
+	defer f.Close()
+
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		return "", err
+	}
+
+	defer r.Close()
+
+	html, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	return string(html), nil
+}
+
+// Latest read the newest snapshot of the page at url.
+func (a *Archive) Latest(pageUrl string) (string, time.Time, error) {
+	snapshots, err := a.Snapshots(pageUrl)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if len(snapshots) == 0 {
+		return "", time.Time{}, fmt.Errorf("%w: %s", ErrNotArchived, pageUrl)
+	}
+
+	fetchedAt := snapshots[len(snapshots)-1]
+
+	html, err := a.Get(pageUrl, fetchedAt)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return html, fetchedAt, nil
+}
+
+// recordingFetcher store every page fetched by the underlying fetcher to the archive.
+type recordingFetcher struct {
+	Fetcher
+	archive *Archive
+	logger  *slog.Logger
+}
+
+func (f *recordingFetcher) Fetch(ctx context.Context, url string) (*goquery.Document, error) {
+	fetchedAt := time.Now()
+
+	doc, err := f.Fetcher.Fetch(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	html, err := doc.Html()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.archive.Put(url, fetchedAt, html); err != nil {
+		return nil, err
+	}
+
+	f.logger.Debug("page recorded", "url", url, "fetched_at", fetchedAt)
+
+	return doc, nil
+}
+
+// replayFetcher read pages from the archive instead of the network, the newest snapshot of a page is used.
+type replayFetcher struct {
+	archive *Archive
+	logger  *slog.Logger
+}
+
+func (f *replayFetcher) Fetch(ctx context.Context, url string) (*goquery.Document, error) {
+	html, fetchedAt, err := f.archive.Latest(url)
+	if errors.Is(err, ErrNotArchived) {
+		// A page missing from the archive is handled like a page removed from letterboxd
+		return nil, &JobError{Class: ClassRemoved, Url: url, Err: err}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f.logger.Debug("page replayed", "url", url, "fetched_at", fetchedAt)
+
+	return goquery.NewDocumentFromReader(strings.NewReader(html))
+}
@@ -0,0 +1,550 @@
+package scraper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/leminhohoho/movie-lens/scraper/pkg/config"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/logger"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/models"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/scraper/letterboxdtest"
+	"github.com/parquet-go/parquet-go"
+)
+
+// newFakeSiteScraper create a scraper of the fake letterboxd with the given fetcher backend for every page type.
+// wrap, if not nil, wraps the handler of the fake letterboxd.
+func newFakeSiteScraper(t *testing.T, fetcher string, wrap func(http.Handler) http.Handler) *Scraper {
+	handler := letterboxdtest.NewHandler(letterboxdtest.DefaultSite())
+	if wrap != nil {
+		handler = wrap(handler)
+	}
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+
+	cfg := config.Default()
+	cfg.DBPath = path.Join(dir, "letterboxd.db")
+	cfg.BaseUrl = server.URL
+	cfg.Interval = 1000
+	cfg.Workers = 2
+	cfg.Headless = true
+	cfg.ScreenshotDir = dir
+	cfg.Fetchers = config.Fetchers{Members: fetcher, Films: fetcher, Movie: fetcher, Activity: fetcher, Review: fetcher}
+
+	l, err := logger.NewLogger(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scp, err := NewScraper(cfg, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { scp.Close() })
+
+	return scp
+}
+
+// crawlFakeSite run a whole crawl against the fake letterboxd with the given fetcher backend for every page type.
+func crawlFakeSite(t *testing.T, fetcher string) *Scraper {
+	scp := newFakeSiteScraper(t, fetcher, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*5)
+	defer cancel()
+
+	summary, err := scp.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summary.Interrupted {
+		t.Fatal("crawl timed out")
+	}
+
+	return scp
+}
+
+func assertFakeSiteCrawled(t *testing.T, scp *Scraper) {
+	counts := map[string]int64{
+		"users":            2,
+		"movies":           3,
+		"users_and_movies": 5,
+		"crews":            9,
+		"genres":           4,
+		"releases":         3,
+	}
+
+	for table, expected := range counts {
+		var count int64
+
+		if err := scp.db.Table(table).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		}
+
+		if count != expected {
+			t.Errorf("expected %d rows in %s, got %d", expected, table, count)
+		}
+	}
+
+	type activity struct {
+		User    string
+		Movie   string
+		IsWatch bool
+		IsLoved bool
+		Rating  *float32
+		Review  *string
+	}
+
+	var activities []activity
+
+	if err := scp.db.Table("users_and_movies").
+		Select("users.url AS user, movies.url AS movie, is_watch, is_loved, rating, review").
+		Joins("JOIN users ON users.id = users_and_movies.user_id").
+		Joins("JOIN movies ON movies.id = users_and_movies.movie_id").
+		Find(&activities).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, a := range activities {
+		switch {
+		case a.User == "/karsten/" && a.Movie == "/film/godzilla-kong-the-new-empire/":
+			if !a.IsWatch || a.Rating == nil || *a.Rating != 3.5 {
+				t.Errorf("unexpected rated activity %#v", a)
+			}
+		case a.User == "/karsten/" && a.Movie == "/film/dune-part-two/":
+			if !a.IsLoved || a.Review == nil || *a.Review != "Paul becomes the villain of his own story." {
+				t.Errorf("unexpected spoiler review activity %#v", a)
+			}
+		case a.User == "/davidehrlich/" && a.Movie == "/film/perfect-days-2023/":
+			if a.Review != nil || a.Rating == nil || *a.Rating != 4 {
+				t.Errorf("unexpected removed review activity %#v", a)
+			}
+		}
+	}
+
+	var pending int64
+
+	if err := scp.db.Table("crawl_jobs").Where("status != ?", statusDone).Count(&pending).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if pending != 0 {
+		t.Errorf("expected every job to be done, %d are not", pending)
+	}
+}
+
+func TestCrawlFakeSiteHttp(t *testing.T) {
+	assertFakeSiteCrawled(t, crawlFakeSite(t, fetcherHttp))
+}
+
+func TestCrawlFakeSiteChromedp(t *testing.T) {
+	found := false
+
+	for _, browser := range []string{"headless-shell", "chromium", "chromium-browser", "google-chrome", "google-chrome-stable"} {
+		if _, err := exec.LookPath(browser); err == nil {
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		t.Skip("no chrome executable found")
+	}
+
+	assertFakeSiteCrawled(t, crawlFakeSite(t, fetcherChromedp))
+}
+
+func TestScrapeUserFakeSite(t *testing.T) {
+	scp := newFakeSiteScraper(t, fetcherHttp, nil)
+
+	if err := scp.ScrapeUser(context.Background(), "/karsten/"); err != nil {
+		t.Fatal(err)
+	}
+
+	var user models.User
+
+	if err := scp.db.Table("users").Where("url = ?", "/karsten/").First(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if user.Name != "karsten" {
+		t.Errorf("unexpected user %#v", user)
+	}
+
+	stats, err := scp.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Rows["users"] != 1 || stats.Rows["movies"] != 3 || stats.Rows["users_and_movies"] != 3 {
+		t.Errorf("unexpected rows after scraping a single user %v", stats.Rows)
+	}
+}
+
+func TestImportUserFakeSite(t *testing.T) {
+	removedUrl := "/karsten/film/dune-part-two/activity"
+
+	scp := newFakeSiteScraper(t, fetcherHttp, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == removedUrl {
+				http.NotFound(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	var progress [][2]int
+
+	// karsten has 3 films on 2 pages, only the 2 latest are imported and one of them is skipped
+	if err := scp.ImportUser(context.Background(), "/karsten/", 1, func(done, total int) {
+		progress = append(progress, [2]int{done, total})
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(progress) != 3 || progress[0] != [2]int{0, 2} || progress[2] != [2]int{2, 2} {
+		t.Errorf("unexpected progress %v", progress)
+	}
+
+	stats, err := scp.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The movie of the removed activity is saved but the activity is skipped
+	if stats.Rows["users"] != 1 || stats.Rows["movies"] != 2 || stats.Rows["users_and_movies"] != 1 {
+		t.Errorf("unexpected rows after importing a single page of a user %v", stats.Rows)
+	}
+
+	if err := scp.ImportUser(context.Background(), "/nobody/", 1, nil); classOf(err) != ClassRemoved {
+		t.Errorf("expected the import of an unknown user to fail, got %v", err)
+	}
+}
+
+// TestScrapeRetries serve pages those fail once to the scrapes outside of the crawl, they must be retried.
+func TestScrapeRetries(t *testing.T) {
+	var failed sync.Map
+
+	scp := newFakeSiteScraper(t, fetcherHttp, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := failed.LoadOrStore(r.URL.Path, true); !ok {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	})
+	scp.retries.delay = 0
+
+	if err := scp.ScrapeMovie(context.Background(), "/film/perfect-days-2023/"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := scp.ScrapeUser(context.Background(), "/karsten/"); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := scp.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Rows["users"] != 1 || stats.Rows["users_and_movies"] != 3 {
+		t.Errorf("unexpected rows after scraping flaky pages %v", stats.Rows)
+	}
+}
+
+// TestCrawlInterrupted stop the crawl in the middle of a job, the job must finish and the crawl must resume where it stopped.
+func TestCrawlInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var requests atomic.Int32
+
+	scp := newFakeSiteScraper(t, fetcherHttp, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if requests.Add(1) == 4 {
+				cancel()
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	summary, err := scp.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !summary.Interrupted || summary.Done == 0 || summary.Pending == 0 {
+		t.Fatalf("unexpected summary of the interrupted crawl %#v", summary)
+	}
+
+	inProgress, err := scp.frontier.count(statusInProgress)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if inProgress != 0 {
+		t.Fatalf("expected the running jobs to finish, %d are still in progress", inProgress)
+	}
+
+	summary, err = scp.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summary.Interrupted || summary.Pending != 0 {
+		t.Fatalf("unexpected summary of the resumed crawl %#v", summary)
+	}
+
+	assertFakeSiteCrawled(t, scp)
+}
+
+// TestCrawlShutdownTimeout stop the crawl while a job is stuck, the job must be put back to the frontier.
+func TestCrawlShutdownTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	scp := newFakeSiteScraper(t, fetcherHttp, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, "/members/") {
+				cancel()
+				<-r.Context().Done()
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	})
+	scp.shutdownTimeout = time.Millisecond * 100
+
+	summary, err := scp.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !summary.Interrupted || summary.Done != 0 || summary.Pending != 1 {
+		t.Fatalf("unexpected summary %#v", summary)
+	}
+
+	var job models.CrawlJob
+
+	if err := scp.db.Table("crawl_jobs").First(&job).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if job.Status != statusPending || job.Attempts != 0 {
+		t.Fatalf("expected the interrupted job to be put back, got %#v", job)
+	}
+}
+
+// TestCrawlFailedJobs serve a removed page and a page those fails once, the crawl must retry the latter and give up on the former without stopping.
+func TestCrawlFailedJobs(t *testing.T) {
+	removedUrl := "/karsten/film/dune-part-two/activity"
+
+	var flaky atomic.Bool
+
+	scp := newFakeSiteScraper(t, fetcherHttp, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.URL.Path == removedUrl:
+				http.NotFound(w, r)
+			case r.URL.Path == "/davidehrlich/film/perfect-days-2023/activity" && !flaky.Swap(true):
+				w.WriteHeader(http.StatusServiceUnavailable)
+			default:
+				next.ServeHTTP(w, r)
+			}
+		})
+	})
+	scp.retries.delay = 0
+
+	summary, err := scp.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summary.Interrupted || summary.Failed != 1 || summary.Pending != 0 {
+		t.Fatalf("unexpected summary %#v", summary)
+	}
+
+	var failedJobs []models.FailedJob
+
+	if err := scp.db.Table("failed_jobs").Find(&failedJobs).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if len(failedJobs) != 1 || failedJobs[0].Url != removedUrl || failedJobs[0].ErrorClass != string(ClassRemoved) || failedJobs[0].Attempts != 1 {
+		t.Fatalf("expected the removed page to be the only failed job, got %#v", failedJobs)
+	}
+
+	var retried models.CrawlJob
+
+	if err := scp.db.Table("crawl_jobs").Where("url = ?", "/davidehrlich/film/perfect-days-2023/activity").First(&retried).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if retried.Status != statusDone || retried.Attempts != 2 {
+		t.Fatalf("expected the flaky page to be done on its second attempt, got %#v", retried)
+	}
+
+	count, err := scp.Requeue(string(ClassRemoved), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := scp.frontier.count(statusPending)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 1 || pending != 1 {
+		t.Fatalf("expected the failed job to be re-queued, %d re-queued and %d pending", count, pending)
+	}
+}
+
+func TestExportParquet(t *testing.T) {
+	scp := crawlFakeSite(t, fetcherHttp)
+	dir := t.TempDir()
+
+	// The crew tab names the role Directors when a movie has several directors
+	if _, err := scp.store.SaveMovie(&models.MovieDetails{
+		Movie: models.Movie{Url: "/film/the-matrix/", Name: "The Matrix"},
+		Crews: []models.Crew{
+			{Url: "/director/lilly-wachowski/", Name: "Lilly Wachowski", Role: "Directors"},
+			{Url: "/director/lana-wachowski/", Name: "Lana Wachowski", Role: "Directors"},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := scp.ExportParquet(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	latest, err := os.ReadFile(path.Join(dir, "LATEST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.TrimSpace(string(latest)) != manifest.Snapshot {
+		t.Fatalf("expected LATEST to be %s, got %s", manifest.Snapshot, latest)
+	}
+
+	if movies := manifest.Datasets["movies"]; movies.Rows != 4 || len(movies.Files) != 2 || movies.PartitionBy != "" {
+		t.Fatalf("expected 4 movies in 2 files, got %#v", movies)
+	}
+
+	// The movies are partitioned by the year of their release, the matrix has no release
+	moviesView := manifest.Datasets["movies_view"]
+	if moviesView.PartitionBy != "release_year" || !slices.Contains(moviesView.Files, "release_year=2024/part-00000.parquet") ||
+		!slices.Contains(moviesView.Files, "release_year=__HIVE_DEFAULT_PARTITION__/part-00000.parquet") {
+		t.Fatalf("expected the movies view to be partitioned by release year, got %#v", moviesView)
+	}
+
+	var movies []movieViewRow
+
+	for _, file := range manifest.Datasets["movies_view"].Files {
+		rows, err := parquet.ReadFile[movieViewRow](path.Join(dir, manifest.Snapshot, "movies_view", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		movies = append(movies, rows...)
+	}
+
+	// The release dates are dates even if the rows hold them as pointers
+	file, err := os.Open(path.Join(dir, manifest.Snapshot, "movies_view", "release_year=2024", "part-00000.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pf, err := parquet.OpenFile(file, info.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if schema := pf.Schema().String(); !strings.Contains(schema, "optional int32 release_date (DATE)") {
+		t.Errorf("expected the release date to be a date\n%s", schema)
+	}
+
+	for _, movie := range movies {
+		if movie.Url == "/film/the-matrix/" && (movie.ReleaseDate != nil ||
+			!slices.Equal(movie.Directors, []string{"Lana Wachowski", "Lilly Wachowski"})) {
+			t.Errorf("expected both directors of the matrix, got %#v", movie)
+		}
+
+		if movie.Url != "/film/dune-part-two/" {
+			continue
+		}
+
+		if movie.ReleaseDate == nil {
+			t.Fatalf("expected the release date of %s", movie.Url)
+		}
+
+		release := time.Unix(int64(*movie.ReleaseDate)*86400, 0).UTC().Format("2006-01-02")
+
+		if release != "2024-02-15" || len(movie.Genres) != 2 || movie.Directors[0] != "Denis Villeneuve" {
+			t.Errorf("unexpected movie view %#v released on %s", movie, release)
+		}
+	}
+
+	var activities []activityViewRow
+
+	for _, file := range manifest.Datasets["activities_view"].Files {
+		if !strings.HasPrefix(file, "year=") {
+			t.Fatalf("expected the activities view to be partitioned by year, got %s", file)
+		}
+
+		rows, err := parquet.ReadFile[activityViewRow](path.Join(dir, manifest.Snapshot, "activities_view", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		activities = append(activities, rows...)
+	}
+
+	if len(activities) != 5 {
+		t.Fatalf("expected the 5 activities, got %d", len(activities))
+	}
+
+	for _, a := range activities {
+		if a.UserUrl == "/karsten/" && a.MovieUrl == "/film/godzilla-kong-the-new-empire/" {
+			if !a.Date.Equal(time.Date(2024, 4, 2, 20, 13, 0, 0, time.UTC)) || a.Rating == nil || *a.Rating != 3.5 {
+				t.Errorf("unexpected activity %#v", a)
+			}
+		}
+	}
+
+	// The first day of the epoch is a date like another, only the dates those can't be parsed are nulls
+	if date, ok := parquetDate("01 Jan 1970"); !ok || date != 0 {
+		t.Errorf("expected 01 Jan 1970 to be day 0, got %d, %t", date, ok)
+	}
+
+	if _, ok := parquetDate("TBA"); ok {
+		t.Error("expected an unparseable date")
+	}
+}
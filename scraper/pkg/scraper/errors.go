@@ -0,0 +1,104 @@
+package scraper
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/leminhohoho/movie-lens/scraper/pkg/config"
+)
+
+// ErrorClass tell why a job failed, the number of retries of a job depends on the class of its error.
+type ErrorClass string
+
+const (
+	// ClassTransient is a network error (e.g. connection reset, timeout)
+	ClassTransient ErrorClass = "transient"
+	// ClassHttp is a 429 or 5xx response
+	ClassHttp ErrorClass = "http"
+	// ClassSelectorTimeout is a page that never gets ready in the browser
+	ClassSelectorTimeout ErrorClass = "selector_timeout"
+	// ClassParse is a page those content can't be extracted
+	ClassParse ErrorClass = "parse"
+	// ClassRemoved is a page that doesn't exist anymore (404 or 410)
+	ClassRemoved ErrorClass = "removed"
+	// ClassInternal is any other error (e.g. the db is unreachable), it stops the crawl
+	ClassInternal ErrorClass = "internal"
+)
+
+// JobError is the error of a job those failed because of the page it scraped, the crawl goes on without that job.
+type JobError struct {
+	Class ErrorClass
+	Url   string
+	// Screenshot is the path to the screenshot of the page when it failed, it is empty if there is none
+	Screenshot string
+	Err        error
+}
+
+func (e *JobError) Error() string {
+	return fmt.Sprintf("%s error on %s: %s", e.Class, e.Url, e.Err)
+}
+
+func (e *JobError) Unwrap() error {
+	return e.Err
+}
+
+// parseError classify err as an error while extracting the content of the page at url.
+func parseError(url string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &JobError{Class: ClassParse, Url: url, Err: err}
+}
+
+// classOf return the class of err, errors those are not a [JobError] are internal.
+func classOf(err error) ErrorClass {
+	var jobErr *JobError
+
+	if errors.As(err, &jobErr) {
+		return jobErr.Class
+	}
+
+	return ClassInternal
+}
+
+// screenshotOf return the screenshot attached to err, if any.
+func screenshotOf(err error) string {
+	var jobErr *JobError
+
+	if errors.As(err, &jobErr) {
+		return jobErr.Screenshot
+	}
+
+	return ""
+}
+
+// retryPolicy decide whether a failed job is retried and how long to wait before retrying it.
+type retryPolicy struct {
+	retries map[ErrorClass]int
+	delay   time.Duration
+}
+
+func newRetryPolicy(cfg *config.Config) retryPolicy {
+	return retryPolicy{
+		retries: map[ErrorClass]int{
+			ClassTransient:       cfg.Retries.Transient,
+			ClassHttp:            cfg.Retries.Http,
+			ClassSelectorTimeout: cfg.Retries.SelectorTimeout,
+			ClassParse:           cfg.Retries.Parse,
+			ClassRemoved:         cfg.Retries.Removed,
+		},
+		delay: time.Second * time.Duration(cfg.RetryDelay),
+	}
+}
+
+// backoff return the delay before the next attempt of a job failed with err after the given number of attempts.
+// It returns false if the job must be given up.
+func (p retryPolicy) backoff(err error, attempts int) (time.Duration, bool) {
+	if attempts > p.retries[classOf(err)] {
+		return 0, false
+	}
+
+	return p.delay * time.Duration(attempts), true
+}
@@ -0,0 +1,159 @@
+package scraper
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path"
+)
+
+// Tables are the tables filled by the scraper, in the order they are exported.
+var Tables = []string{
+	"users",
+	"movies",
+	"crews",
+	"crews_and_movies",
+	"genres",
+	"genres_and_movies",
+	"themes",
+	"themes_and_movies",
+	"studios",
+	"studios_and_movies",
+	"countries_and_movies",
+	"languages_and_movies",
+	"releases",
+	"users_and_movies",
+}
+
+// Stats are the number of rows in every table, the number of crawl jobs by status and the failed jobs by error class.
+type Stats struct {
+	Rows     map[string]int64
+	Jobs     map[string]int64
+	Failures map[string]int64
+}
+
+// Stats count the rows of every scraped table, the crawl jobs by status and the failed jobs by error class.
+func (s *Scraper) Stats() (Stats, error) {
+	stats := Stats{Rows: map[string]int64{}, Jobs: map[string]int64{}, Failures: map[string]int64{}}
+
+	for _, table := range Tables {
+		var count int64
+
+		if err := s.db.Table(table).Count(&count).Error; err != nil {
+			return Stats{}, err
+		}
+
+		stats.Rows[table] = count
+	}
+
+	var jobs []struct {
+		Status string
+		Count  int64
+	}
+
+	if err := s.db.Table("crawl_jobs").Select("status, count(*) AS count").Group("status").Find(&jobs).Error; err != nil {
+		return Stats{}, err
+	}
+
+	for _, j := range jobs {
+		stats.Jobs[j.Status] = j.Count
+	}
+
+	var failures []struct {
+		ErrorClass string
+		Count      int64
+	}
+
+	if err := s.db.Table("failed_jobs").Select("error_class, count(*) AS count").Group("error_class").Find(&failures).Error; err != nil {
+		return Stats{}, err
+	}
+
+	for _, f := range failures {
+		stats.Failures[f.ErrorClass] = f.Count
+	}
+
+	return stats, nil
+}
+
+// ExportCSV write every given table to dir/[table].csv, with the column names as the header.
+// All the scraped tables are exported if no table is given.
+func (s *Scraper) ExportCSV(dir string, tables ...string) error {
+	if len(tables) == 0 {
+		tables = Tables
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		if err := s.exportTableCSV(path.Join(dir, table+".csv"), table); err != nil {
+			return fmt.Errorf("unable to export %s: %w", table, err)
+		}
+
+		s.logger.Info("table exported", "table", table, "dir", dir)
+	}
+
+	return nil
+}
+
+func (s *Scraper) exportTableCSV(filePath string, table string) error {
+	rows, err := s.db.Table(table).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+
+	if err := w.Write(columns); err != nil {
+		return err
+	}
+
+	values := make([]sql.NullString, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	record := make([]string, len(columns))
+
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+
+		// NULL is exported as an empty field
+		for i, v := range values {
+			record[i] = v.String
+		}
+
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
@@ -23,7 +23,7 @@ func ExtractUsers(doc *goquery.Selection, logger *slog.Logger) ([]models.User, e
 
 		anchor := node.Find("td > div > h3 > a")
 
-		name := anchor.Text()
+		name := strings.TrimSpace(anchor.Text())
 		if name == "" {
 			logger.Warn("user name can't be empty, skipping")
 			continue
@@ -45,6 +45,21 @@ func ExtractUsers(doc *goquery.Selection, logger *slog.Logger) ([]models.User, e
 	return users, nil
 }
 
+// ExtractUser get the user information from the user's film page at https://letterboxd.com/[user_name]/films/.
+// The name is read from the page title (e.g. karsten’s films • Letterboxd).
+func ExtractUser(userUrl string, doc *goquery.Selection, logger *slog.Logger) (models.User, error) {
+	title := strings.TrimSpace(doc.Find("title").First().Text())
+
+	name, _, found := strings.Cut(title, "’s films")
+	if !found || strings.TrimSpace(name) == "" {
+		return models.User{}, fmt.Errorf("user name not found in title %q", title)
+	}
+
+	logger.Debug("user name extracted", "name", name)
+
+	return models.User{Url: userUrl, Name: strings.TrimSpace(name)}, nil
+}
+
 // ExtractMovieUrls get all movie urls from the user's film page at https://letterboxd.com/[user_name]/films/.
 // It return a list of movie urls and error if the extracting process fails.
 func ExtractMovieUrls(doc *goquery.Selection, logger *slog.Logger) ([]string, error) {
@@ -98,12 +113,12 @@ func ExtractMovie(filmUrl string, doc *goquery.Selection, logger *slog.Logger) (
 	filmPosterUrl, exists := filmPoster.Attr("src")
 	if exists {
 		movie.PosterUrl = &filmPosterUrl
+
+		logger.Debug("movie poster extracted", "url", movie.Url, "poster_url", *movie.PosterUrl)
 	} else {
 		logger.Warn("movie does not have poster", "url", movie.Url)
 	}
 
-	logger.Debug("movie poster extracted", "url", movie.Url, "poster_url", *movie.PosterUrl)
-
 	filmBackdrop := doc.Find("#backdrop > div.backdropimage.js-backdrop-image")
 	filmBackdropStyle, exists := filmBackdrop.Attr("style")
 	if exists {
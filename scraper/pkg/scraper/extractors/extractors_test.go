@@ -0,0 +1,209 @@
+package extractors
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Run `go test ./pkg/scraper/extractors -update` to regenerate the golden files after an intended change.
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// movieId is the id passed to the extractors those need one, it ends up in the goldens.
+const movieId = 42
+
+type extractorCase struct {
+	fixture string
+	name    string
+	extract func(doc *goquery.Selection, logger *slog.Logger) (any, error)
+}
+
+var extractorCases = []extractorCase{
+	{"members", "users", func(doc *goquery.Selection, logger *slog.Logger) (any, error) {
+		return ExtractUsers(doc, logger)
+	}},
+	{"films", "movie_urls", func(doc *goquery.Selection, logger *slog.Logger) (any, error) {
+		return ExtractMovieUrls(doc, logger)
+	}},
+	{"films", "user", func(doc *goquery.Selection, logger *slog.Logger) (any, error) {
+		return ExtractUser("/karsten/", doc, logger)
+	}},
+}
+
+// filmUrls are the urls of the film page fixtures.
+var filmUrls = map[string]string{
+	"film":         "/film/godzilla-kong-the-new-empire/",
+	"film_minimal": "/film/untitled-short/",
+}
+
+func init() {
+	for _, fixture := range []string{"film", "film_minimal"} {
+		extractorCases = append(extractorCases,
+			extractorCase{fixture, "movie", func(doc *goquery.Selection, logger *slog.Logger) (any, error) {
+				return ExtractMovie(filmUrls[fixture], doc, logger)
+			}},
+			extractorCase{fixture, "casts", func(doc *goquery.Selection, logger *slog.Logger) (any, error) {
+				return ExtractCasts(doc, logger)
+			}},
+			extractorCase{fixture, "crews", func(doc *goquery.Selection, logger *slog.Logger) (any, error) {
+				return ExtractCrews(doc, logger)
+			}},
+			extractorCase{fixture, "genres_and_themes", func(doc *goquery.Selection, logger *slog.Logger) (any, error) {
+				genres, themes, err := ExtractGenresAndThemes(doc, logger)
+				return map[string]any{"genres": genres, "themes": themes}, err
+			}},
+			extractorCase{fixture, "studios", func(doc *goquery.Selection, logger *slog.Logger) (any, error) {
+				return ExtractStudios(doc, logger)
+			}},
+			extractorCase{fixture, "countries", func(doc *goquery.Selection, logger *slog.Logger) (any, error) {
+				return ExtractCountries(movieId, doc, logger)
+			}},
+			extractorCase{fixture, "languages", func(doc *goquery.Selection, logger *slog.Logger) (any, error) {
+				return ExtractLanguages(movieId, doc, logger)
+			}},
+			extractorCase{fixture, "releases", func(doc *goquery.Selection, logger *slog.Logger) (any, error) {
+				return ExtractReleases(movieId, doc, logger)
+			}},
+		)
+	}
+}
+
+func TestExtractors(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	for _, c := range extractorCases {
+		t.Run(c.fixture+"/"+c.name, func(t *testing.T) {
+			f, err := os.Open(path.Join("testdata", c.fixture+".html"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			doc, err := goquery.NewDocumentFromReader(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := c.extract(doc.Selection, logger)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := json.MarshalIndent(result, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got = append(got, '\n')
+			goldenPath := path.Join("testdata", c.fixture+"."+c.name+".golden.json")
+
+			if *update {
+				if err := os.WriteFile(goldenPath, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			expected, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("%s, run the tests with -update to create it", err)
+			}
+
+			if bytes.Equal(got, expected) {
+				return
+			}
+
+			var gotValue, expectedValue any
+
+			if err := json.Unmarshal(got, &gotValue); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := json.Unmarshal(expected, &expectedValue); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, d := range diff("$", expectedValue, gotValue) {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+// diff list every field those differ between the expected and the actual value, identified by their JSON path.
+func diff(at string, expected any, got any) []string {
+	switch e := expected.(type) {
+	case map[string]any:
+		g, ok := got.(map[string]any)
+		if !ok {
+			break
+		}
+
+		keys := map[string]bool{}
+		for k := range e {
+			keys[k] = true
+		}
+		for k := range g {
+			keys[k] = true
+		}
+
+		sortedKeys := []string{}
+		for k := range keys {
+			sortedKeys = append(sortedKeys, k)
+		}
+		sort.Strings(sortedKeys)
+
+		diffs := []string{}
+		for _, k := range sortedKeys {
+			diffs = append(diffs, diff(at+"."+k, e[k], g[k])...)
+		}
+
+		return diffs
+	case []any:
+		g, ok := got.([]any)
+		if !ok {
+			break
+		}
+
+		diffs := []string{}
+		for i := range max(len(e), len(g)) {
+			item := fmt.Sprintf("%s[%d]", at, i)
+
+			switch {
+			case i >= len(g):
+				diffs = append(diffs, fmt.Sprintf("%s: missing, expected %s", item, toJSON(e[i])))
+			case i >= len(e):
+				diffs = append(diffs, fmt.Sprintf("%s: unexpected %s", item, toJSON(g[i])))
+			default:
+				diffs = append(diffs, diff(item, e[i], g[i])...)
+			}
+		}
+
+		return diffs
+	}
+
+	if reflect.DeepEqual(expected, got) {
+		return nil
+	}
+
+	return []string{fmt.Sprintf("%s: expected %s, got %s", at, toJSON(expected), toJSON(got))}
+}
+
+func toJSON(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+
+	return strings.TrimSpace(string(b))
+}
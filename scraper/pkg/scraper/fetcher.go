@@ -0,0 +1,406 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/chromedp/chromedp"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/config"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/utils"
+)
+
+// Fetcher get a page of letterboxd and parse it into a *goquery.Document.
+// The url is relative to letterboxd (e.g. /film/godzilla-kong-the-new-empire/).
+type Fetcher interface {
+	Fetch(ctx context.Context, url string) (*goquery.Document, error)
+}
+
+// PageType is the kind of page a Fetcher is used for, each page type can be fetched by a different backend.
+type PageType string
+
+const (
+	MembersPage  PageType = "members"
+	FilmsPage    PageType = "films"
+	MoviePage    PageType = "movie"
+	ActivityPage PageType = "activity"
+	ReviewPage   PageType = "review"
+)
+
+var pageTypes = []PageType{MembersPage, FilmsPage, MoviePage, ActivityPage, ReviewPage}
+
+const (
+	fetcherChromedp = "chromedp"
+	fetcherHttp     = "http"
+)
+
+const userAgent = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/139.0.0.0 Safari/537.36"
+
+// newFetchers create the fetcher of every page type.
+// The backend of a page type is selected by cfg.Fetchers (e.g. fetchers.movie: http), chromedp is the default.
+// With the record archive mode, every fetched page is stored to the archive at cfg.ArchiveDir.
+// With the replay archive mode, pages are read from the archive and the network is never used.
+func newFetchers(th *throttle, logger *slog.Logger, cfg *config.Config) (map[PageType]Fetcher, error) {
+	var httpF *httpFetcher
+	var archive *Archive
+
+	baseUrl, proxyURL, screenshotDir := cfg.BaseUrl, cfg.ProxyURL, cfg.ScreenshotDir
+	archiveMode, archiveDir := cfg.ArchiveMode, cfg.ArchiveDir
+
+	fetchers := map[PageType]Fetcher{}
+	backends := map[PageType]string{
+		MembersPage:  cfg.Fetchers.Members,
+		FilmsPage:    cfg.Fetchers.Films,
+		MoviePage:    cfg.Fetchers.Movie,
+		ActivityPage: cfg.Fetchers.Activity,
+		ReviewPage:   cfg.Fetchers.Review,
+	}
+
+	switch archiveMode {
+	case "":
+	case archiveRecord, archiveReplay:
+		if archiveDir == "" {
+			return nil, fmt.Errorf("archive dir is required for the %s archive mode", archiveMode)
+		}
+
+		var err error
+
+		archive, err = NewArchive(archiveDir)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown archive mode %s", archiveMode)
+	}
+
+	if archiveMode == archiveReplay {
+		replay := &replayFetcher{archive: archive, logger: logger}
+
+		for _, pageType := range pageTypes {
+			fetchers[pageType] = replay
+		}
+
+		return fetchers, nil
+	}
+
+	for _, pageType := range pageTypes {
+		switch backend := backends[pageType]; backend {
+		case "", fetcherChromedp:
+			fetchers[pageType] = newChromedpFetcher(pageType, th, logger, baseUrl, screenshotDir, time.Second*time.Duration(cfg.PageTimeout))
+		case fetcherHttp:
+			if httpF == nil {
+				var err error
+
+				httpF, err = newHttpFetcher(th, logger, baseUrl, proxyURL)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			fetchers[pageType] = httpF
+		default:
+			return nil, fmt.Errorf("unknown fetcher %s for %s pages", backend, pageType)
+		}
+
+		if archiveMode == archiveRecord {
+			fetchers[pageType] = &recordingFetcher{Fetcher: fetchers[pageType], archive: archive, logger: logger}
+		}
+	}
+
+	return fetchers, nil
+}
+
+// chromedpFetcher load pages in a browser tab.
+// The ctx passed to Fetch must be a chromedp context, the page is loaded in that tab unless newTab is set.
+type chromedpFetcher struct {
+	pageType      PageType
+	throttle      *throttle
+	logger        *slog.Logger
+	baseUrl       string
+	screenshotDir string
+	// pageTimeout is the time given to a page to get ready
+	pageTimeout time.Duration
+	// ready are ran alongside the navigation, the page is considered loaded once they are all finished
+	ready []chromedp.Action
+	// after are ran once the page is loaded, before the document is parsed
+	after []chromedp.Action
+	// newTab make the page loaded in a separate tab created with these actions
+	newTab []chromedp.Action
+}
+
+func newChromedpFetcher(
+	pageType PageType, th *throttle, logger *slog.Logger, baseUrl string, screenshotDir string, pageTimeout time.Duration,
+) *chromedpFetcher {
+	f := &chromedpFetcher{
+		pageType:      pageType,
+		throttle:      th,
+		logger:        logger,
+		baseUrl:       baseUrl,
+		screenshotDir: screenshotDir,
+		pageTimeout:   pageTimeout,
+	}
+
+	switch pageType {
+	case MembersPage:
+		f.ready = []chromedp.Action{
+			chromedp.WaitVisible("#content > div > div > section > table > tbody > tr:last-child"),
+			utils.Delay(time.Millisecond*1500, time.Millisecond*300),
+		}
+	case FilmsPage:
+		f.ready = []chromedp.Action{
+			chromedp.WaitVisible("#content > div > div > section > div.poster-grid > ul > li:last-child > div > div > a > span.overlay"),
+			utils.Delay(time.Millisecond*1500, time.Millisecond*300),
+		}
+	case MoviePage:
+		f.ready = []chromedp.Action{
+			utils.Delay(time.Millisecond*1500, time.Millisecond*300),
+			chromedp.ActionFunc(func(localCtx context.Context) error {
+				var backdropExists bool
+
+				if err := chromedp.Evaluate(`document.querySelector("#backdrop") != null`, &backdropExists).Do(localCtx); err != nil {
+					return err
+				}
+
+				if backdropExists {
+					return chromedp.Tasks{
+						chromedp.WaitVisible(`body.backdrop-loaded`),
+						chromedp.WaitVisible(`#js-poster-col > section.poster-list.-p230.-single.no-hover.el.col > div.react-component > div > img[srcset]`),
+					}.Do(localCtx)
+				}
+
+				return nil
+			}),
+			utils.Delay(time.Millisecond*1500, time.Millisecond*300),
+		}
+	case ActivityPage:
+		f.ready = []chromedp.Action{
+			utils.Delay(time.Millisecond*1500, time.Millisecond*300),
+			chromedp.WaitVisible("#activity-table-body > section.activity-row.no-activity-message > p"),
+			utils.Delay(time.Millisecond*1500, time.Millisecond*300),
+		}
+	case ReviewPage:
+		f.ready = []chromedp.Action{
+			utils.Delay(time.Millisecond*1500, time.Millisecond*300),
+			chromedp.WaitVisible(moviePosterSel),
+			utils.Delay(time.Millisecond*1500, time.Millisecond*300),
+		}
+		f.after = []chromedp.Action{
+			chromedp.ActionFunc(func(ctx context.Context) error {
+				var spoilerAlert bool
+
+				if err := chromedp.Evaluate(
+					fmt.Sprintf(`document.querySelector("%s") != null`, spoilerBtnSel), &spoilerAlert,
+				).Do(ctx); err != nil {
+					return err
+				}
+
+				if spoilerAlert {
+					return chromedp.Click(spoilerBtnSel).Do(ctx)
+				}
+
+				return nil
+			}),
+		}
+		f.newTab = []chromedp.Action{
+			chromedp.EmulateViewport(360, 640),
+			utils.InjectLibToCdp(jqueryLib, logger),
+		}
+	}
+
+	return f
+}
+
+func (f *chromedpFetcher) Fetch(ctx context.Context, url string) (*goquery.Document, error) {
+	var doc *goquery.Document
+
+	if f.newTab != nil {
+		tabCtx, cancel, err := utils.NewTab(ctx, f.logger, f.newTab...)
+		if err != nil {
+			return nil, err
+		}
+
+		defer cancel()
+
+		ctx = tabCtx
+	}
+
+	if err := f.throttle.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	actions := []chromedp.Action{utils.NavigateTillTrigger(chromedp.Navigate(f.baseUrl+url), f.logger, f.ready...)}
+	actions = append(actions, f.after...)
+	actions = append(actions,
+		utils.ScreenShot(f.screenshotDir, f.logger, time.Now(), string(f.pageType)+"-page", url),
+		utils.ToGoqueryDoc("html", &doc),
+	)
+
+	runCtx, cancel := context.WithTimeout(ctx, f.pageTimeout)
+	defer cancel()
+
+	if err := chromedp.Run(runCtx, actions...); err != nil {
+		return nil, f.failure(ctx, url, err)
+	}
+
+	return doc, nil
+}
+
+// failure classify the error of a page those failed to load, with a screenshot of the page at that time.
+func (f *chromedpFetcher) failure(ctx context.Context, url string, err error) error {
+	// The fetch was interrupted, the page is not at fault
+	if ctx.Err() != nil {
+		return err
+	}
+
+	jobErr := &JobError{Class: ClassTransient, Url: url, Err: err}
+	if errors.Is(err, context.DeadlineExceeded) {
+		jobErr.Class = ClassSelectorTimeout
+	}
+
+	diagCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	var status int64
+
+	if err := chromedp.Run(diagCtx, chromedp.Evaluate(
+		`performance.getEntriesByType("navigation")[0]?.responseStatus ?? 0`, &status,
+	)); err == nil && status != 0 && status != http.StatusOK {
+		jobErr = statusError(url, int(status))
+	}
+
+	jobErr.Screenshot = f.screenshot(diagCtx, url)
+
+	return jobErr
+}
+
+// screenshot take a screenshot of a failed page to the screenshot dir and return its path.
+func (f *chromedpFetcher) screenshot(ctx context.Context, url string) string {
+	if f.screenshotDir == "" {
+		return ""
+	}
+
+	var buf []byte
+
+	if err := chromedp.Run(ctx, chromedp.FullScreenshot(&buf, 80)); err != nil {
+		f.logger.Warn("error taking screen shot of the failed page", "url", url, "msg", err.Error())
+		return ""
+	}
+
+	filename := strings.ReplaceAll(
+		strings.Join([]string{time.Now().Format(time.RFC3339), "failed", string(f.pageType) + "-page", url}, "_")+".jpg",
+		"/", "-",
+	)
+	filePath := path.Join(f.screenshotDir, filename)
+
+	if err := os.WriteFile(filePath, buf, 0644); err != nil {
+		f.logger.Warn("error saving screen shot of the failed page", "url", url, "msg", err.Error())
+		return ""
+	}
+
+	return filePath
+}
+
+// httpFetcher get pages with a plain HTTP client, it is much lighter than a browser for pages those don't need Javascript.
+// Cookies are kept between requests. Failed requests are not retried here, the errors are classified for the retry policy
+// those is applied to the jobs of the crawl and to the scrapes outside of it alike.
+type httpFetcher struct {
+	client   *http.Client
+	throttle *throttle
+	logger   *slog.Logger
+	baseUrl  string
+}
+
+func newHttpFetcher(th *throttle, logger *slog.Logger, baseUrl string, proxyURL string) (*httpFetcher, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if proxyURL != "" {
+		proxy, err := url.Parse(proxyURL)
+		if err != nil {
+			return nil, err
+		}
+
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	return &httpFetcher{
+		client: &http.Client{
+			Jar:       jar,
+			Transport: transport,
+			Timeout:   time.Second * 60,
+		},
+		throttle: th,
+		logger:   logger,
+		baseUrl:  baseUrl,
+	}, nil
+}
+
+func (f *httpFetcher) Fetch(ctx context.Context, url string) (*goquery.Document, error) {
+	if err := f.throttle.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.baseUrl+url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
+
+	f.logger.Debug("request to be sent", "url", req.URL.String(), "method", req.Method)
+
+	res, err := f.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+
+		return nil, &JobError{Class: ClassTransient, Url: url, Err: err}
+	}
+
+	defer res.Body.Close()
+
+	f.logger.Debug(
+		"response recieved",
+		"url", req.URL.String(),
+		"status_code", res.StatusCode,
+		"content_type", res.Header.Get("Content-Type"),
+	)
+
+	if res.StatusCode != http.StatusOK {
+		return nil, statusError(url, res.StatusCode)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(res.Body)
+	if err != nil {
+		return nil, &JobError{Class: ClassTransient, Url: url, Err: err}
+	}
+
+	return doc, nil
+}
+
+// statusError classify the error of a page those responded with a status other than 200.
+func statusError(url string, statusCode int) *JobError {
+	err := fmt.Errorf("%s responded with status %d", url, statusCode)
+
+	if statusCode == http.StatusNotFound || statusCode == http.StatusGone {
+		return &JobError{Class: ClassRemoved, Url: url, Err: err}
+	}
+
+	return &JobError{Class: ClassHttp, Url: url, Err: err}
+}
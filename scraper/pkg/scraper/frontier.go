@@ -0,0 +1,272 @@
+package scraper
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/leminhohoho/movie-lens/scraper/pkg/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type jobKind string
+
+const (
+	jobMembersPage jobKind = "members_page"
+	jobUser        jobKind = "user"
+	jobUserFilms   jobKind = "user_films"
+	jobActivity    jobKind = "activity"
+)
+
+// jobPriorities makes the frontier pick the deepest kind of job first,
+// so the crawl order stays the same as the old recursive traversal (members -> user -> films -> activity).
+var jobPriorities = map[jobKind]int{
+	jobMembersPage: 0,
+	jobUser:        1,
+	jobUserFilms:   2,
+	jobActivity:    3,
+}
+
+const (
+	statusPending    = "pending"
+	statusInProgress = "in_progress"
+	statusDone       = "done"
+	statusFailed     = "failed"
+)
+
+// frontier is the persistent crawl queue stored in the crawl_jobs table.
+// Every job is identified by its kind and url, pushing the same job twice is a no-op.
+type frontier struct {
+	db     *gorm.DB
+	logger *slog.Logger
+}
+
+func newFrontier(db *gorm.DB, logger *slog.Logger) *frontier {
+	return &frontier{db: db, logger: logger}
+}
+
+// push add new pending jobs of the given kind to the queue, jobs those are already in the queue are ignored.
+func (f *frontier) push(kind jobKind, urls ...string) error {
+	if len(urls) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	jobs := make([]models.CrawlJob, len(urls))
+
+	for i, url := range urls {
+		jobs[i] = models.CrawlJob{
+			Kind:      string(kind),
+			Url:       url,
+			Status:    statusPending,
+			Priority:  jobPriorities[kind],
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+	}
+
+	if err := f.db.Table("crawl_jobs").Clauses(clause.OnConflict{DoNothing: true}).Create(&jobs).Error; err != nil {
+		return err
+	}
+
+	f.logger.Debug("jobs pushed to frontier", "kind", kind, "count", len(urls))
+
+	return nil
+}
+
+// next claim the pending job with the highest priority and mark it as in progress.
+// A job is only claimed if it is still pending, so that the scrapers of several hosts sharing the db never run the same job.
+// It returns nil if there is no pending job left.
+func (f *frontier) next() (*models.CrawlJob, error) {
+	for {
+		var jobs []models.CrawlJob
+
+		if err := f.db.Table("crawl_jobs").
+			Where("status = ?", statusPending).
+			Order("priority DESC, id ASC").
+			Limit(1).
+			Find(&jobs).Error; err != nil {
+			return nil, err
+		}
+
+		if len(jobs) == 0 {
+			return nil, nil
+		}
+
+		job := &jobs[0]
+		job.Status = statusInProgress
+		job.Attempts++
+		job.UpdatedAt = time.Now()
+
+		res := f.db.Table("crawl_jobs").Where("id = ? AND status = ?", job.Id, statusPending).Updates(map[string]any{
+			"status":     job.Status,
+			"attempts":   job.Attempts,
+			"updated_at": job.UpdatedAt,
+		})
+		if res.Error != nil {
+			return nil, res.Error
+		}
+
+		// Another scraper claimed the job first
+		if res.RowsAffected == 0 {
+			continue
+		}
+
+		return job, nil
+	}
+}
+
+// done mark a job as completed, completed jobs are never picked again.
+func (f *frontier) done(job *models.CrawlJob) error {
+	return f.db.Table("crawl_jobs").Where("id = ?", job.Id).Updates(map[string]any{
+		"status":     statusDone,
+		"error":      nil,
+		"updated_at": time.Now(),
+	}).Error
+}
+
+// fail mark a job as failed and record it to the failed_jobs table, with its error, for later inspection and re-queueing.
+func (f *frontier) fail(job *models.CrawlJob, jobErr error) error {
+	now := time.Now()
+
+	failedJob := models.FailedJob{
+		JobId:      job.Id,
+		Kind:       job.Kind,
+		Url:        job.Url,
+		ErrorClass: string(classOf(jobErr)),
+		Error:      jobErr.Error(),
+		Attempts:   job.Attempts,
+		FailedAt:   now,
+	}
+
+	if screenshot := screenshotOf(jobErr); screenshot != "" {
+		failedJob.ScreenshotPath = &screenshot
+	}
+
+	return f.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table("crawl_jobs").Where("id = ?", job.Id).Updates(map[string]any{
+			"status":     statusFailed,
+			"error":      jobErr.Error(),
+			"updated_at": now,
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Table("failed_jobs").Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "job_id"}},
+			UpdateAll: true,
+		}).Create(&failedJob).Error
+	})
+}
+
+// retry record a new attempt of a job those is retried right away by its worker.
+func (f *frontier) retry(job *models.CrawlJob, jobErr error) error {
+	job.Attempts++
+
+	return f.db.Table("crawl_jobs").Where("id = ?", job.Id).Updates(map[string]any{
+		"attempts":   job.Attempts,
+		"error":      jobErr.Error(),
+		"updated_at": time.Now(),
+	}).Error
+}
+
+// requeue put the failed jobs back into the queue and remove them from failed_jobs.
+// The jobs can be filtered by error class and kind, every failed job is re-queued if both are empty.
+// It returns the number of re-queued jobs.
+func (f *frontier) requeue(class string, kind string) (int64, error) {
+	var count int64
+
+	err := f.db.Transaction(func(tx *gorm.DB) error {
+		failedJobs := tx.Table("failed_jobs").Select("job_id")
+		if class != "" {
+			failedJobs = failedJobs.Where("error_class = ?", class)
+		}
+		if kind != "" {
+			failedJobs = failedJobs.Where("kind = ?", kind)
+		}
+
+		res := tx.Table("crawl_jobs").Where("status = ? AND id IN (?)", statusFailed, failedJobs).Updates(map[string]any{
+			"status":     statusPending,
+			"attempts":   0,
+			"error":      nil,
+			"updated_at": time.Now(),
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+
+		count = res.RowsAffected
+
+		return tx.Table("failed_jobs").Where("job_id IN (?)", failedJobs).Delete(&models.FailedJob{}).Error
+	})
+
+	return count, err
+}
+
+// release put a job those was interrupted back into the queue, as if it was never picked.
+func (f *frontier) release(job *models.CrawlJob) error {
+	return f.db.Table("crawl_jobs").Where("id = ?", job.Id).Updates(map[string]any{
+		"status":     statusPending,
+		"attempts":   gorm.Expr("attempts - 1"),
+		"updated_at": time.Now(),
+	}).Error
+}
+
+// count return the number of jobs with the given status.
+func (f *frontier) count(status string) (int64, error) {
+	var count int64
+
+	if err := f.db.Table("crawl_jobs").Where("status = ?", status).Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// recover put jobs those were in progress when the previous run stopped back into the queue.
+// With a db shared by several hosts, it also takes back the jobs of the scrapers those are still running,
+// which are then run twice, so the scrapers should be started before any of them is restarted.
+func (f *frontier) recover() error {
+	res := f.db.Table("crawl_jobs").Where("status = ?", statusInProgress).Updates(map[string]any{
+		"status":     statusPending,
+		"updated_at": time.Now(),
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if res.RowsAffected > 0 {
+		f.logger.Info("interrupted jobs put back to the frontier", "count", res.RowsAffected)
+	}
+
+	return nil
+}
+
+func membersPageUrl(page int) string {
+	return fmt.Sprintf("/members/popular/page/%d/", page)
+}
+
+func userFilmsPageUrl(userUrl string, page int) string {
+	return fmt.Sprintf("%sfilms/by/date/page/%d/", userUrl, page)
+}
+
+func activityUrl(userUrl string, filmUrl string) string {
+	return "/" + strings.Trim(userUrl, "/") + "/" + strings.Trim(filmUrl, "/") + "/activity"
+}
+
+// userUrlOf get the user url (/[user_name]/) from the url of a user scoped page such as films or activity pages.
+func userUrlOf(url string) string {
+	return "/" + strings.Split(strings.Trim(url, "/"), "/")[0] + "/"
+}
+
+// filmUrlOf get the film url (/film/[movie_name]/) from the url of an activity page.
+func filmUrlOf(activityUrl string) (string, error) {
+	fragments := strings.Split(strings.Trim(activityUrl, "/"), "/")
+	if len(fragments) != 4 || fragments[1] != "film" {
+		return "", fmt.Errorf("%s is not an activity url", activityUrl)
+	}
+
+	return "/film/" + fragments[2] + "/", nil
+}
@@ -0,0 +1,116 @@
+package scraper
+
+import (
+	"io"
+	"log/slog"
+	"path"
+	"testing"
+
+	"github.com/leminhohoho/movie-lens/scraper/pkg/migrations"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestFrontier(t *testing.T) *frontier {
+	db, err := gorm.Open(sqlite.Open(path.Join(t.TempDir(), "frontier.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := migrations.Up(db, slog.New(slog.NewTextHandler(io.Discard, nil))); err != nil {
+		t.Fatal(err)
+	}
+
+	return newFrontier(db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestFrontierOrder(t *testing.T) {
+	f := newTestFrontier(t)
+
+	if err := f.push(jobMembersPage, membersPageUrl(3), membersPageUrl(4)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.push(jobActivity, activityUrl("/someone/", "/film/godzilla/")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Pushing the same job again must not create a duplicate
+	if err := f.push(jobMembersPage, membersPageUrl(3)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"/someone/film/godzilla/activity", "/members/popular/page/3/", "/members/popular/page/4/"}
+
+	for _, url := range expected {
+		job, err := f.next()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if job == nil || job.Url != url {
+			t.Fatalf("expected job %s, got %#v", url, job)
+		}
+
+		if err := f.done(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	job, err := f.next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job != nil {
+		t.Fatalf("expected empty frontier, got %#v", job)
+	}
+}
+
+func TestFrontierRecover(t *testing.T) {
+	f := newTestFrontier(t)
+
+	if err := f.push(jobUser, "/someone/"); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := f.next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash: the job is left in progress and the scraper restarts
+	if err := f.recover(); err != nil {
+		t.Fatal(err)
+	}
+
+	recovered, err := f.next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if recovered == nil || recovered.Id != job.Id || recovered.Attempts != 2 {
+		t.Fatalf("expected job %d to be picked again on its second attempt, got %#v", job.Id, recovered)
+	}
+}
+
+func TestActivityUrl(t *testing.T) {
+	url := activityUrl("/someone/", "/film/godzilla-kong-the-new-empire/")
+
+	if userUrlOf(url) != "/someone/" {
+		t.Fatalf("unexpected user url %s", userUrlOf(url))
+	}
+
+	filmUrl, err := filmUrlOf(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if filmUrl != "/film/godzilla-kong-the-new-empire/" {
+		t.Fatalf("unexpected film url %s", filmUrl)
+	}
+
+	if userUrlOf(userFilmsPageUrl("/someone/", 2)) != "/someone/" {
+		t.Fatalf("unexpected user url for films page")
+	}
+}
@@ -0,0 +1,407 @@
+// Package letterboxdtest provides a fake letterboxd site for end to end tests of the scraper.
+// The pages are rendered from templates which mirror the markup of letterboxd closely enough for the extractors and the chromedp fetchers.
+package letterboxdtest
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed templates/*.html
+var templatesFS embed.FS
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"stars": stars,
+	"verbs": verbs,
+	"iso":   func(t time.Time) string { return t.UTC().Format(time.RFC3339) },
+}).ParseFS(templatesFS, "templates/*.html"))
+
+type Link struct {
+	Url  string
+	Name string
+}
+
+type Release struct {
+	Type      string
+	Date      string
+	Country   string
+	AgeRating string
+}
+
+type Film struct {
+	Slug            string
+	Name            string
+	Duration        int
+	PosterUrl       string
+	BackdropUrl     string
+	Desc            string
+	TrailerUrl      string
+	Cast            []Link
+	Crew            map[string][]Link
+	Genres          []Link
+	Themes          []Link
+	Studios         []Link
+	Countries       []string
+	Languages       []string
+	SpokenLanguages []string
+	Releases        []Release
+}
+
+func (f Film) Url() string {
+	return "/film/" + f.Slug + "/"
+}
+
+type Review struct {
+	Text    string
+	Spoiler bool
+	Removed bool
+}
+
+type Activity struct {
+	Date    time.Time
+	Watched bool
+	Liked   bool
+	Rating  float32
+	Review  *Review
+}
+
+type Member struct {
+	Slug string
+	Name string
+	// Films are the slugs of the films watched by the member, from the newest to the oldest
+	Films      []string
+	Activities map[string][]Activity
+}
+
+func (m Member) Url() string {
+	return "/" + m.Slug + "/"
+}
+
+// Site is the content served by the fake letterboxd.
+type Site struct {
+	// Members are the popular members, from the most to the least popular
+	Members        []Member
+	MembersPerPage int
+	Films          map[string]Film
+	FilmsPerPage   int
+}
+
+// NewServer start a fake letterboxd serving the site.
+func NewServer(site *Site) *httptest.Server {
+	return httptest.NewServer(NewHandler(site))
+}
+
+// NewHandler return the handler of the fake letterboxd, it can be wrapped to observe or alter the requests.
+func NewHandler(site *Site) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /members/popular/page/{page}/{$}", site.membersPage)
+	mux.HandleFunc("GET /film/{film}/{$}", site.filmPage)
+	mux.HandleFunc("GET /{member}/films/by/date/{$}", site.filmsPage)
+	mux.HandleFunc("GET /{member}/films/by/date/page/{page}/{$}", site.filmsPage)
+	mux.HandleFunc("GET /{member}/film/{film}/activity", site.activityPage)
+	mux.HandleFunc("GET /{member}/film/{film}/activity/{$}", site.activityPage)
+	mux.HandleFunc("GET /{member}/film/{film}/{$}", site.reviewPage)
+
+	return mux
+}
+
+func (s *Site) member(slug string) (Member, bool) {
+	for _, m := range s.Members {
+		if m.Slug == slug {
+			return m, true
+		}
+	}
+
+	return Member{}, false
+}
+
+// paginate return the items of the page (starting from 1) and the number of pages.
+func paginate[T any](items []T, perPage int, page int) ([]T, int) {
+	if perPage <= 0 {
+		perPage = len(items)
+	}
+
+	pages := max((len(items)+perPage-1)/max(perPage, 1), 1)
+	start := min((page-1)*perPage, len(items))
+	end := min(start+perPage, len(items))
+
+	return items[start:end], pages
+}
+
+func pageNumber(r *http.Request) (int, error) {
+	if r.PathValue("page") == "" {
+		return 1, nil
+	}
+
+	page, err := strconv.Atoi(r.PathValue("page"))
+	if err != nil || page < 1 {
+		return 0, fmt.Errorf("invalid page %s", r.PathValue("page"))
+	}
+
+	return page, nil
+}
+
+func render(w http.ResponseWriter, name string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if err := templates.ExecuteTemplate(w, name, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (s *Site) membersPage(w http.ResponseWriter, r *http.Request) {
+	page, err := pageNumber(r)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	members, pages := paginate(s.Members, s.MembersPerPage, page)
+	if page > pages {
+		http.NotFound(w, r)
+		return
+	}
+
+	render(w, "members.html", map[string]any{"Members": members})
+}
+
+func (s *Site) filmsPage(w http.ResponseWriter, r *http.Request) {
+	member, ok := s.member(r.PathValue("member"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	page, err := pageNumber(r)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	slugs, pages := paginate(member.Films, s.FilmsPerPage, page)
+	if page > pages {
+		http.NotFound(w, r)
+		return
+	}
+
+	films := []Film{}
+	for _, slug := range slugs {
+		films = append(films, s.Films[slug])
+	}
+
+	render(w, "films.html", map[string]any{
+		"Member": member,
+		"Films":  films,
+		"Page":   page,
+		"Pages":  pages,
+	})
+}
+
+func (s *Site) filmPage(w http.ResponseWriter, r *http.Request) {
+	film, ok := s.Films[r.PathValue("film")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	render(w, "film.html", film)
+}
+
+func (s *Site) activityPage(w http.ResponseWriter, r *http.Request) {
+	member, ok := s.member(r.PathValue("member"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	film, ok := s.Films[r.PathValue("film")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	render(w, "activity.html", map[string]any{
+		"Member":     member,
+		"Film":       film,
+		"Activities": member.Activities[film.Slug],
+	})
+}
+
+func (s *Site) reviewPage(w http.ResponseWriter, r *http.Request) {
+	member, ok := s.member(r.PathValue("member"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	film, ok := s.Films[r.PathValue("film")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	for _, activity := range member.Activities[film.Slug] {
+		if activity.Review != nil {
+			render(w, "review.html", map[string]any{
+				"Member": member,
+				"Film":   film,
+				"Review": activity.Review,
+			})
+			return
+		}
+	}
+
+	http.NotFound(w, r)
+}
+
+// stars format a rating the way letterboxd does (e.g. 3.5 -> ★★★½).
+func stars(rating float32) string {
+	return strings.Repeat("★", int(rating)) + strings.Repeat("½", int(rating*2)%2)
+}
+
+// verbs describe an activity the way letterboxd does (e.g. watched, liked and rated).
+func verbs(a Activity) string {
+	words := []string{}
+
+	if a.Review != nil {
+		words = append(words, "reviewed")
+	} else if a.Watched {
+		words = append(words, "watched")
+	}
+
+	if a.Liked {
+		words = append(words, "liked")
+	}
+
+	if a.Rating > 0 {
+		words = append(words, "rated")
+	}
+
+	if len(words) <= 1 {
+		return strings.Join(words, "")
+	}
+
+	return strings.Join(words[:len(words)-1], ", ") + " and " + words[len(words)-1]
+}
+
+// DefaultSite is a small site covering the cases the scraper has to handle:
+// paginated members and films, films without some details, ratings with halves, spoiler and removed reviews.
+// The scraper starts crawling at the 3rd page of members, which holds karsten and davidehrlich.
+func DefaultSite() *Site {
+	date := func(s string) time.Time {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			panic(err)
+		}
+
+		return t
+	}
+
+	return &Site{
+		MembersPerPage: 2,
+		FilmsPerPage:   2,
+		Members: []Member{
+			{Slug: "first", Name: "First"},
+			{Slug: "second", Name: "Second"},
+			{Slug: "third", Name: "Third"},
+			{Slug: "fourth", Name: "Fourth"},
+			{
+				Slug:  "karsten",
+				Name:  "karsten",
+				Films: []string{"godzilla-kong-the-new-empire", "dune-part-two", "perfect-days-2023"},
+				Activities: map[string][]Activity{
+					"godzilla-kong-the-new-empire": {
+						{Date: date("2024-04-02T20:13:00Z"), Watched: true, Rating: 3.5},
+					},
+					"dune-part-two": {
+						{
+							Date:   date("2024-03-01T18:40:00Z"),
+							Liked:  true,
+							Rating: 5,
+							Review: &Review{Text: "Paul becomes the villain of his own story.", Spoiler: true},
+						},
+					},
+					"perfect-days-2023": {
+						{Date: date("2024-01-12T11:05:00Z"), Watched: true},
+					},
+				},
+			},
+			{
+				Slug:  "davidehrlich",
+				Name:  "David Ehrlich",
+				Films: []string{"dune-part-two", "perfect-days-2023"},
+				Activities: map[string][]Activity{
+					"dune-part-two": {
+						{Date: date("2024-02-28T09:00:00Z"), Watched: true, Liked: true},
+					},
+					"perfect-days-2023": {
+						{Date: date("2023-11-20T22:30:00Z"), Rating: 4, Review: &Review{Text: "Removed", Removed: true}},
+					},
+				},
+			},
+		},
+		Films: map[string]Film{
+			"godzilla-kong-the-new-empire": {
+				Slug:        "godzilla-kong-the-new-empire",
+				Name:        "Godzilla x Kong: The New Empire",
+				Duration:    115,
+				PosterUrl:   "https://a.ltrbxd.com/resized/film-poster/6/1/7/4/4/3/617443-godzilla-x-kong-0-230-0-345-crop.jpg",
+				BackdropUrl: "https://a.ltrbxd.com/resized/sm/upload/ko/4e/godzilla-kong-1200-1200-675-675-crop-000000.jpg",
+				Desc:        "Two ancient titans, Godzilla and Kong, clash in an epic battle as humans unravel their intertwined origins.",
+				TrailerUrl:  "https://www.youtube.com/embed/lV1OOlGwExM",
+				Cast: []Link{
+					{Url: "/actor/rebecca-hall/", Name: "Rebecca Hall"},
+					{Url: "/actor/brian-tyree-henry/", Name: "Brian Tyree Henry"},
+				},
+				Crew: map[string][]Link{
+					"Director": {{Url: "/director/adam-wingard/", Name: "Adam Wingard"}},
+				},
+				Genres:    []Link{{Url: "/films/genre/action/", Name: "Action"}, {Url: "/films/genre/science-fiction/", Name: "Science Fiction"}},
+				Themes:    []Link{{Url: "/films/theme/monster-kaiju/", Name: "Monster kaiju"}},
+				Studios:   []Link{{Url: "/studio/legendary-pictures/", Name: "Legendary Pictures"}},
+				Countries: []string{"USA"},
+				Languages: []string{"English"},
+				Releases:  []Release{{Type: "Theatrical", Date: "29 Mar 2024", Country: "USA", AgeRating: "PG-13"}},
+			},
+			"dune-part-two": {
+				Slug:     "dune-part-two",
+				Name:     "Dune: Part Two",
+				Duration: 167,
+				Desc:     "Follow the mythic journey of Paul Atreides as he unites with Chani and the Fremen.",
+				Cast: []Link{
+					{Url: "/actor/timothee-chalamet/", Name: "Timothée Chalamet"},
+					{Url: "/actor/zendaya/", Name: "Zendaya"},
+				},
+				Crew: map[string][]Link{
+					"Director": {{Url: "/director/denis-villeneuve/", Name: "Denis Villeneuve"}},
+					"Writers":  {{Url: "/writer/denis-villeneuve/", Name: "Denis Villeneuve"}, {Url: "/writer/jon-spaihts/", Name: "Jon Spaihts"}},
+				},
+				Genres:          []Link{{Url: "/films/genre/science-fiction/", Name: "Science Fiction"}, {Url: "/films/genre/adventure/", Name: "Adventure"}},
+				Studios:         []Link{{Url: "/studio/legendary-pictures/", Name: "Legendary Pictures"}},
+				Countries:       []string{"USA", "Canada"},
+				Languages:       []string{"English"},
+				SpokenLanguages: []string{"English", "Arabic"},
+				Releases: []Release{
+					{Type: "Premiere", Date: "15 Feb 2024", Country: "UK"},
+					{Type: "Theatrical", Date: "01 Mar 2024", Country: "USA", AgeRating: "PG-13"},
+				},
+			},
+			"perfect-days-2023": {
+				Slug:      "perfect-days-2023",
+				Name:      "Perfect Days",
+				Duration:  124,
+				Crew:      map[string][]Link{"Director": {{Url: "/director/wim-wenders/", Name: "Wim Wenders"}}},
+				Genres:    []Link{{Url: "/films/genre/drama/", Name: "Drama"}},
+				Countries: []string{"Japan", "Germany"},
+				Languages: []string{"Japanese"},
+			},
+		},
+	}
+}
@@ -0,0 +1,568 @@
+package scraper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/leminhohoho/movie-lens/scraper/pkg/models"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/utils"
+	"github.com/parquet-go/parquet-go"
+	"gorm.io/gorm"
+)
+
+// Views are the denormalized datasets exported to Parquet along with the tables.
+var Views = []string{"movies_view", "activities_view"}
+
+// releaseDateLayout is the layout of the release dates scraped from the releases tab of a movie.
+const releaseDateLayout = "02 Jan 2006"
+
+// releaseRow is a row of the releases table, with its date as a Parquet date. The dates those can't be parsed are nulls.
+type releaseRow struct {
+	MovieId     int     `parquet:"movie_id"`
+	Date        *int32  `parquet:"date,optional"`
+	Country     string  `parquet:"country"`
+	AgeRating   *string `parquet:"age_rating,optional"`
+	ReleaseType string  `parquet:"release_type"`
+}
+
+func (releaseRow) parquetSchema() *parquet.Schema {
+	return dateSchemaOf(releaseRow{}, "date")
+}
+
+// activityRow is a row of the users_and_movies table, with its date as a Parquet timestamp. The dates those can't be parsed are nulls.
+type activityRow struct {
+	UserId  int       `parquet:"user_id"`
+	MovieId int       `parquet:"movie_id"`
+	Date    time.Time `parquet:"date,optional,timestamp(millisecond)"`
+	IsWatch bool      `parquet:"is_watch"`
+	Rating  *float32  `parquet:"rating,optional"`
+	IsLoved bool      `parquet:"is_loved"`
+	Review  *string   `parquet:"review,optional"`
+}
+
+// movieViewRow is a movie with the names of everything it is related to, the lists are empty if there is nothing.
+type movieViewRow struct {
+	models.Movie
+	// ReleaseDate is the earliest release of the movie
+	ReleaseDate *int32   `parquet:"release_date,optional"`
+	Genres      []string `parquet:"genres,list"`
+	Themes      []string `parquet:"themes,list"`
+	Studios     []string `parquet:"studios,list"`
+	Countries   []string `parquet:"countries,list"`
+	Languages   []string `parquet:"languages,list"`
+	// Casts are in the order the actors were first scraped, the billing order of the cast tab is not stored
+	Casts     []string `parquet:"casts,list"`
+	Directors []string `parquet:"directors,list"`
+}
+
+func (movieViewRow) parquetSchema() *parquet.Schema {
+	return dateSchemaOf(movieViewRow{}, "release_date")
+}
+
+// schemaRow is a row those is written with a schema of its own rather than the schema of its type.
+type schemaRow interface {
+	parquetSchema() *parquet.Schema
+}
+
+// dateSchemaOf return the schema of row with the given columns as dates. parquet-go can't tag a pointer as a date, the
+// columns are *int32 fields tagged optional those hold the number of days since the Unix epoch.
+func dateSchemaOf(row any, columns ...string) *parquet.Schema {
+	schema := parquet.SchemaOf(row)
+
+	fields := slices.Clone(schema.Fields())
+	for i, field := range fields {
+		if slices.Contains(columns, field.Name()) {
+			fields[i] = dateField{field}
+		}
+	}
+
+	return parquet.NewSchema(schema.Name(), fieldsNode{schema, fields})
+}
+
+// dateField is a field of the schema of a row with the date logical type.
+type dateField struct {
+	parquet.Field
+}
+
+func (dateField) Type() parquet.Type {
+	return parquet.Date().Type()
+}
+
+// fieldsNode is a group with its fields replaced.
+type fieldsNode struct {
+	parquet.Node
+	fields []parquet.Field
+}
+
+func (n fieldsNode) Fields() []parquet.Field {
+	return n.fields
+}
+
+// activityViewRow is an activity with the user and the movie it is about.
+type activityViewRow struct {
+	activityRow
+	UserUrl   string `parquet:"user_url"`
+	MovieUrl  string `parquet:"movie_url"`
+	MovieName string `parquet:"movie_name"`
+}
+
+// ParquetManifest describe a snapshot of the dataset exported to Parquet.
+type ParquetManifest struct {
+	Snapshot  string    `json:"snapshot"`
+	CreatedAt time.Time `json:"created_at"`
+	// Datasets are the number of rows and files of every exported table and view
+	Datasets map[string]ParquetDataset `json:"datasets"`
+}
+
+type ParquetDataset struct {
+	Rows int64 `json:"rows"`
+	// PartitionBy is the column the dataset is partitioned by, its files are in a dir of their own by value of the
+	// column (e.g. release_year=2024/part-00000.parquet). It is empty if the dataset is only split by row count.
+	PartitionBy string   `json:"partition_by,omitempty"`
+	Files       []string `json:"files"`
+}
+
+// partitions are the columns the datasets are partitioned by, the other datasets are only split by row count.
+// The columns are derived from the dates of the rows and are not in the files, a row without a date is in the
+// __HIVE_DEFAULT_PARTITION__ partition like in Hive.
+var partitions = map[string]struct {
+	column string
+	value  func(row any) (int, bool)
+}{
+	"movies_view": {"release_year", func(row any) (int, bool) {
+		date := row.(movieViewRow).ReleaseDate
+		if date == nil {
+			return 0, false
+		}
+
+		return time.Unix(int64(*date)*86400, 0).UTC().Year(), true
+	}},
+	"users_and_movies": {"year", func(row any) (int, bool) {
+		return activityYear(row.(activityRow))
+	}},
+	"activities_view": {"year", func(row any) (int, bool) {
+		return activityYear(row.(activityViewRow).activityRow)
+	}},
+}
+
+func activityYear(row activityRow) (int, bool) {
+	if row.Date.IsZero() {
+		return 0, false
+	}
+
+	return row.Date.Year(), true
+}
+
+// ExportParquet write a new snapshot of every given table and view to dir/[snapshot]/[dataset]/part-[n].parquet,
+// every file has at most rowsPerFile rows. The views and the activities are partitioned by year, their files are in
+// dir/[snapshot]/[dataset]/[column]=[year]/ (see [ParquetDataset]). The snapshot is named after the time of the export (e.g. 20240301T184000Z),
+// it comes with a manifest.json and dir/LATEST is updated with its name once it is complete.
+// All the scraped tables and views are exported if none is given. It returns the manifest of the snapshot.
+func (s *Scraper) ExportParquet(dir string, rowsPerFile int, datasets ...string) (ParquetManifest, error) {
+	if len(datasets) == 0 {
+		datasets = append(slices.Clone(Tables), Views...)
+	}
+
+	now := time.Now().UTC()
+	manifest := ParquetManifest{
+		Snapshot:  now.Format("20060102T150405Z"),
+		CreatedAt: now,
+		Datasets:  map[string]ParquetDataset{},
+	}
+
+	snapshotDir := path.Join(dir, manifest.Snapshot)
+
+	for _, dataset := range datasets {
+		dw := newDatasetWriter(path.Join(snapshotDir, dataset), max(rowsPerFile, 1))
+
+		partition, partitioned := partitions[dataset]
+		if partitioned {
+			dw.partitionOf = func(row any) string {
+				if value, ok := partition.value(row); ok {
+					return fmt.Sprintf("%s=%d", partition.column, value)
+				}
+
+				return partition.column + "=__HIVE_DEFAULT_PARTITION__"
+			}
+		}
+
+		if err := s.exportDatasetParquet(dw, dataset); err != nil {
+			return manifest, fmt.Errorf("unable to export %s: %w", dataset, err)
+		}
+
+		manifest.Datasets[dataset] = ParquetDataset{Rows: dw.rows, PartitionBy: partition.column, Files: dw.files}
+
+		s.logger.Info("dataset exported", "dataset", dataset, "rows", dw.rows, "dir", dw.dir)
+	}
+
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, err
+	}
+
+	if err := os.WriteFile(path.Join(snapshotDir, "manifest.json"), content, 0644); err != nil {
+		return manifest, err
+	}
+
+	// LATEST is replaced at once, readers never see a snapshot those is not complete
+	return manifest, utils.WriteFileAtomic(path.Join(dir, "LATEST"), func(w io.Writer) error {
+		_, err := io.WriteString(w, manifest.Snapshot+"\n")
+		return err
+	})
+}
+
+func (s *Scraper) exportDatasetParquet(dw *datasetWriter, dataset string) error {
+	if err := os.MkdirAll(dw.dir, 0755); err != nil {
+		return err
+	}
+
+	identity := func(row any) (any, error) { return row, nil }
+
+	switch dataset {
+	case "users":
+		return exportQueryParquet[models.User](s.db, dw, s.db.Table("users").Order("id"), identity)
+	case "movies":
+		return exportQueryParquet[models.Movie](s.db, dw, s.db.Table("movies").Order("id"), identity)
+	case "crews":
+		return exportQueryParquet[models.Crew](s.db, dw, s.db.Table("crews").Order("id"), identity)
+	case "genres":
+		return exportQueryParquet[models.Genre](s.db, dw, s.db.Table("genres").Order("id"), identity)
+	case "themes":
+		return exportQueryParquet[models.Theme](s.db, dw, s.db.Table("themes").Order("id"), identity)
+	case "studios":
+		return exportQueryParquet[models.Studio](s.db, dw, s.db.Table("studios").Order("id"), identity)
+	case "crews_and_movies":
+		return exportQueryParquet[models.CrewsAndMovies](s.db, dw, s.db.Table(dataset).Order("movie_id"), identity)
+	case "genres_and_movies":
+		return exportQueryParquet[models.GenresAndMovies](s.db, dw, s.db.Table(dataset).Order("movie_id"), identity)
+	case "themes_and_movies":
+		return exportQueryParquet[models.ThemesAndMovies](s.db, dw, s.db.Table(dataset).Order("movie_id"), identity)
+	case "studios_and_movies":
+		return exportQueryParquet[models.StudiosAndMovies](s.db, dw, s.db.Table(dataset).Order("movie_id"), identity)
+	case "countries_and_movies":
+		return exportQueryParquet[models.CountriesAndMovies](s.db, dw, s.db.Table(dataset).Order("movie_id"), identity)
+	case "languages_and_movies":
+		return exportQueryParquet[models.LanguagesAndMovies](s.db, dw, s.db.Table(dataset).Order("movie_id"), identity)
+	case "releases":
+		return exportQueryParquet[models.Release](s.db, dw, s.db.Table(dataset).Order("movie_id"), func(row any) (any, error) {
+			release := row.(models.Release)
+
+			result := releaseRow{
+				MovieId:     release.MovieId,
+				Country:     release.Country,
+				AgeRating:   release.AgeRating,
+				ReleaseType: release.ReleaseType,
+			}
+
+			if date, ok := parquetDate(release.Date); ok {
+				result.Date = &date
+			}
+
+			return result, nil
+		})
+	case "users_and_movies":
+		return exportQueryParquet[models.UserAndMovie](s.db, dw, s.db.Table(dataset).Order("user_id, movie_id, date"), func(row any) (any, error) {
+			return toActivityRow(row.(models.UserAndMovie)), nil
+		})
+	case "movies_view":
+		return s.exportMoviesView(dw)
+	case "activities_view":
+		return s.exportActivitiesView(dw)
+	default:
+		return fmt.Errorf("unknown table or view %s", dataset)
+	}
+}
+
+func (s *Scraper) exportMoviesView(dw *datasetWriter) error {
+	var movies []models.Movie
+
+	if err := s.db.Table("movies").Order("id").FindInBatches(&movies, 1000, func(tx *gorm.DB, batch int) error {
+		ids := make([]int, len(movies))
+		for i, movie := range movies {
+			ids[i] = movie.Id
+		}
+
+		related := map[string]map[int][]string{}
+
+		for name, query := range map[string]*gorm.DB{
+			"genres": s.db.Table("genres_and_movies").Select("movie_id, genres.name").
+				Joins("JOIN genres ON genres.id = genre_id").Order("genres.name"),
+			"themes": s.db.Table("themes_and_movies").Select("movie_id, themes.name").
+				Joins("JOIN themes ON themes.id = theme_id").Order("themes.name"),
+			"studios": s.db.Table("studios_and_movies").Select("movie_id, studios.name").
+				Joins("JOIN studios ON studios.id = studio_id").Order("studios.name"),
+			"casts": s.db.Table("crews_and_movies").Select("movie_id, crews.name").
+				Joins("JOIN crews ON crews.id = crew_id").Where("crews.role = ?", "Actor").Order("crews.id"),
+			"directors": s.db.Table("crews_and_movies").Select("movie_id, crews.name").
+				Joins("JOIN crews ON crews.id = crew_id").Where("crews.role IN ?", []string{"Director", "Directors"}).Order("crews.name"),
+			"countries": s.db.Table("countries_and_movies").Select("movie_id, country AS name").Order("country"),
+			"languages": s.db.Table("languages_and_movies").Select("movie_id, language AS name").Order("is_primary DESC, language"),
+			"releases":  s.db.Table("releases").Select("movie_id, date AS name"),
+		} {
+			var rows []struct {
+				MovieId int
+				Name    string
+			}
+
+			if err := query.Where("movie_id IN ?", ids).Find(&rows).Error; err != nil {
+				return err
+			}
+
+			related[name] = map[int][]string{}
+			for _, row := range rows {
+				related[name][row.MovieId] = append(related[name][row.MovieId], row.Name)
+			}
+		}
+
+		rows := make([]movieViewRow, len(movies))
+
+		for i, movie := range movies {
+			rows[i] = movieViewRow{
+				Movie:     movie,
+				Genres:    utils.OrEmpty(related["genres"][movie.Id]),
+				Themes:    utils.OrEmpty(related["themes"][movie.Id]),
+				Studios:   utils.OrEmpty(related["studios"][movie.Id]),
+				Countries: utils.OrEmpty(related["countries"][movie.Id]),
+				Languages: slices.Compact(utils.OrEmpty(related["languages"][movie.Id])),
+				Casts:     utils.OrEmpty(related["casts"][movie.Id]),
+				Directors: utils.OrEmpty(related["directors"][movie.Id]),
+			}
+
+			for _, date := range related["releases"][movie.Id] {
+				if d, ok := parquetDate(date); ok && (rows[i].ReleaseDate == nil || d < *rows[i].ReleaseDate) {
+					rows[i].ReleaseDate = &d
+				}
+			}
+		}
+
+		return writeParquetRows(dw, rows)
+	}).Error; err != nil {
+		return err
+	}
+
+	return dw.close()
+}
+
+func (s *Scraper) exportActivitiesView(dw *datasetWriter) error {
+	query := s.db.Table("users_and_movies").
+		Select("users_and_movies.*, users.url AS user_url, movies.url AS movie_url, movies.name AS movie_name").
+		Joins("JOIN users ON users.id = users_and_movies.user_id").
+		Joins("JOIN movies ON movies.id = users_and_movies.movie_id").
+		Order("users_and_movies.user_id, users_and_movies.date")
+
+	type activity struct {
+		models.UserAndMovie
+		UserUrl   string
+		MovieUrl  string
+		MovieName string
+	}
+
+	return exportQueryParquet[activity](s.db, dw, query, func(row any) (any, error) {
+		a := row.(activity)
+
+		return activityViewRow{
+			activityRow: toActivityRow(a.UserAndMovie),
+			UserUrl:     a.UserUrl,
+			MovieUrl:    a.MovieUrl,
+			MovieName:   a.MovieName,
+		}, nil
+	})
+}
+
+// exportQueryParquet stream the rows of query, scanned as T and converted by convert, to the files of dw.
+// The rows returned by convert must all have the same type.
+func exportQueryParquet[T any](db *gorm.DB, dw *datasetWriter, query *gorm.DB, convert func(row any) (any, error)) error {
+	rows, err := query.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	batch := []any{}
+
+	for rows.Next() {
+		var row T
+
+		if err := db.ScanRows(rows, &row); err != nil {
+			return err
+		}
+
+		converted, err := convert(row)
+		if err != nil {
+			return err
+		}
+
+		batch = append(batch, converted)
+
+		if len(batch) == 1000 {
+			if err := writeParquetRows(dw, batch); err != nil {
+				return err
+			}
+
+			batch = batch[:0]
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if err := writeParquetRows(dw, batch); err != nil {
+		return err
+	}
+
+	return dw.close()
+}
+
+// datasetWriter write the rows of a dataset to part files of at most rowsPerFile rows, in the dir of their partition
+// if the dataset is partitioned.
+type datasetWriter struct {
+	dir         string
+	rowsPerFile int
+	// partitionOf return the dir of the partition of a row relative to dir, it is nil if the dataset is not partitioned
+	partitionOf func(row any) string
+	partitions  map[string]*partitionWriter
+	rows        int64
+	// files are relative to dir
+	files []string
+}
+
+// partitionWriter write the part files of a partition, or of the whole dataset if it is not partitioned.
+type partitionWriter struct {
+	dir    string
+	file   *os.File
+	writer *parquet.Writer
+	// fileRows is the number of rows in the current file
+	fileRows int
+	parts    int
+}
+
+func newDatasetWriter(dir string, rowsPerFile int) *datasetWriter {
+	return &datasetWriter{dir: dir, rowsPerFile: rowsPerFile, partitions: map[string]*partitionWriter{}}
+}
+
+// writeParquetRows write rows, which are all of the same type, to the files of dw.
+func writeParquetRows[T any](dw *datasetWriter, rows []T) error {
+	for _, row := range rows {
+		partition := ""
+		if dw.partitionOf != nil {
+			partition = dw.partitionOf(row)
+		}
+
+		pw, ok := dw.partitions[partition]
+		if !ok {
+			pw = &partitionWriter{dir: partition}
+			dw.partitions[partition] = pw
+
+			if err := os.MkdirAll(path.Join(dw.dir, partition), 0755); err != nil {
+				return err
+			}
+		}
+
+		if pw.writer == nil {
+			name := path.Join(pw.dir, fmt.Sprintf("part-%05d.parquet", pw.parts))
+
+			f, err := os.Create(path.Join(dw.dir, name))
+			if err != nil {
+				return err
+			}
+
+			schema := parquet.SchemaOf(row)
+			if r, ok := any(row).(schemaRow); ok {
+				schema = r.parquetSchema()
+			}
+
+			pw.file = f
+			pw.writer = parquet.NewWriter(f, schema, parquet.Compression(&parquet.Zstd))
+			pw.parts++
+			dw.files = append(dw.files, name)
+		}
+
+		// The rows are written through a pointer, parquet-go can't read the embedded structs of a value those is not addressable
+		ptr := reflect.New(reflect.TypeOf(row))
+		ptr.Elem().Set(reflect.ValueOf(row))
+
+		if err := pw.writer.Write(ptr.Interface()); err != nil {
+			return err
+		}
+
+		dw.rows++
+		pw.fileRows++
+
+		if pw.fileRows == dw.rowsPerFile {
+			if err := pw.close(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// close flush and close the current file of every partition.
+func (dw *datasetWriter) close() error {
+	for _, pw := range dw.partitions {
+		if err := pw.close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// close flush and close the current file, the next row of the partition is written to a new file.
+func (pw *partitionWriter) close() error {
+	if pw.writer == nil {
+		return nil
+	}
+
+	if err := pw.writer.Close(); err != nil {
+		return err
+	}
+
+	if err := pw.file.Close(); err != nil {
+		return err
+	}
+
+	pw.writer, pw.file, pw.fileRows = nil, nil, 0
+
+	return nil
+}
+
+func toActivityRow(activity models.UserAndMovie) activityRow {
+	row := activityRow{
+		UserId:  activity.UserId,
+		MovieId: activity.MovieId,
+		IsWatch: activity.IsWatch,
+		Rating:  activity.Rating,
+		IsLoved: activity.IsLoved,
+		Review:  activity.Review,
+	}
+
+	// Letterboxd may add milliseconds to the activity dates, they are dropped
+	if len(activity.Date) >= 19 {
+		if date, err := time.Parse("2006-01-02T15:04:05", activity.Date[:19]); err == nil {
+			row.Date = date
+		}
+	}
+
+	return row
+}
+
+// parquetDate convert a release date to the number of days since the Unix epoch, it returns false if the date can't be
+// parsed.
+func parquetDate(date string) (int32, bool) {
+	t, err := time.Parse(releaseDateLayout, strings.TrimSpace(date))
+	if err != nil {
+		return 0, false
+	}
+
+	return int32(t.Unix() / 86400), true
+}
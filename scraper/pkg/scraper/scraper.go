@@ -6,65 +6,83 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
-	"os"
-	"path"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/chromedp/chromedp"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/config"
 	"github.com/leminhohoho/movie-lens/scraper/pkg/models"
 	"github.com/leminhohoho/movie-lens/scraper/pkg/scraper/extractors"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/storage"
 	"github.com/leminhohoho/movie-lens/scraper/pkg/utils"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
 const (
 	prefix = "https://letterboxd.com"
+	// maxFilmsPages is the number of films pages of a user scraped by the crawl, the latest movies first
+	maxFilmsPages = 7
 )
 
-//go:embed setup.sql
-var schema string
-
 //go:embed jquery.slim.min.js
 var jqueryLib string
 
-//go:embed extractors/members_query.js
-var memberQuery string
-
 type Scraper struct {
-	baseCtx  context.Context
-	db       *gorm.DB
-	logger   *slog.Logger
-	errChan  chan error
-	maxPage  int
-	interval int
-	counter  int
+	baseCtx context.Context
+	// closeBrowser close the browser tab of baseCtx and then the browser itself
+	closeBrowser func()
+	store        storage.Storage
+	// db is the connection of store, it is used by the frontier and the exports
+	db         *gorm.DB
+	dbMu       sync.Mutex
+	frontier   *frontier
+	fetchers   map[PageType]Fetcher
+	movieLocks keyedMutex
+	logger     *slog.Logger
+	maxPage    int
+	workers    int
+	retries    retryPolicy
+	// shutdownTimeout is the time given to the running jobs to finish once the crawl is stopped
+	shutdownTimeout time.Duration
+	// movieHooks are called with the id of every movie once it is saved
+	movieHooks []func(movieId int)
 }
 
-func NewScraper(logger *slog.Logger, errChan chan error) (*Scraper, error) {
+func NewScraper(cfg *config.Config, logger *slog.Logger) (*Scraper, error) {
 	var baseCtx context.Context
+	var cancelAllocator, cancelBrowser context.CancelFunc
+
+	proxyURL := cfg.ProxyURL
+	browserAddr := cfg.BrowserAddr
+	userDataDir := cfg.UserDataDir
+
+	dsn := cfg.DSN
+	if dsn == "" {
+		dsn = cfg.DBPath
+	}
 
-	dbPath := os.Getenv("DB_PATH")
-	proxyURL := os.Getenv("PROXY_URL")
-	browserAddr := os.Getenv("BROWSER_ADDR")
-	userDataDir := os.Getenv("USER_DATA_DIR")
-	maxPage, err := strconv.Atoi(os.Getenv("MAX_PAGE"))
+	store, err := storage.Open(dsn, logger)
 	if err != nil {
 		return nil, err
 	}
-	interval, err := strconv.Atoi(os.Getenv("INTERVAL"))
+
+	th := newThrottle(logger, cfg.Interval, time.Second*300, time.Millisecond*time.Duration(cfg.RequestGap))
+
+	fetchers, err := newFetchers(th, logger, cfg)
 	if err != nil {
 		return nil, err
 	}
 
+	// The browser is only started once the first tab is opened
 	if browserAddr != "" {
-		baseCtx, _ = chromedp.NewRemoteAllocator(context.Background(), browserAddr)
+		baseCtx, cancelAllocator = chromedp.NewRemoteAllocator(context.Background(), browserAddr)
 	} else {
 		opts := []func(*chromedp.ExecAllocator){
-			chromedp.Flag("headless", os.Getenv("HEADLESS") == "TRUE"),
+			chromedp.Flag("headless", cfg.Headless),
 			// NOTE: More options will be added in the future
 		}
 
@@ -76,402 +94,656 @@ func NewScraper(logger *slog.Logger, errChan chan error) (*Scraper, error) {
 			opts = append(opts, chromedp.UserDataDir(userDataDir))
 		}
 
-		baseCtx, _ = chromedp.NewExecAllocator(context.Background(), opts...)
+		baseCtx, cancelAllocator = chromedp.NewExecAllocator(context.Background(), opts...)
 	}
 
-	baseCtx, _ = chromedp.NewContext(baseCtx)
+	baseCtx, cancelBrowser = chromedp.NewContext(baseCtx)
 
-	var newDB bool
+	return &Scraper{
+		baseCtx: baseCtx,
+		closeBrowser: func() {
+			cancelBrowser()
+			cancelAllocator()
+		},
+		store:           store,
+		db:              store.DB(),
+		frontier:        newFrontier(store.DB(), logger),
+		fetchers:        fetchers,
+		logger:          logger,
+		maxPage:         cfg.MaxPage,
+		workers:         max(cfg.Workers, 1),
+		retries:         newRetryPolicy(cfg),
+		shutdownTimeout: time.Second * time.Duration(cfg.ShutdownTimeout),
+	}, nil
+}
+
+// Close close the browser, killing it if it was started by the scraper, and the db connection.
+// It must be called once every crawl or scrape is finished.
+func (s *Scraper) Close() error {
+	s.closeBrowser()
+
+	return s.store.Close()
+}
+
+// Storage return the storage of the scraped models, for the commands those work on the scraped dataset.
+func (s *Scraper) Storage() storage.Storage {
+	return s.store
+}
+
+// OnMovieSaved register a function called with the id of every movie once it is saved by the crawl or a scrape
+// (e.g. to add the movie to the movie index). It must be registered before the crawl starts, the workers call it
+// concurrently.
+func (s *Scraper) OnMovieSaved(hook func(movieId int)) {
+	s.movieHooks = append(s.movieHooks, hook)
+}
+
+// fetch get a page with the fetcher configured for its page type.
+func (s *Scraper) fetch(ctx context.Context, pageType PageType, url string) (*goquery.Document, error) {
+	return s.fetchers[pageType].Fetch(ctx, url)
+}
 
-	if _, err := os.Stat(dbPath); err != nil {
-		if !os.IsNotExist(err) {
-			return nil, err
+// needsBrowser report whether any page type is fetched with chromedp.
+func (s *Scraper) needsBrowser() bool {
+	for _, f := range s.fetchers {
+		if recording, ok := f.(*recordingFetcher); ok {
+			f = recording.Fetcher
 		}
 
-		f, err := os.Create(dbPath)
-		if err != nil {
-			return nil, err
+		if _, ok := f.(*chromedpFetcher); ok {
+			return true
 		}
-		defer f.Close()
+	}
 
-		newDB = true
+	return false
+}
+
+// Summary is the outcome of a crawl.
+type Summary struct {
+	Duration time.Duration
+	// Done and Failed are the numbers of jobs completed and failed during the crawl
+	Done   int64
+	Failed int64
+	// Pending is the number of jobs left in the frontier for the next crawl
+	Pending int64
+	// Interrupted is true if the crawl was stopped before the frontier was empty
+	Interrupted bool
+}
+
+// errShutdownTimeout interrupt the running jobs those didn't finish in time once the crawl is stopped.
+var errShutdownTimeout = errors.New("shutdown timeout exceeded")
+
+// Run crawl letterboxd with the pool of workers until the frontier is empty or ctx is done.
+// Once ctx is done, the workers stop taking new jobs and the running jobs are given shutdownTimeout to finish writing,
+// the jobs those are interrupted are put back to the frontier.
+func (s *Scraper) Run(ctx context.Context) (Summary, error) {
+	start := time.Now()
+
+	if err := s.frontier.recover(); err != nil {
+		return Summary{}, err
 	}
 
-	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
-	if err != nil {
-		return nil, err
+	membersPages := make([]string, s.maxPage)
+	for i := range s.maxPage {
+		membersPages[i] = membersPageUrl(i + 3)
 	}
 
-	if newDB {
-		if err := db.Exec(schema).Error; err != nil {
-			return nil, err
-		}
+	if err := s.frontier.push(jobMembersPage, membersPages...); err != nil {
+		return Summary{}, err
 	}
 
-	return &Scraper{
-		baseCtx:  baseCtx,
-		db:       db,
-		logger:   logger,
-		errChan:  errChan,
-		maxPage:  maxPage,
-		interval: interval,
-	}, nil
-}
+	// The jobs don't run with ctx, so that they are not interrupted as soon as the crawl is stopped
+	jobCtx, stop := context.WithCancelCause(s.baseCtx)
+	defer stop(nil)
+
+	stopShutdownTimer := context.AfterFunc(ctx, func() {
+		s.logger.Info("crawl stopped, waiting for the running jobs", "timeout", s.shutdownTimeout.String())
+		time.AfterFunc(s.shutdownTimeout, func() { stop(errShutdownTimeout) })
+	})
+	defer stopShutdownTimer()
+
+	var wg sync.WaitGroup
+	var busy atomic.Int32
+	var done, failed atomic.Int64
+
+	for i := range s.workers {
+		wg.Add(1)
 
-func (s *Scraper) execute(ctx context.Context, actions ...chromedp.Action) error {
-	if s.counter == s.interval {
-		s.logger.Info("Sleep for 5 minutes")
-		time.Sleep(time.Second * 300)
-		s.counter = 0
+		go func() {
+			defer wg.Done()
+
+			if err := s.work(ctx, jobCtx, i+1, &busy, &done, &failed); err != nil {
+				stop(err)
+			}
+		}()
 	}
 
-	s.counter++
+	wg.Wait()
 
-	return chromedp.Run(ctx, actions...)
-}
+	summary := Summary{
+		Duration:    time.Since(start),
+		Done:        done.Load(),
+		Failed:      failed.Load(),
+		Interrupted: ctx.Err() != nil,
+	}
 
-func (s *Scraper) Run() {
-	ctx, cancel, err := utils.NewTab(s.baseCtx, s.logger,
-		chromedp.EmulateViewport(720, 1280),
-		utils.InjectLibToCdp(jqueryLib, s.logger),
-	)
+	pending, err := s.frontier.count(statusPending)
 	if err != nil {
-		s.errChan <- err
-		return
+		return summary, err
 	}
 
-	defer cancel()
+	summary.Pending = pending
 
-	if err := s.scrapeMembersPages(ctx); err != nil {
-		s.errChan <- err
+	if err := context.Cause(jobCtx); err != nil && !errors.Is(err, errShutdownTimeout) {
+		return summary, err
 	}
+
+	if summary.Interrupted {
+		s.logger.Info("crawl interrupted", "done", summary.Done, "pending", summary.Pending)
+	} else {
+		s.logger.Info("frontier is empty, crawl finished", "done", summary.Done)
+	}
+
+	return summary, nil
 }
 
-func (s *Scraper) scrapeMembersPages(ctx context.Context) error {
+// Requeue put the failed jobs back into the frontier, so that they are scraped again by the next crawl.
+// The jobs can be filtered by error class (e.g. http) and kind (e.g. activity), every failed job is re-queued if both are empty.
+// It returns the number of re-queued jobs.
+func (s *Scraper) Requeue(class string, kind string) (int64, error) {
+	return s.frontier.requeue(class, kind)
+}
 
-	for i := range s.maxPage {
-		var users []models.User
-
-		if err := s.execute(ctx,
-			utils.NavigateTillTrigger(
-				chromedp.Navigate("https://letterboxd.com"+fmt.Sprintf("/members/popular/page/%d/", i+3)), s.logger,
-				chromedp.WaitVisible("#content > div > div > section > table > tbody > tr:last-child"),
-				utils.Delay(time.Millisecond*1500, time.Millisecond*300),
-			),
-			utils.ScreenShot(os.Getenv("SCREENSHOT_DIR"), s.logger, time.Now(), fmt.Sprintf("member-page-%d", i+1)),
-			chromedp.EvaluateAsDevTools(memberQuery, &users, chromedp.EvalAsValue),
-		); err != nil {
+// work is the loop of a single worker. Every worker owns a tab and pulls jobs from the frontier until it is empty or ctx is done.
+// The jobs are run with jobCtx, which outlives ctx.
+// busy counts the workers those are holding a job, since a running job may still push new jobs to the frontier.
+func (s *Scraper) work(
+	ctx context.Context, jobCtx context.Context, id int, busy *atomic.Int32, done *atomic.Int64, failed *atomic.Int64,
+) error {
+	tabCtx, cancel, err := s.newTab(jobCtx)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	for ctx.Err() == nil && jobCtx.Err() == nil {
+		busy.Add(1)
+
+		job, err := s.frontier.next()
+		if err != nil {
+			busy.Add(-1)
 			return err
 		}
 
-		for j := range users {
-			if err := utils.InsertOrUpdate(s.db, s.logger, "users", &users[j], "url = ?", users[j].Url); err != nil {
-				return err
+		if job == nil {
+			if busy.Add(-1) == 0 {
+				return nil
+			}
+
+			if err := sleep(ctx, time.Second); err != nil {
+				return nil
+			}
+
+			continue
+		}
+
+		s.logger.Info("job started", "worker", id, "kind", job.Kind, "url", job.Url, "attempt", job.Attempts)
+
+		err = s.runJobWithRetries(ctx, tabCtx, job)
+
+		busy.Add(-1)
+
+		if err != nil {
+			// The job was interrupted by the shutdown timeout, another worker's failure or the crawl being stopped during a retry delay
+			if jobCtx.Err() != nil || errors.Is(err, errRetryInterrupted) {
+				if err := s.frontier.release(job); err != nil {
+					s.logger.Error("unable to put the job back to the frontier", "msg", err.Error())
+				}
+
+				if jobCtx.Err() != nil {
+					return nil
+				}
+
+				continue
+			}
+
+			failed.Add(1)
+
+			if err := s.frontier.fail(job, err); err != nil {
+				s.logger.Error("unable to mark job as failed", "msg", err.Error())
 			}
 
-			if err := s.scrapeUserPage(ctx, users[j]); err != nil {
+			// Only the errors those are not caused by the page stop the crawl
+			if classOf(err) == ClassInternal {
 				return err
 			}
+
+			s.logger.Error("job failed, giving up", "worker", id, "kind", job.Kind, "url", job.Url, "attempts", job.Attempts, "msg", err.Error())
+
+			continue
 		}
+
+		if err := s.frontier.done(job); err != nil {
+			return err
+		}
+
+		done.Add(1)
 	}
 
 	return nil
 }
 
-func (s *Scraper) scrapeUserPage(ctx context.Context, user models.User) error {
-	var maxFilmsPageStr string
-	nextBtnSel := "#content > div > div > section > div.pagination > div:nth-child(2) > a"
-	lastPageSel := "#content > div > div > section > div.pagination > div.paginate-pages > ul > li:last-child > a"
-	lastMovieSel := "#content > div > div > section > div.poster-grid > ul > li:last-child > div > div > a > span.overlay"
-
-	if err := s.execute(ctx,
-		utils.NavigateTillTrigger(
-			chromedp.Navigate(prefix+user.Url+"films/by/date/"), s.logger,
-			chromedp.WaitVisible(lastMovieSel),
-			utils.Delay(time.Millisecond*1500, time.Millisecond*300),
-		),
-		utils.ScreenShot(os.Getenv("SCREENSHOT_DIR"), s.logger, time.Now(), "user-page", user.Name),
-		chromedp.Text(lastPageSel, &maxFilmsPageStr),
-	); err != nil {
+// errRetryInterrupted is returned when the crawl is stopped while a job is waiting for its next attempt.
+var errRetryInterrupted = errors.New("retry interrupted")
+
+// runJobWithRetries run a job with tabCtx and retry it according to the retry policy, until it succeed or it is given up.
+// The retry delays are cut short once ctx is done.
+func (s *Scraper) runJobWithRetries(ctx context.Context, tabCtx context.Context, job *models.CrawlJob) error {
+	for {
+		err := s.runJob(tabCtx, job)
+		if err == nil || tabCtx.Err() != nil {
+			return err
+		}
+
+		delay, retry := s.retries.backoff(err, job.Attempts)
+		if !retry {
+			return err
+		}
+
+		s.logger.Warn("job failed, retrying", "kind", job.Kind, "url", job.Url, "attempt", job.Attempts, "delay", delay.String(), "msg", err.Error())
+
+		if err := s.frontier.retry(job, err); err != nil {
+			return err
+		}
+
+		if err := sleep(ctx, delay); err != nil {
+			return errRetryInterrupted
+		}
+	}
+}
+
+// withRetries run fn, those scrape url outside of the crawl, and retry it according to the retry policy of the jobs
+// until it succeed or it is given up. The retry delays are cut short once ctx is done.
+func (s *Scraper) withRetries(ctx context.Context, url string, fn func() error) error {
+	for attempts := 1; ; attempts++ {
+		err := fn()
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+
+		delay, retry := s.retries.backoff(err, attempts)
+		if !retry {
+			return err
+		}
+
+		s.logger.Warn("scrape failed, retrying", "url", url, "attempt", attempts, "delay", delay.String(), "msg", err.Error())
+
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// withBrowser return a context of the browser those is cancelled along with ctx.
+func (s *Scraper) withBrowser(ctx context.Context) (context.Context, context.CancelFunc) {
+	browserCtx, cancel := context.WithCancel(s.baseCtx)
+	stop := context.AfterFunc(ctx, cancel)
+
+	return browserCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// newTab open the browser tab the pages are fetched in.
+// No browser is started if every page type is fetched without chromedp, ctx is returned as is.
+func (s *Scraper) newTab(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	if !s.needsBrowser() {
+		return ctx, func() {}, nil
+	}
+
+	return utils.NewTab(ctx, s.logger,
+		chromedp.EmulateViewport(720, 1280),
+		utils.InjectLibToCdp(jqueryLib, s.logger),
+	)
+}
+
+// ScrapeMovie scrape a single movie, outside of the crawl.
+// The movie is scraped again if it is already in the db, its details are updated and the missing relations are added.
+// The failed pages are retried according to the retry policy of the jobs.
+func (s *Scraper) ScrapeMovie(ctx context.Context, filmUrl string) error {
+	browserCtx, cancelBrowser := s.withBrowser(ctx)
+	defer cancelBrowser()
+
+	tabCtx, cancel, err := s.newTab(browserCtx)
+	if err != nil {
 		return err
 	}
+	defer cancel()
 
-	maxFilmsPage, err := strconv.Atoi(strings.TrimSpace(maxFilmsPageStr))
+	return s.withRetries(ctx, filmUrl, func() error { return s.scrapeMovie(tabCtx, filmUrl) })
+}
+
+// ScrapeUser scrape a single user and the activities on every movie in its films pages, outside of the crawl.
+// It stops before the next activity once ctx is done.
+func (s *Scraper) ScrapeUser(ctx context.Context, userUrl string) error {
+	return s.ImportUser(ctx, userUrl, maxFilmsPages, nil)
+}
+
+// ImportUser scrape a single user on demand (e.g. a user asking for recommendations) and the activities on the movies
+// of its first maxPages films pages, the latest movies first. progress, if not nil, is called with the number of
+// activities scraped and to scrape once the pages are listed and after every activity.
+// The failed pages are retried according to the retry policy of the jobs, the activities those are still failing are
+// skipped but the import fails if the films pages can't be scraped. It stops before the next activity once ctx is done.
+func (s *Scraper) ImportUser(ctx context.Context, userUrl string, maxPages int, progress func(done int, total int)) error {
+	browserCtx, cancelBrowser := s.withBrowser(ctx)
+	defer cancelBrowser()
+
+	tabCtx, cancel, err := s.newTab(browserCtx)
 	if err != nil {
 		return err
 	}
+	defer cancel()
 
-	for i := 1; i <= min(maxFilmsPage, 7); i++ {
-		var doc *goquery.Document
+	if err := s.withRetries(ctx, userUrl, func() error { return s.saveUser(tabCtx, userUrl) }); err != nil {
+		return err
+	}
 
-		if err := s.execute(ctx,
-			chromedp.ActionFunc(func(localCtx context.Context) error {
-				if i != 1 {
-					return chromedp.Click(nextBtnSel).Do(localCtx)
-				}
+	var filmsPages []string
 
-				return nil
-			}),
-			chromedp.WaitVisible(lastMovieSel),
-			utils.Delay(time.Millisecond*1500, time.Millisecond*300),
-			utils.ScreenShot(os.Getenv("SCREENSHOT_DIR"), s.logger, time.Now(), "user-page", user.Name),
-			utils.ToGoqueryDoc("html", &doc),
-		); err != nil {
+	if err := s.withRetries(ctx, userUrl, func() (err error) {
+		filmsPages, err = s.userFilmsPages(tabCtx, userUrl, maxPages)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	var activityUrls []string
+
+	for _, filmsPage := range filmsPages {
+		var urls []string
+
+		if err := s.withRetries(ctx, filmsPage, func() (err error) {
+			urls, err = s.userActivityUrls(tabCtx, filmsPage)
 			return err
-		}
-		filmUrls, err := extractors.ExtractMovieUrls(doc.Selection, s.logger)
-		if err != nil {
+		}); err != nil {
 			return err
 		}
 
-		for _, filmUrl := range filmUrls {
-			moviePageCtx, moviePageCancel, err := utils.NewTab(ctx, s.logger,
-				chromedp.EmulateViewport(720, 1280),
-				utils.InjectLibToCdp(jqueryLib, s.logger),
-			)
-			if err != nil {
-				return err
-			}
+		activityUrls = append(activityUrls, urls...)
+	}
 
-			if err := s.scrapeMovie(moviePageCtx, filmUrl); err != nil {
-				return err
-			}
+	if progress != nil {
+		progress(0, len(activityUrls))
+	}
 
-			var movie models.Movie
+	for i, url := range activityUrls {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
-			if err := s.db.Table("movies").Where("url = ?", filmUrl).First(&movie).Error; err != nil {
-				return err
-			}
+		err := s.withRetries(ctx, url, func() error { return s.scrapeActivity(tabCtx, url) })
 
-			if err := s.scrapeUserFilmActivities(moviePageCtx, user, movie); err != nil {
-				return err
-			}
+		// An activity those can't be scraped is skipped, only the errors those are not caused by the page stop the import
+		if err != nil && (ctx.Err() != nil || classOf(err) == ClassInternal) {
+			return err
+		} else if err != nil {
+			s.logger.Error("activity failed, skipping it", "user", userUrl, "url", url, "class", classOf(err), "msg", err.Error())
+		}
 
-			moviePageCancel()
+		if progress != nil {
+			progress(i+1, len(activityUrls))
 		}
 	}
 
 	return nil
 }
 
-func (s *Scraper) scrapeMovie(ctx context.Context, filmUrl string) error {
-	if s.db.Table("movies").Where("url = ?", filmUrl).Find(&[]models.Movie{}).RowsAffected > 0 {
-		s.logger.Warn("movie already in db, skipping", "url", filmUrl)
-		return nil
+// saveUser scrape the profile of a user from its films page.
+func (s *Scraper) saveUser(ctx context.Context, userUrl string) error {
+	doc, err := s.fetch(ctx, FilmsPage, userUrl+"films/by/date/")
+	if err != nil {
+		return err
 	}
 
-	var doc *goquery.Document
+	user, err := extractors.ExtractUser(userUrl, doc.Selection, s.logger)
+	if err != nil {
+		return parseError(userUrl, err)
+	}
 
-	if err := s.execute(ctx,
-		utils.NavigateTillTrigger(
-			chromedp.Navigate(prefix+filmUrl), s.logger,
-			utils.Delay(time.Millisecond*1500, time.Millisecond*300),
-			chromedp.ActionFunc(func(localCtx context.Context) error {
-				var backdropExists bool
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
 
-				if err := chromedp.Evaluate(`document.querySelector("#backdrop") != null`, &backdropExists).Do(localCtx); err != nil {
-					return err
-				}
+	_, err = s.store.SaveUsers([]models.User{user})
 
-				if backdropExists {
-					return chromedp.Tasks{
-						chromedp.WaitVisible(`body.backdrop-loaded`),
-						chromedp.WaitVisible(`#js-poster-col > section.poster-list.-p230.-single.no-hover.el.col > div.react-component > div > img[srcset]`),
-					}.Do(localCtx)
-				}
+	return err
+}
 
-				return nil
-			}),
-			utils.Delay(time.Millisecond*1500, time.Millisecond*300),
-		),
-		utils.ScreenShot(os.Getenv("SCREENSHOT_DIR"), s.logger, time.Now(), strings.Split(filmUrl, "/")[2]),
-		utils.ToGoqueryDoc("html", &doc),
-	); err != nil {
+func (s *Scraper) runJob(ctx context.Context, job *models.CrawlJob) error {
+	switch jobKind(job.Kind) {
+	case jobMembersPage:
+		return s.scrapeMembersPage(ctx, job.Url)
+	case jobUser:
+		return s.scrapeUserPage(ctx, job.Url)
+	case jobUserFilms:
+		return s.scrapeUserFilmsPage(ctx, job.Url)
+	case jobActivity:
+		return s.scrapeActivity(ctx, job.Url)
+	default:
+		return fmt.Errorf("unknown job kind %s", job.Kind)
+	}
+}
+
+func (s *Scraper) scrapeMembersPage(ctx context.Context, pageUrl string) error {
+	doc, err := s.fetch(ctx, MembersPage, pageUrl)
+	if err != nil {
 		return err
 	}
 
-	// ---------------- SCRAPE MOVIE ----------------- //
-	movie, err := extractors.ExtractMovie(filmUrl, doc.Selection, s.logger)
+	users, err := extractors.ExtractUsers(doc.Selection, s.logger)
 	if err != nil {
-		s.logger.Error("error extracting information from movie", "msg", err.Error())
-		return nil
+		return parseError(pageUrl, err)
 	}
 
-	if err := utils.InsertOrUpdate(s.db, s.logger, "movies", &movie, "url = ?", movie.Url); err != nil {
+	userUrls := make([]string, len(users))
+	for i := range users {
+		userUrls[i] = users[i].Url
+	}
+
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
+
+	if _, err := s.store.SaveUsers(users); err != nil {
 		return err
 	}
 
-	// ---------------- SCRAPE CASTS ----------------- //
-	casts, err := extractors.ExtractCasts(doc.Selection, s.logger)
+	return s.frontier.push(jobUser, userUrls...)
+}
+
+func (s *Scraper) scrapeUserPage(ctx context.Context, userUrl string) error {
+	filmsPages, err := s.userFilmsPages(ctx, userUrl, maxFilmsPages)
 	if err != nil {
 		return err
 	}
 
-	for i := range casts {
-		if err := utils.InsertOrUpdate(s.db, s.logger, "crews", &casts[i], "url = ?", casts[i].Url); err != nil {
-			return err
-		}
+	return s.frontier.push(jobUserFilms, filmsPages...)
+}
 
-		if err := utils.InsertOrUpdate(
-			s.db, s.logger, "crews_and_movies",
-			&models.CrewsAndMovies{MovieId: movie.Id, CrewId: casts[i].Id},
-			&models.CrewsAndMovies{MovieId: movie.Id, CrewId: casts[i].Id},
-		); err != nil {
-			return err
+// userFilmsPages return the urls of the films pages of a user, only the first maxPages pages are kept.
+func (s *Scraper) userFilmsPages(ctx context.Context, userUrl string, maxPages int) ([]string, error) {
+	lastPageSel := "#content > div > div > section > div.pagination > div.paginate-pages > ul > li:last-child > a"
+
+	doc, err := s.fetch(ctx, FilmsPage, userUrl+"films/by/date/")
+	if err != nil {
+		return nil, err
+	}
+
+	maxFilmsPage := 1
+
+	// Users with a single page of films have no pagination
+	if maxFilmsPageStr := strings.TrimSpace(doc.Find(lastPageSel).Text()); maxFilmsPageStr != "" {
+		maxFilmsPage, err = strconv.Atoi(maxFilmsPageStr)
+		if err != nil {
+			return nil, parseError(userUrl, err)
 		}
 	}
 
-	// ---------------- SCRAPE GENRES & THEMES ----------------- //
-	genres, themes, err := extractors.ExtractGenresAndThemes(doc.Selection, s.logger)
+	filmsPages := []string{}
+	for i := 1; i <= min(maxFilmsPage, maxPages); i++ {
+		filmsPages = append(filmsPages, userFilmsPageUrl(userUrl, i))
+	}
+
+	return filmsPages, nil
+}
+
+func (s *Scraper) scrapeUserFilmsPage(ctx context.Context, pageUrl string) error {
+	activityUrls, err := s.userActivityUrls(ctx, pageUrl)
 	if err != nil {
 		return err
 	}
 
-	for i := range genres {
-		if err := utils.InsertOrUpdate(s.db, s.logger, "genres", &genres[i], "url = ?", genres[i].Url); err != nil {
-			return err
-		}
+	return s.frontier.push(jobActivity, activityUrls...)
+}
 
-		if err := utils.InsertOrUpdate(
-			s.db, s.logger, "genres_and_movies",
-			&models.GenresAndMovies{MovieId: movie.Id, GenreId: genres[i].Id},
-			&models.GenresAndMovies{MovieId: movie.Id, GenreId: genres[i].Id},
-		); err != nil {
-			return err
-		}
+// userActivityUrls return the urls of the activity pages of every movie in a films page of a user.
+func (s *Scraper) userActivityUrls(ctx context.Context, pageUrl string) ([]string, error) {
+	doc, err := s.fetch(ctx, FilmsPage, pageUrl)
+	if err != nil {
+		return nil, err
 	}
 
-	for i := range themes {
-		if err := utils.InsertOrUpdate(s.db, s.logger, "themes", &themes[i], "url = ?", themes[i].Url); err != nil {
-			return err
-		}
+	filmUrls, err := extractors.ExtractMovieUrls(doc.Selection, s.logger)
+	if err != nil {
+		return nil, parseError(pageUrl, err)
+	}
 
-		if err := utils.InsertOrUpdate(
-			s.db, s.logger, "themes_and_movies",
-			&models.ThemesAndMovies{MovieId: movie.Id, ThemeId: themes[i].Id},
-			&models.ThemesAndMovies{MovieId: movie.Id, ThemeId: themes[i].Id},
-		); err != nil {
-			return err
-		}
+	userUrl := userUrlOf(pageUrl)
+	activityUrls := make([]string, len(filmUrls))
+
+	for i, filmUrl := range filmUrls {
+		activityUrls[i] = activityUrl(userUrl, filmUrl)
 	}
 
-	// ---------------- SCRAPE CREWS ----------------- //
-	crews, err := extractors.ExtractCrews(doc.Selection, s.logger)
+	return activityUrls, nil
+}
+
+// scrapeActivity scrape the movie of an activity page if it is not in the db yet, then the user's activities on that movie.
+func (s *Scraper) scrapeActivity(ctx context.Context, url string) error {
+	filmUrl, err := filmUrlOf(url)
+	if err != nil {
+		return parseError(url, err)
+	}
+
+	user, err := s.store.UserByUrl(userUrlOf(url))
 	if err != nil {
 		return err
 	}
 
-	for i := range crews {
-		if err := utils.InsertOrUpdate(s.db, s.logger, "crews", &crews[i], "url = ?", crews[i].Url); err != nil {
-			return err
-		}
+	unlock := s.movieLocks.lock(filmUrl)
 
-		if err := utils.InsertOrUpdate(
-			s.db, s.logger, "crews_and_movies",
-			&models.CrewsAndMovies{MovieId: movie.Id, CrewId: crews[i].Id},
-			&models.CrewsAndMovies{MovieId: movie.Id, CrewId: crews[i].Id},
-		); err != nil {
-			return err
-		}
+	_, err = s.store.MovieByUrl(filmUrl)
+	switch {
+	case err == nil:
+		s.logger.Warn("movie already in db, skipping", "url", filmUrl)
+	case errors.Is(err, storage.ErrNotFound):
+		err = s.scrapeMovie(ctx, filmUrl)
 	}
 
-	// ---------------- SCRAPE STUDIOS ----------------- //
-	studios, err := extractors.ExtractStudios(doc.Selection, s.logger)
+	unlock()
+
 	if err != nil {
 		return err
+	}
 
+	movie, err := s.store.MovieByUrl(filmUrl)
+	if err != nil {
+		return err
 	}
 
-	for i := range studios {
-		if err := utils.InsertOrUpdate(s.db, s.logger, "studios", &studios[i], "url = ?", studios[i].Url); err != nil {
-			return err
-		}
+	return s.scrapeUserFilmActivities(ctx, user, movie)
+}
 
-		if err := utils.InsertOrUpdate(
-			s.db, s.logger, "studios_and_movies",
-			&models.StudiosAndMovies{MovieId: movie.Id, StudioId: studios[i].Id},
-			&models.StudiosAndMovies{MovieId: movie.Id, StudioId: studios[i].Id},
-		); err != nil {
-			return err
-		}
+func (s *Scraper) scrapeMovie(ctx context.Context, filmUrl string) error {
+	doc, err := s.fetch(ctx, MoviePage, filmUrl)
+	if err != nil {
+		return err
 	}
 
-	// ---------------- SCRAPE COUNTRIES ----------------- //
-	countries, err := extractors.ExtractCountries(movie.Id, doc.Selection, s.logger)
+	var details models.MovieDetails
+
+	details.Movie, err = extractors.ExtractMovie(filmUrl, doc.Selection, s.logger)
 	if err != nil {
-		return err
+		return parseError(filmUrl, err)
 	}
 
-	for i := range countries {
-		if err := utils.InsertOrUpdate(
-			s.db, s.logger, "countries_and_movies", &countries[i],
-			"movie_id = ? AND country = ?",
-			countries[i].MovieId, countries[i].Country,
-		); err != nil {
-			return err
-		}
+	casts, err := extractors.ExtractCasts(doc.Selection, s.logger)
+	if err != nil {
+		return parseError(filmUrl, err)
 	}
 
-	// ---------------- SCRAPE LANGUAGES ----------------- //
-	languages, err := extractors.ExtractLanguages(movie.Id, doc.Selection, s.logger)
+	crews, err := extractors.ExtractCrews(doc.Selection, s.logger)
 	if err != nil {
-		return err
+		return parseError(filmUrl, err)
 	}
 
-	for i := range languages {
-		if err := utils.InsertOrUpdate(
-			s.db, s.logger, "languages_and_movies", &languages[i],
-			"movie_id = ? AND language = ? AND is_primary = ?",
-			languages[i].MovieId, languages[i].Language, languages[i].IsPrimary,
-		); err != nil {
-			return err
-		}
+	details.Crews = append(casts, crews...)
+
+	details.Genres, details.Themes, err = extractors.ExtractGenresAndThemes(doc.Selection, s.logger)
+	if err != nil {
+		return parseError(filmUrl, err)
+	}
+
+	details.Studios, err = extractors.ExtractStudios(doc.Selection, s.logger)
+	if err != nil {
+		return parseError(filmUrl, err)
+	}
+
+	// The movie id is only known once the movie is written, it is set by saveMovie
+	details.Countries, err = extractors.ExtractCountries(0, doc.Selection, s.logger)
+	if err != nil {
+		return parseError(filmUrl, err)
+	}
+
+	details.Languages, err = extractors.ExtractLanguages(0, doc.Selection, s.logger)
+	if err != nil {
+		return parseError(filmUrl, err)
+	}
+
+	details.Releases, err = extractors.ExtractReleases(0, doc.Selection, s.logger)
+	if err != nil {
+		return parseError(filmUrl, err)
 	}
 
-	// ---------------- SCRAPE LANGUAGES ----------------- //
-	releases, err := extractors.ExtractReleases(movie.Id, doc.Selection, s.logger)
+	// Workers scrape pages concurrently but share crews, genres, themes and studios, so the writes are serialized
+	s.dbMu.Lock()
+	movieId, err := s.store.SaveMovie(&details)
+	s.dbMu.Unlock()
+
 	if err != nil {
 		return err
 	}
 
-	for i := range releases {
-		if err := utils.InsertOrUpdate(
-			s.db, s.logger, "releases",
-			&releases[i],
-			&releases[i],
-			"movie_id", "date", "release_type", "country", "age_rating",
-		); err != nil {
-			return err
-		}
+	for _, hook := range s.movieHooks {
+		hook(movieId)
 	}
 
 	return nil
 }
 
 func (s *Scraper) scrapeUserFilmActivities(ctx context.Context, user models.User, movie models.Movie) error {
-	if s.db.Table("users_and_movies").Where("movie_id = ? AND user_id = ?", movie.Id, user.Id).Find(&[]models.UserAndMovie{}).RowsAffected > 0 {
+	exists, err := s.store.HasActivities(user.Id, movie.Id)
+	if err != nil {
+		return err
+	}
+
+	if exists {
 		s.logger.Warn("activity already in db, skipping", "user_id", user.Id, "movie_id", movie.Id)
 		return nil
 	}
 
 	s.logger.Warn("scraping user activity", "movie_id", movie.Id, "user_id", user.Id)
 
-	url := prefix + path.Join(user.Url, movie.Url, "/activity")
-
-	var doc *goquery.Document
-
-	if err := s.execute(ctx,
-		utils.NavigateTillTrigger(
-			chromedp.Navigate(url), s.logger,
-			utils.Delay(time.Millisecond*1500, time.Millisecond*300),
-			chromedp.WaitVisible("#activity-table-body > section.activity-row.no-activity-message > p"),
-			utils.Delay(time.Millisecond*1500, time.Millisecond*300),
-		),
-		utils.ScreenShot(
-			os.Getenv("SCREENSHOT_DIR"), s.logger, time.Now(), "user-activity-page", user.Name, movie.Name,
-		),
-		utils.ToGoqueryDoc("html", &doc),
-	); err != nil {
+	doc, err := s.fetch(ctx, ActivityPage, activityUrl(user.Url, movie.Url))
+	if err != nil {
 		return err
 	}
 
@@ -523,21 +795,11 @@ func (s *Scraper) scrapeUserFilmActivities(ctx context.Context, user models.User
 				continue
 			}
 
-			reviewPageCtx, reviewPageCancel, err := utils.NewTab(ctx, s.logger,
-				chromedp.EmulateViewport(360, 640),
-				utils.InjectLibToCdp(jqueryLib, s.logger),
-			)
+			review, err := s.scrapeUserReviewPage(ctx, reviewUrl)
 			if err != nil {
 				return err
 			}
 
-			review, err := s.scrapeUserReviewPage(reviewPageCtx, reviewUrl)
-			if err != nil {
-				return err
-			}
-
-			reviewPageCancel()
-
 			if review != "" {
 				userAndMovie.Review = &review
 			}
@@ -551,80 +813,33 @@ func (s *Scraper) scrapeUserFilmActivities(ctx context.Context, user models.User
 		usersAndMovies = append(usersAndMovies, userAndMovie)
 	}
 
-	for _, userAndMovie := range usersAndMovies {
-		if err := utils.InsertOrUpdate(s.db, s.logger,
-			"users_and_movies",
-			&userAndMovie,
-			&userAndMovie,
-			"user_id", "movie_id", "date",
-		); err != nil {
-			return err
-		}
-	}
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
 
-	return nil
+	return s.store.SaveActivities(usersAndMovies)
 }
 
-var errReviewRemoved = errors.New("review has been removed")
+const (
+	reviewContentSel = "#content > div > div > section > section > div.review.body-text.-prose.-hero.-loose > div > div > div"
+	moviePosterSel   = "#content > div > div > section > div.col-4.gutter-right-1 > section.poster-list.-p150.el.col.viewing-poster-container > div > div > a > span.overlay"
+	spoilerBtnSel    = "#content > div > div > section > section > div.review.body-text.-prose.-hero.-loose > div.js-spoiler-container > div > div > a"
+	reviewRemovedSel = "#content > div > div > section > section > div.review.body-text.-prose.-hero.-loose > div > div > div.moderation-details"
+	spoilerSel       = "#content > div > div > section > section > div.review.body-text.-prose.-hero.-loose > div.js-spoiler-container"
+)
 
 func (s *Scraper) scrapeUserReviewPage(ctx context.Context, reviewUrl string) (string, error) {
-	var doc *goquery.Document
-	var review string
-
-	reviewContentSel := "#content > div > div > section > section > div.review.body-text.-prose.-hero.-loose > div > div > div"
-	moviePosterSel := "#content > div > div > section > div.col-4.gutter-right-1 > section.poster-list.-p150.el.col.viewing-poster-container > div > div > a > span.overlay"
-	spoilerBtnSel := "#content > div > div > section > section > div.review.body-text.-prose.-hero.-loose > div.js-spoiler-container > div > div > a"
-	reviewRemovedSel := "#content > div > div > section > section > div.review.body-text.-prose.-hero.-loose > div > div > div.moderation-details"
-
-	if err := s.execute(ctx,
-		utils.NavigateTillTrigger(
-			chromedp.Navigate(prefix+reviewUrl), s.logger,
-			utils.Delay(time.Millisecond*1500, time.Millisecond*300),
-			chromedp.WaitVisible(moviePosterSel),
-			utils.Delay(time.Millisecond*1500, time.Millisecond*300),
-		),
-		chromedp.ActionFunc(func(ctx context.Context) error {
-			var spoilerAlert bool
-			var reviewRemoved bool
-
-			if err := chromedp.Evaluate(
-				fmt.Sprintf(`document.querySelector("%s") != null`, reviewRemovedSel), &reviewRemoved,
-			).Do(ctx); err != nil {
-				return err
-			}
-
-			if reviewRemoved {
-				return errReviewRemoved
-			}
-
-			if err := chromedp.Evaluate(
-				fmt.Sprintf(`document.querySelector("%s") != null`, spoilerBtnSel), &spoilerAlert,
-			).Do(ctx); err != nil {
-				return err
-			}
-
-			if spoilerAlert {
-				if err := chromedp.Click(spoilerBtnSel).Do(ctx); err != nil {
-					return err
-				}
-			}
-
-			return nil
-		}),
-		utils.ScreenShot(
-			os.Getenv("SCREENSHOT_DIR"), s.logger, time.Now(), "user-review-page",
-		),
-		utils.ToGoqueryDoc(reviewContentSel, &doc),
-		chromedp.ActionFunc(func(ctx context.Context) error {
-			review = doc.Text()
-			return nil
-		}),
-	); err != nil {
-		if errors.Is(err, errReviewRemoved) {
-			return "", nil
-		}
+	doc, err := s.fetch(ctx, ReviewPage, reviewUrl)
+	if err != nil {
 		return "", err
 	}
 
-	return review, nil
+	if doc.Find(reviewRemovedSel).Length() > 0 {
+		s.logger.Warn("review has been removed", "url", reviewUrl)
+		return "", nil
+	}
+
+	// The spoiler warning is only removed by clicking on it in a browser
+	doc.Find(spoilerSel).Remove()
+
+	return doc.Find(reviewContentSel).First().Text(), nil
 }
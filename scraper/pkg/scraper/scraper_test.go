@@ -1,43 +1,152 @@
 package scraper
 
 import (
+	"context"
+	"os"
+	"path"
 	"testing"
+	"time"
 
-	"github.com/joho/godotenv"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/config"
 	"github.com/leminhohoho/movie-lens/scraper/pkg/logger"
-	"github.com/leminhohoho/movie-lens/scraper/pkg/utils"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/models"
 )
 
-func TestMovieScraper(t *testing.T) {
-	if err := godotenv.Load("../../.env"); err != nil {
+// newReplayScraper create a scraper that reads every page from an archive filled with the given pages, no browser or network is needed.
+func newReplayScraper(t *testing.T, pages map[string]string) *Scraper {
+	dir := t.TempDir()
+	archiveDir := path.Join(dir, "archive")
+
+	archive, err := NewArchive(archiveDir)
+	if err != nil {
 		t.Fatal(err)
 	}
 
-	errChan := make(chan error)
-	doneChan := make(chan bool)
+	for url, fixture := range pages {
+		html, err := os.ReadFile(fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := archive.Put(url, time.Now(), string(html)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := config.Default()
+	cfg.DBPath = path.Join(dir, "letterboxd.db")
+	cfg.ArchiveMode = archiveReplay
+	cfg.ArchiveDir = archiveDir
 
-	l, err := logger.NewLogger()
+	l, err := logger.NewLogger(cfg)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	scp, err := NewScraper(l, errChan)
+	scp, err := NewScraper(cfg, l)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	cdpCtx, cancel := utils.NewTab(scp.baseCtx, l)
-	defer cancel()
+	t.Cleanup(func() { scp.Close() })
+
+	return scp
+}
+
+func TestMovieScraper(t *testing.T) {
+	filmUrl := "/film/godzilla-kong-the-new-empire/"
+
+	scp := newReplayScraper(t, map[string]string{filmUrl: "extractors/testdata/film.html"})
+
+	if err := scp.scrapeMovie(context.Background(), filmUrl); err != nil {
+		t.Fatal(err)
+	}
+
+	var movie models.Movie
+
+	if err := scp.db.Table("movies").Where("url = ?", filmUrl).First(&movie).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if movie.Name != "Godzilla x Kong: The New Empire" || movie.Duration == nil || *movie.Duration != 115 {
+		t.Fatalf("unexpected movie %#v", movie)
+	}
+
+	counts := map[string]int64{
+		"crews_and_movies":     6,
+		"genres_and_movies":    2,
+		"themes_and_movies":    1,
+		"studios_and_movies":   2,
+		"countries_and_movies": 1,
+		"languages_and_movies": 3,
+		"releases":             2,
+	}
+
+	for table, expected := range counts {
+		var count int64
+
+		if err := scp.db.Table(table).Where("movie_id = ?", movie.Id).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		}
+
+		if count != expected {
+			t.Errorf("expected %d rows in %s, got %d", expected, table, count)
+		}
+	}
+
+	// Scraping the same movie again must not duplicate any row
+	if err := scp.scrapeMovie(context.Background(), filmUrl); err != nil {
+		t.Fatal(err)
+	}
 
-	go func() {
-		scp.scrapeMovie(cdpCtx, "/film/godzilla-kong-the-new-empire/crew/")
-		doneChan <- true
-	}()
+	var count int64
 
-	select {
-	case err := <-errChan:
+	if err := scp.db.Table("crews_and_movies").Where("movie_id = ?", movie.Id).Count(&count).Error; err != nil {
 		t.Fatal(err)
-	case <-doneChan:
-		return
+	}
+
+	if count != counts["crews_and_movies"] {
+		t.Fatalf("expected %d crews after scraping twice, got %d", counts["crews_and_movies"], count)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	archive, err := NewArchive(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url := "/film/godzilla-kong-the-new-empire/"
+	first := time.Date(2024, 3, 29, 10, 0, 0, 0, time.UTC)
+	second := first.Add(time.Hour)
+
+	if err := archive.Put(url, second, "<html>second</html>"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := archive.Put(url, first, "<html>first</html>"); err != nil {
+		t.Fatal(err)
+	}
+
+	html, fetchedAt, err := archive.Latest(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if html != "<html>second</html>" || !fetchedAt.Equal(second) {
+		t.Fatalf("expected the newest snapshot, got %s fetched at %s", html, fetchedAt)
+	}
+
+	html, err = archive.Get(url, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if html != "<html>first</html>" {
+		t.Fatalf("unexpected snapshot %s", html)
+	}
+
+	if _, _, err := archive.Latest("/film/unknown/"); err == nil {
+		t.Fatal("expected an error for a page not in the archive")
 	}
 }
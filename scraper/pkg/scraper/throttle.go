@@ -0,0 +1,112 @@
+package scraper
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// throttle is the politeness budget shared by every worker of the scraper.
+// After interval requests, all workers are paused together. Requests are also spaced out by at least gap.
+type throttle struct {
+	mu       sync.Mutex
+	logger   *slog.Logger
+	interval int
+	pause    time.Duration
+	gap      time.Duration
+	counter  int
+	last     time.Time
+}
+
+func newThrottle(logger *slog.Logger, interval int, pause time.Duration, gap time.Duration) *throttle {
+	return &throttle{
+		logger:   logger,
+		interval: interval,
+		pause:    pause,
+		gap:      gap,
+	}
+}
+
+// wait block until the caller is allowed to send the next request.
+// The lock is held while sleeping so that the other workers are blocked as well.
+func (t *throttle) wait(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.interval > 0 && t.counter == t.interval {
+		t.logger.Info("request budget exhausted, pausing all workers", "pause", t.pause.String())
+
+		if err := sleep(ctx, t.pause); err != nil {
+			return err
+		}
+
+		t.counter = 0
+	}
+
+	if elapsed := time.Since(t.last); elapsed < t.gap {
+		if err := sleep(ctx, t.gap-elapsed); err != nil {
+			return err
+		}
+	}
+
+	t.counter++
+	t.last = time.Now()
+
+	return nil
+}
+
+// sleep pause for the given duration, it returns early if the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// keyedMutex lock by key, it is used to prevent workers from scraping the same page at the same time.
+// A key is deleted once nobody holds or waits for its lock, so a long crawl doesn't keep a mutex per page.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+func (k *keyedMutex) lock(key string) func() {
+	k.mu.Lock()
+
+	if k.locks == nil {
+		k.locks = map[string]*keyedLock{}
+	}
+
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		k.locks[key] = l
+	}
+
+	l.refs++
+	k.mu.Unlock()
+
+	l.mu.Lock()
+
+	return func() {
+		l.mu.Unlock()
+
+		k.mu.Lock()
+		defer k.mu.Unlock()
+
+		if l.refs--; l.refs == 0 {
+			delete(k.locks, key)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package scraper
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestThrottleSharedBudget(t *testing.T) {
+	th := newThrottle(slog.New(slog.NewTextHandler(io.Discard, nil)), 2, time.Millisecond*100, 0)
+
+	start := time.Now()
+
+	var wg sync.WaitGroup
+
+	for range 4 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if err := th.wait(context.Background()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	// 4 requests with a budget of 2 means every worker has to go through exactly one pause
+	if elapsed := time.Since(start); elapsed < time.Millisecond*100 || elapsed > time.Millisecond*190 {
+		t.Fatalf("expected a single pause, took %s", elapsed)
+	}
+}
+
+func TestThrottleCancel(t *testing.T) {
+	th := newThrottle(slog.New(slog.NewTextHandler(io.Discard, nil)), 1, time.Hour, 0)
+
+	if err := th.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+
+	if err := th.wait(ctx); err == nil {
+		t.Fatal("expected the pause to be interrupted by the context")
+	}
+}
+
+func TestKeyedMutex(t *testing.T) {
+	var k keyedMutex
+	var wg sync.WaitGroup
+
+	var counters [2]int
+
+	for i := range 50 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			unlock := k.lock([]string{"/film/dune/", "/film/barbie/"}[i%2])
+			counters[i%2]++
+			unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	if counters != [2]int{25, 25} {
+		t.Fatalf("unexpected counters %v", counters)
+	}
+
+	// The keys are released once unlocked
+	if len(k.locks) != 0 {
+		t.Fatalf("expected no lock left, got %d", len(k.locks))
+	}
+}
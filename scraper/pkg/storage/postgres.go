@@ -0,0 +1,11 @@
+package storage
+
+import (
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// openPostgres connect to a PostgreSQL database, it can be shared by the scrapers of several hosts.
+func openPostgres(dsn string) (*gorm.DB, error) {
+	return gorm.Open(postgres.Open(dsn), &gorm.Config{})
+}
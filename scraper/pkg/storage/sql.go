@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/leminhohoho/movie-lens/scraper/pkg/models"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/utils"
+	"gorm.io/gorm"
+)
+
+// sqlStorage is the [Storage] of the SQL databases supported by GORM, the queries work on both SQLite and PostgreSQL.
+type sqlStorage struct {
+	db     *gorm.DB
+	logger *slog.Logger
+}
+
+func (s *sqlStorage) SaveMovie(details *models.MovieDetails) (int, error) {
+	var movieId int
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		movieIds, err := utils.UpsertByUrl(tx, "movies", []models.Movie{details.Movie},
+			"name", "duration", "poster_url", "backdrop_url", "desc", "trailer_url",
+		)
+		if err != nil {
+			return err
+		}
+
+		movieId = movieIds[details.Movie.Url]
+
+		crewIds, err := utils.UpsertByUrl(tx, "crews", details.Crews, "name", "role")
+		if err != nil {
+			return err
+		}
+
+		crewsAndMovies := make([]models.CrewsAndMovies, 0, len(crewIds))
+		for _, id := range crewIds {
+			crewsAndMovies = append(crewsAndMovies, models.CrewsAndMovies{CrewId: id, MovieId: movieId})
+		}
+
+		if err := utils.InsertBatch(tx, "crews_and_movies", crewsAndMovies); err != nil {
+			return err
+		}
+
+		genreIds, err := utils.UpsertByUrl(tx, "genres", details.Genres, "name")
+		if err != nil {
+			return err
+		}
+
+		genresAndMovies := make([]models.GenresAndMovies, 0, len(genreIds))
+		for _, id := range genreIds {
+			genresAndMovies = append(genresAndMovies, models.GenresAndMovies{GenreId: id, MovieId: movieId})
+		}
+
+		if err := utils.InsertBatch(tx, "genres_and_movies", genresAndMovies); err != nil {
+			return err
+		}
+
+		themeIds, err := utils.UpsertByUrl(tx, "themes", details.Themes, "name")
+		if err != nil {
+			return err
+		}
+
+		themesAndMovies := make([]models.ThemesAndMovies, 0, len(themeIds))
+		for _, id := range themeIds {
+			themesAndMovies = append(themesAndMovies, models.ThemesAndMovies{ThemeId: id, MovieId: movieId})
+		}
+
+		if err := utils.InsertBatch(tx, "themes_and_movies", themesAndMovies); err != nil {
+			return err
+		}
+
+		studioIds, err := utils.UpsertByUrl(tx, "studios", details.Studios, "name")
+		if err != nil {
+			return err
+		}
+
+		studiosAndMovies := make([]models.StudiosAndMovies, 0, len(studioIds))
+		for _, id := range studioIds {
+			studiosAndMovies = append(studiosAndMovies, models.StudiosAndMovies{StudioId: id, MovieId: movieId})
+		}
+
+		if err := utils.InsertBatch(tx, "studios_and_movies", studiosAndMovies); err != nil {
+			return err
+		}
+
+		// The rows those belong to the movie only know its id once it is written
+		for i := range details.Countries {
+			details.Countries[i].MovieId = movieId
+		}
+
+		for i := range details.Languages {
+			details.Languages[i].MovieId = movieId
+		}
+
+		for i := range details.Releases {
+			details.Releases[i].MovieId = movieId
+		}
+
+		if err := utils.InsertBatch(tx, "countries_and_movies", details.Countries); err != nil {
+			return err
+		}
+
+		if err := utils.InsertBatch(tx, "languages_and_movies", details.Languages); err != nil {
+			return err
+		}
+
+		return utils.InsertBatch(tx, "releases", details.Releases)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	s.logger.Info("movie saved",
+		"url", details.Movie.Url,
+		"id", movieId,
+		"crews", len(details.Crews),
+		"genres", len(details.Genres),
+		"themes", len(details.Themes),
+		"studios", len(details.Studios),
+		"releases", len(details.Releases),
+	)
+
+	return movieId, nil
+}
+
+func (s *sqlStorage) SaveUsers(users []models.User) (map[string]int, error) {
+	return utils.UpsertByUrl(s.db, "users", users, "name")
+}
+
+func (s *sqlStorage) SaveActivities(activities []models.UserAndMovie) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return utils.InsertBatch(tx, "users_and_movies", activities)
+	})
+}
+
+func (s *sqlStorage) UserByUrl(url string) (models.User, error) {
+	var user models.User
+
+	err := s.db.Table("users").Where("url = ?", url).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, ErrNotFound
+	}
+
+	return user, err
+}
+
+func (s *sqlStorage) MovieByUrl(url string) (models.Movie, error) {
+	var movie models.Movie
+
+	err := s.db.Table("movies").Where("url = ?", url).First(&movie).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return movie, ErrNotFound
+	}
+
+	return movie, err
+}
+
+func (s *sqlStorage) HasActivities(userId int, movieId int) (bool, error) {
+	var count int64
+
+	err := s.db.Table("users_and_movies").Where("user_id = ? AND movie_id = ?", userId, movieId).Count(&count).Error
+
+	return count > 0, err
+}
+
+func (s *sqlStorage) DB() *gorm.DB {
+	return s.db
+}
+
+func (s *sqlStorage) Close() error {
+	return closeDB(s.db)
+}
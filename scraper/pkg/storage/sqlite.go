@@ -0,0 +1,24 @@
+package storage
+
+import (
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func openSqlite(path string) (*gorm.DB, error) {
+	// SQLite only checks the foreign keys if it is asked to, on every connection
+	db, err := gorm.Open(sqlite.Open(path+"?_foreign_keys=on"), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite only allows one writer at a time, workers share a single connection instead of failing with SQLITE_BUSY
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB.SetMaxOpenConns(1)
+
+	return db, nil
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+
+	"github.com/leminhohoho/movie-lens/scraper/pkg/migrations"
+	"github.com/leminhohoho/movie-lens/scraper/pkg/models"
+	"gorm.io/gorm"
+)
+
+// ErrNotFound is returned when the requested row is not in the storage.
+var ErrNotFound = errors.New("not found")
+
+// Storage is the repository of the scraped models, it is backed by SQLite or PostgreSQL.
+// The writes of a single call are atomic, nothing is written if any of them fails.
+type Storage interface {
+	// SaveMovie write a movie and everything scraped from its page.
+	// A movie saved again keeps its id, only its details are refreshed and the missing relations are added.
+	// It returns the id of the movie.
+	SaveMovie(details *models.MovieDetails) (int, error)
+	// SaveUsers write the users those are not saved yet, the name of the others is refreshed.
+	// It returns the ids of every user by url.
+	SaveUsers(users []models.User) (map[string]int, error)
+	// SaveActivities write the activities, the activities already saved are left as is.
+	SaveActivities(activities []models.UserAndMovie) error
+	// UserByUrl return the user with the given url, or [ErrNotFound].
+	UserByUrl(url string) (models.User, error)
+	// MovieByUrl return the movie with the given url, or [ErrNotFound].
+	MovieByUrl(url string) (models.Movie, error)
+	// HasActivities report whether any activity of the user on the movie is saved.
+	HasActivities(userId int, movieId int) (bool, error)
+	// DB return the connection to the database, for the queries those are not about a single model (e.g. the crawl frontier).
+	DB() *gorm.DB
+	// Close close the connection to the database.
+	Close() error
+}
+
+// Open connect to the database of the given DSN and apply the pending migrations.
+// postgres:// and postgresql:// urls select PostgreSQL, anything else is the path to a SQLite database.
+func Open(dsn string, logger *slog.Logger) (Storage, error) {
+	store, err := Connect(dsn, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	// The db is created by the first migration if it doesn't exist yet
+	if _, err := migrations.Up(store.DB(), logger); err != nil {
+		return nil, errors.Join(err, store.Close())
+	}
+
+	return store, nil
+}
+
+// Connect connect to the database of the given DSN like [Open] but without applying the migrations, for the migrate
+// command those report and apply them.
+func Connect(dsn string, logger *slog.Logger) (Storage, error) {
+	var db *gorm.DB
+	var err error
+
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		db, err = openPostgres(dsn)
+	} else {
+		db, err = openSqlite(dsn)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlStorage{db: db, logger: logger}, nil
+}
+
+func closeDB(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	return sqlDB.Close()
+}
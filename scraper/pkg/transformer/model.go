@@ -0,0 +1,431 @@
+package transformer
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/leminhohoho/movie-lens/scraper/pkg/features"
+)
+
+// layerNormEps is the epsilon of torch.nn.LayerNorm.
+const layerNormEps = 1e-5
+
+// linear is a torch.nn.Linear, weight is out*in values and bias is nil if the layer has none.
+type linear struct {
+	in, out int
+	weight  []float32
+	bias    []float32
+}
+
+type layerNorm struct {
+	weight []float32
+	bias   []float32
+}
+
+type block struct {
+	// heads are the qkv projections of the attention heads, each one is 3*headSize*embd values
+	heads   []linear
+	proj    linear
+	ln1     layerNorm
+	ln2     layerNorm
+	ffwdIn  linear
+	ffwdOut linear
+}
+
+// FilmRecommender is the causal transformer of ml/notebooks/model_dev.ipynb, for inference on CPU.
+// Its input is a sequence of activities (the features of the activity followed by the features of its movie) and its
+// output at every position is a vector in the space of the encoded movies, the next movie is the closest one.
+type FilmRecommender struct {
+	Embd   int
+	Heads  int
+	Layers int
+	// ActivityFeatures is the number of features of an activity in the inputs, lm_head maps the Embd values of an input
+	// to the Embd-ActivityFeatures values of a movie (6 for the notebook)
+	ActivityFeatures int
+	// ActivityColumns are the columns of the activities the model was trained on, they are read from the activity_columns
+	// metadata of the export and are nil if the export doesn't have them
+	ActivityColumns []string
+	headSize        int
+	blocks          []block
+	lnF             layerNorm
+	lmHead          linear
+}
+
+// Load read the weights of a FilmRecommender saved with safetensors from its state_dict, the sizes of the model are
+// read from the shapes of the weights and the layout of its activities from the metadata of the file.
+func Load(filePath string) (*FilmRecommender, error) {
+	tensors, metadata, err := readSafetensors(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := FromTensors(tensors)
+	if err != nil {
+		return nil, err
+	}
+
+	if columns, ok := metadata["activity_columns"]; ok {
+		m.ActivityColumns = strings.Split(columns, ",")
+
+		if len(m.ActivityColumns) != m.ActivityFeatures {
+			return nil, fmt.Errorf("%s has %d activity columns but its lm_head leaves %d activity features",
+				filePath, len(m.ActivityColumns), m.ActivityFeatures)
+		}
+	}
+
+	return m, nil
+}
+
+// FromTensors build a FilmRecommender from the tensors of its state_dict.
+func FromTensors(tensors map[string]Tensor) (*FilmRecommender, error) {
+	w := weights(tensors)
+
+	lnF, err := w.layerNorm("ln_f")
+	if err != nil {
+		return nil, err
+	}
+
+	lmHead, err := w.linear("lm_head", true)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &FilmRecommender{Embd: len(lnF.weight), ActivityFeatures: len(lnF.weight) - lmHead.out, lnF: lnF, lmHead: lmHead}
+
+	if lmHead.in != m.Embd || m.ActivityFeatures < 0 {
+		return nil, fmt.Errorf("lm_head maps %d inputs to %d outputs, expected %d inputs to at most as many outputs",
+			lmHead.in, lmHead.out, m.Embd)
+	}
+
+	for w.has(fmt.Sprintf("blocks.%d.ln1.weight", m.Layers)) {
+		m.Layers++
+	}
+
+	for w.has(fmt.Sprintf("blocks.0.sa.heads.%d.qkv.weight", m.Heads)) {
+		m.Heads++
+	}
+
+	if m.Layers == 0 || m.Heads == 0 {
+		return nil, fmt.Errorf("no attention block found in the weights")
+	}
+
+	m.headSize = m.Embd / m.Heads
+
+	for l := range m.Layers {
+		prefix := fmt.Sprintf("blocks.%d.", l)
+		var b block
+
+		for h := range m.Heads {
+			head, err := w.linear(fmt.Sprintf("%ssa.heads.%d.qkv", prefix, h), false)
+			if err != nil {
+				return nil, err
+			}
+
+			if head.in != m.Embd || head.out != 3*m.headSize {
+				return nil, fmt.Errorf("unexpected shape %dx%d of the head %d of the block %d", head.out, head.in, h, l)
+			}
+
+			b.heads = append(b.heads, head)
+		}
+
+		for _, layer := range []struct {
+			name string
+			dst  *linear
+		}{{"sa.proj", &b.proj}, {"ffwd.net.0", &b.ffwdIn}, {"ffwd.net.2", &b.ffwdOut}} {
+			if *layer.dst, err = w.linear(prefix+layer.name, true); err != nil {
+				return nil, err
+			}
+		}
+
+		if b.proj.in != m.Heads*m.headSize || b.proj.out != m.Embd || b.ffwdIn.in != m.Embd ||
+			b.ffwdOut.in != b.ffwdIn.out || b.ffwdOut.out != m.Embd {
+			return nil, fmt.Errorf("unexpected shapes of the projection or the feed forward of the block %d", l)
+		}
+
+		if b.ln1, err = w.layerNorm(prefix + "ln1"); err != nil {
+			return nil, err
+		}
+
+		if b.ln2, err = w.layerNorm(prefix + "ln2"); err != nil {
+			return nil, err
+		}
+
+		m.blocks = append(m.blocks, b)
+	}
+
+	return m, nil
+}
+
+type weights map[string]Tensor
+
+func (w weights) has(name string) bool {
+	_, ok := w[name]
+	return ok
+}
+
+func (w weights) linear(name string, withBias bool) (linear, error) {
+	weight, ok := w[name+".weight"]
+	if !ok || len(weight.Shape) != 2 {
+		return linear{}, fmt.Errorf("missing or invalid weight %s.weight", name)
+	}
+
+	l := linear{out: weight.Shape[0], in: weight.Shape[1], weight: weight.Data}
+
+	if withBias {
+		bias, ok := w[name+".bias"]
+		if !ok || len(bias.Data) != l.out {
+			return linear{}, fmt.Errorf("missing or invalid bias %s.bias", name)
+		}
+
+		l.bias = bias.Data
+	}
+
+	return l, nil
+}
+
+func (w weights) layerNorm(name string) (layerNorm, error) {
+	weight, okWeight := w[name+".weight"]
+	bias, okBias := w[name+".bias"]
+
+	if !okWeight || !okBias || len(weight.Data) != len(bias.Data) {
+		return layerNorm{}, fmt.Errorf("missing or invalid layer norm %s", name)
+	}
+
+	return layerNorm{weight: weight.Data, bias: bias.Data}, nil
+}
+
+// Forward run the model on a sequence of inputs of Embd values each, the oldest first.
+// It returns the output of every position, the output of a position only depends on the inputs up to it.
+func (m *FilmRecommender) Forward(inputs [][]float32) ([][]float32, error) {
+	x := make([][]float32, len(inputs))
+
+	for t, input := range inputs {
+		if len(input) != m.Embd {
+			return nil, fmt.Errorf("input %d has %d values, expected %d", t, len(input), m.Embd)
+		}
+
+		x[t] = slices.Clone(input)
+	}
+
+	for _, b := range m.blocks {
+		h := b.ln1.apply(x)
+		attention := make([][]float32, len(x))
+		for t := range attention {
+			attention[t] = make([]float32, 0, m.Heads*m.headSize)
+		}
+
+		for _, head := range b.heads {
+			for t, out := range m.attend(head.apply(h)) {
+				attention[t] = append(attention[t], out...)
+			}
+		}
+
+		add(x, b.proj.apply(attention))
+
+		ffwd := b.ffwdIn.apply(b.ln2.apply(x))
+		for _, row := range ffwd {
+			for i, v := range row {
+				row[i] = gelu(v)
+			}
+		}
+
+		add(x, b.ffwdOut.apply(ffwd))
+	}
+
+	return m.lmHead.apply(m.lnF.apply(x)), nil
+}
+
+// attend compute the causal scaled dot product attention of a head given the q, k and v of every position.
+func (m *FilmRecommender) attend(qkv [][]float32) [][]float32 {
+	hs := m.headSize
+	scale := 1 / math.Sqrt(float64(hs))
+	out := make([][]float32, len(qkv))
+
+	for t := range qkv {
+		q := qkv[t][:hs]
+
+		// The position only attends to itself and the positions before it
+		scores := make([]float64, t+1)
+		maxScore := math.Inf(-1)
+
+		for s := range t + 1 {
+			k := qkv[s][hs : 2*hs]
+
+			var dot float64
+			for i := range hs {
+				dot += float64(q[i]) * float64(k[i])
+			}
+
+			scores[s] = dot * scale
+			maxScore = max(maxScore, scores[s])
+		}
+
+		var sum float64
+		for s := range scores {
+			scores[s] = math.Exp(scores[s] - maxScore)
+			sum += scores[s]
+		}
+
+		values := make([]float64, hs)
+		for s := range scores {
+			v := qkv[s][2*hs:]
+			for i := range hs {
+				values[i] += scores[s] / sum * float64(v[i])
+			}
+		}
+
+		out[t] = make([]float32, hs)
+		for i, value := range values {
+			out[t][i] = float32(value)
+		}
+	}
+
+	return out
+}
+
+func (l linear) apply(x [][]float32) [][]float32 {
+	out := make([][]float32, len(x))
+
+	for t, row := range x {
+		out[t] = make([]float32, l.out)
+
+		for o := range l.out {
+			w := l.weight[o*l.in : (o+1)*l.in]
+
+			var sum float64
+			for i, v := range row {
+				sum += float64(v) * float64(w[i])
+			}
+
+			if l.bias != nil {
+				sum += float64(l.bias[o])
+			}
+
+			out[t][o] = float32(sum)
+		}
+	}
+
+	return out
+}
+
+func (ln layerNorm) apply(x [][]float32) [][]float32 {
+	out := make([][]float32, len(x))
+
+	for t, row := range x {
+		var mean, variance float64
+		for _, v := range row {
+			mean += float64(v)
+		}
+
+		mean /= float64(len(row))
+
+		for _, v := range row {
+			variance += (float64(v) - mean) * (float64(v) - mean)
+		}
+
+		variance /= float64(len(row))
+		std := math.Sqrt(variance + layerNormEps)
+
+		out[t] = make([]float32, len(row))
+		for i, v := range row {
+			out[t][i] = float32((float64(v)-mean)/std)*ln.weight[i] + ln.bias[i]
+		}
+	}
+
+	return out
+}
+
+// gelu is the exact GELU of torch.nn.GELU.
+func gelu(x float32) float32 {
+	return float32(0.5 * float64(x) * (1 + math.Erf(float64(x)/math.Sqrt2)))
+}
+
+// add add y to x in place.
+func add(x [][]float32, y [][]float32) {
+	for t := range x {
+		for i := range x[t] {
+			x[t][i] += y[t][i]
+		}
+	}
+}
+
+// Prediction is a movie predicted to be watched next, by its row in the movie matrix, with its logit.
+type Prediction struct {
+	Movie int
+	Logit float32
+}
+
+// Predict return the k movies the most likely to be watched after the inputs, the most likely first.
+// movies is the matrix of the encoded movies (embd_matrix of the notebook), one row per movie of as many values as the
+// outputs of lm_head, the logit of a movie is the dot product of its row with the output of the last position.
+func (m *FilmRecommender) Predict(inputs [][]float32, movies [][]float32, k int) ([]Prediction, error) {
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("at least one input is required")
+	}
+
+	if k < 1 {
+		return nil, fmt.Errorf("k must be at least 1, got %d", k)
+	}
+
+	outputs, err := m.Forward(inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	last := outputs[len(outputs)-1]
+	predictions := make([]Prediction, len(movies))
+
+	for i, movie := range movies {
+		if len(movie) != len(last) {
+			return nil, fmt.Errorf("movie %d has %d values, expected %d", i, len(movie), len(last))
+		}
+
+		var logit float64
+		for j, v := range movie {
+			logit += float64(v) * float64(last[j])
+		}
+
+		predictions[i] = Prediction{Movie: i, Logit: float32(logit)}
+	}
+
+	slices.SortStableFunc(predictions, func(a, b Prediction) int { return cmp.Compare(b.Logit, a.Logit) })
+
+	return predictions[:min(k, len(predictions))], nil
+}
+
+// Inputs return the inputs of the model for a sequence of activities, the oldest first: the vector of every activity
+// followed by the vector of its movie. The movies are looked up by id.
+// The activities must have the layout of [features.ActivityColumns], which the model must have been trained on: a
+// model exported from the notebook (6 activity features) can't be fed the activities encoded by [features.Encode].
+func (m *FilmRecommender) Inputs(activities []features.EncodedActivity, movies []features.EncodedMovie) ([][]float32, error) {
+	if m.ActivityColumns != nil && !slices.Equal(m.ActivityColumns, features.ActivityColumns) {
+		return nil, fmt.Errorf("the model was trained on the activity columns %v, the encoded activities have %v",
+			m.ActivityColumns, features.ActivityColumns)
+	}
+
+	if len(features.ActivityColumns) != m.ActivityFeatures {
+		return nil, fmt.Errorf("the model was trained on activities of %d features, the encoded activities have %d",
+			m.ActivityFeatures, len(features.ActivityColumns))
+	}
+
+	vectors := make(map[int][]float32, len(movies))
+	for _, movie := range movies {
+		vectors[movie.Id] = movie.Vector()
+	}
+
+	inputs := make([][]float32, len(activities))
+
+	for i, activity := range activities {
+		movie, ok := vectors[activity.MovieId]
+		if !ok {
+			return nil, fmt.Errorf("movie %d of the activity %d is not encoded", activity.MovieId, i)
+		}
+
+		inputs[i] = append(activity.Vector(), movie...)
+	}
+
+	return inputs, nil
+}
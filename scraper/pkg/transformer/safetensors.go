@@ -0,0 +1,157 @@
+package transformer
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// Tensor is a tensor read from a safetensors file, its values are in row-major order.
+type Tensor struct {
+	Shape []int
+	Data  []float32
+}
+
+// ReadSafetensors read every tensor of a safetensors file by name, the F32, F16 and BF16 tensors are converted to float32.
+func ReadSafetensors(filePath string) (map[string]Tensor, error) {
+	tensors, _, err := readSafetensors(filePath)
+	return tensors, err
+}
+
+// readSafetensors read the tensors of a safetensors file along with the metadata of its header.
+func readSafetensors(filePath string) (map[string]Tensor, map[string]string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	var headerSize uint64
+
+	if err := binary.Read(f, binary.LittleEndian, &headerSize); err != nil {
+		return nil, nil, fmt.Errorf("unable to read the header size of %s: %w", filePath, err)
+	}
+
+	// The header of a safetensors file is at most 100MB
+	if headerSize > 100<<20 {
+		return nil, nil, fmt.Errorf("header of %s too large (%d bytes)", filePath, headerSize)
+	}
+
+	header := make([]byte, headerSize)
+
+	if _, err := io.ReadFull(f, header); err != nil {
+		return nil, nil, fmt.Errorf("unable to read the header of %s: %w", filePath, err)
+	}
+
+	var entries map[string]json.RawMessage
+
+	if err := json.Unmarshal(header, &entries); err != nil {
+		return nil, nil, fmt.Errorf("invalid header of %s: %w", filePath, err)
+	}
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tensors := map[string]Tensor{}
+	metadata := map[string]string{}
+
+	for name, raw := range entries {
+		if name == "__metadata__" {
+			if err := json.Unmarshal(raw, &metadata); err != nil {
+				return nil, nil, fmt.Errorf("invalid metadata of %s: %w", filePath, err)
+			}
+
+			continue
+		}
+
+		var entry struct {
+			Dtype       string `json:"dtype"`
+			Shape       []int  `json:"shape"`
+			DataOffsets [2]int `json:"data_offsets"`
+		}
+
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return nil, nil, fmt.Errorf("invalid tensor %s of %s: %w", name, filePath, err)
+		}
+
+		start, end := entry.DataOffsets[0], entry.DataOffsets[1]
+		if start < 0 || end < start || end > len(data) {
+			return nil, nil, fmt.Errorf("tensor %s of %s out of the file", name, filePath)
+		}
+
+		values, err := decode(entry.Dtype, data[start:end])
+		if err != nil {
+			return nil, nil, fmt.Errorf("tensor %s of %s: %w", name, filePath, err)
+		}
+
+		size := 1
+		for _, dim := range entry.Shape {
+			size *= dim
+		}
+
+		if size != len(values) {
+			return nil, nil, fmt.Errorf("tensor %s of %s has %d values for the shape %v", name, filePath, len(values), entry.Shape)
+		}
+
+		tensors[name] = Tensor{Shape: entry.Shape, Data: values}
+	}
+
+	return tensors, metadata, nil
+}
+
+func decode(dtype string, raw []byte) ([]float32, error) {
+	switch dtype {
+	case "F32":
+		values := make([]float32, len(raw)/4)
+		for i := range values {
+			values[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw[i*4:]))
+		}
+
+		return values, nil
+	case "BF16":
+		values := make([]float32, len(raw)/2)
+		for i := range values {
+			values[i] = math.Float32frombits(uint32(binary.LittleEndian.Uint16(raw[i*2:])) << 16)
+		}
+
+		return values, nil
+	case "F16":
+		values := make([]float32, len(raw)/2)
+		for i := range values {
+			values[i] = float16(binary.LittleEndian.Uint16(raw[i*2:]))
+		}
+
+		return values, nil
+	default:
+		return nil, fmt.Errorf("unsupported dtype %s, expected F32, F16 or BF16", dtype)
+	}
+}
+
+// float16 convert an IEEE 754 half precision float to float32.
+func float16(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exponent := uint32(h>>10) & 0x1f
+	mantissa := uint32(h) & 0x3ff
+
+	switch {
+	case exponent == 0 && mantissa == 0:
+		return math.Float32frombits(sign)
+	case exponent == 0:
+		// Subnormal, the value is mantissa * 2^-24
+		value := float32(mantissa) / (1 << 24)
+		if sign != 0 {
+			value = -value
+		}
+
+		return value
+	case exponent == 0x1f:
+		return math.Float32frombits(sign | 0xff<<23 | mantissa<<13)
+	default:
+		return math.Float32frombits(sign | (exponent+127-15)<<23 | mantissa<<13)
+	}
+}
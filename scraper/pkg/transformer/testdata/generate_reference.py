@@ -0,0 +1,128 @@
+"""Generate a small FilmRecommender with random weights and its reference outputs for the Go smoke test.
+
+Only the standard library is used, the forward pass re-implements the PyTorch semantics of ml/notebooks/model_dev.ipynb
+(LayerNorm with eps=1e-5, exact GELU, causal scaled dot product attention). It is not a proof of parity with PyTorch,
+which is checked against the reference of ml/generate_parity_reference.py.
+
+    python3 generate_reference.py
+"""
+
+import json
+import math
+import random
+import struct
+
+N_EMBD = 14
+N_HEAD = 2
+N_LAYER = 2
+# The activities have 6 features, lm_head projects back to the space of the movies
+N_OUT = N_EMBD - 6
+N_MOVIES = 6
+SEQ_LEN = 5
+
+rng = random.Random(42)
+
+
+def f32(x):
+    return struct.unpack("<f", struct.pack("<f", x))[0]
+
+
+def tensor(*shape, scale=0.3):
+    size = math.prod(shape)
+    return {"shape": list(shape), "data": [f32(rng.gauss(0, scale)) for _ in range(size)]}
+
+
+def matrix(t):
+    rows, cols = t["shape"]
+    return [t["data"][r * cols:(r + 1) * cols] for r in range(rows)]
+
+
+head_size = N_EMBD // N_HEAD
+state = {}
+
+for l in range(N_LAYER):
+    for h in range(N_HEAD):
+        state[f"blocks.{l}.sa.heads.{h}.qkv.weight"] = tensor(3 * head_size, N_EMBD)
+    state[f"blocks.{l}.sa.proj.weight"] = tensor(N_EMBD, head_size * N_HEAD)
+    state[f"blocks.{l}.sa.proj.bias"] = tensor(N_EMBD)
+    state[f"blocks.{l}.ffwd.net.0.weight"] = tensor(4 * N_EMBD, N_EMBD)
+    state[f"blocks.{l}.ffwd.net.0.bias"] = tensor(4 * N_EMBD)
+    state[f"blocks.{l}.ffwd.net.2.weight"] = tensor(N_EMBD, 4 * N_EMBD)
+    state[f"blocks.{l}.ffwd.net.2.bias"] = tensor(N_EMBD)
+    for ln in ("ln1", "ln2"):
+        state[f"blocks.{l}.{ln}.weight"] = {"shape": [N_EMBD], "data": [f32(1 + rng.gauss(0, 0.1)) for _ in range(N_EMBD)]}
+        state[f"blocks.{l}.{ln}.bias"] = tensor(N_EMBD, scale=0.1)
+
+state["ln_f.weight"] = {"shape": [N_EMBD], "data": [f32(1 + rng.gauss(0, 0.1)) for _ in range(N_EMBD)]}
+state["ln_f.bias"] = tensor(N_EMBD, scale=0.1)
+state["lm_head.weight"] = tensor(N_OUT, N_EMBD)
+state["lm_head.bias"] = tensor(N_OUT)
+
+
+def linear(x, name, bias=True):
+    w = matrix(state[name + ".weight"])
+    b = state[name + ".bias"]["data"] if bias else [0.0] * len(w)
+    return [[sum(v * wi for v, wi in zip(row, wo)) + bo for wo, bo in zip(w, b)] for row in x]
+
+
+def layer_norm(x, name):
+    w, b = state[name + ".weight"]["data"], state[name + ".bias"]["data"]
+    out = []
+    for row in x:
+        mean = sum(row) / len(row)
+        var = sum((v - mean) ** 2 for v in row) / len(row)
+        out.append([(v - mean) / math.sqrt(var + 1e-5) * wi + bi for v, wi, bi in zip(row, w, b)])
+    return out
+
+
+def gelu(x):
+    return 0.5 * x * (1 + math.erf(x / math.sqrt(2)))
+
+
+def attention(qkv):
+    out = []
+    for t in range(len(qkv)):
+        q = qkv[t][:head_size]
+        scores = [sum(a * b for a, b in zip(q, qkv[s][head_size:2 * head_size])) / math.sqrt(head_size) for s in range(t + 1)]
+        top = max(scores)
+        weights = [math.exp(s - top) for s in scores]
+        total = sum(weights)
+        out.append([sum(weights[s] / total * qkv[s][2 * head_size + i] for s in range(t + 1)) for i in range(head_size)])
+    return out
+
+
+def forward(x):
+    for l in range(N_LAYER):
+        h = layer_norm(x, f"blocks.{l}.ln1")
+        heads = [attention(linear(h, f"blocks.{l}.sa.heads.{i}.qkv", bias=False)) for i in range(N_HEAD)]
+        cat = [sum((heads[i][t] for i in range(N_HEAD)), []) for t in range(len(x))]
+        x = [[a + b for a, b in zip(r, p)] for r, p in zip(x, linear(cat, f"blocks.{l}.sa.proj"))]
+        ff = [[gelu(v) for v in row] for row in linear(layer_norm(x, f"blocks.{l}.ln2"), f"blocks.{l}.ffwd.net.0")]
+        x = [[a + b for a, b in zip(r, p)] for r, p in zip(x, linear(ff, f"blocks.{l}.ffwd.net.2"))]
+    return linear(layer_norm(x, "ln_f"), "lm_head")
+
+
+def write_safetensors(path):
+    header, offset, data = {}, 0, b""
+    for name in sorted(state):
+        t = state[name]
+        raw = struct.pack(f"<{len(t['data'])}f", *t["data"])
+        header[name] = {"dtype": "F32", "shape": t["shape"], "data_offsets": [offset, offset + len(raw)]}
+        offset += len(raw)
+        data += raw
+    header["__metadata__"] = {"format": "pt"}
+    encoded = json.dumps(header, separators=(",", ":")).encode()
+    encoded += b" " * (-len(encoded) % 8)
+    with open(path, "wb") as f:
+        f.write(struct.pack("<Q", len(encoded)) + encoded + data)
+
+
+inputs = [[f32(rng.uniform(-1, 1)) for _ in range(N_EMBD)] for _ in range(SEQ_LEN)]
+embd_matrix = [[f32(rng.choice([0.0, 1.0, rng.random()])) for _ in range(N_OUT)] for _ in range(N_MOVIES)]
+outputs = forward(inputs)
+logits = [sum(a * b for a, b in zip(outputs[-1], movie)) for movie in embd_matrix]
+
+write_safetensors("model.safetensors")
+
+with open("reference.json", "w") as f:
+    json.dump({"inputs": inputs, "embd_matrix": embd_matrix, "outputs": outputs, "logits": logits}, f)
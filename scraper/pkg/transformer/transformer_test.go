@@ -0,0 +1,287 @@
+package transformer
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path"
+	"slices"
+	"testing"
+
+	"github.com/leminhohoho/movie-lens/scraper/pkg/features"
+)
+
+// reference is written by ml/export_film_recommender.py, or by testdata/generate_reference.py for the smoke test.
+type reference struct {
+	Inputs     [][]float32 `json:"inputs"`
+	EmbdMatrix [][]float32 `json:"embd_matrix"`
+	Outputs    [][]float32 `json:"outputs"`
+	Logits     []float32   `json:"logits"`
+}
+
+// TestParity check the parity with the reference of PyTorch, written in testdata/torch by
+// ml/generate_parity_reference.py from the FilmRecommender of the notebook. It is generated by the CI, the test fails
+// there if it is missing.
+func TestParity(t *testing.T) {
+	if _, err := os.Stat("testdata/torch/reference.json"); os.IsNotExist(err) {
+		if os.Getenv("CI") != "" {
+			t.Fatal("testdata/torch is not generated, the CI must run ml/generate_parity_reference.py first")
+		}
+
+		t.Skip("testdata/torch not generated, run ml/generate_parity_reference.py with PyTorch installed")
+	}
+
+	testParity(t, "testdata/torch", 1e-4)
+}
+
+// TestForwardSmoke is only a smoke test of the forward pass: its reference is written by testdata/generate_reference.py,
+// a re-implementation of the model with the standard library, so it doesn't prove the parity with PyTorch.
+func TestForwardSmoke(t *testing.T) {
+	testParity(t, "testdata", 1e-4)
+}
+
+// TestExportParity check the parity with a model trained and exported by ml/export_film_recommender.py, the directory
+// of the export is given by FILM_RECOMMENDER_REFERENCE_DIR.
+func TestExportParity(t *testing.T) {
+	dir := os.Getenv("FILM_RECOMMENDER_REFERENCE_DIR")
+	if dir == "" {
+		t.Skip("FILM_RECOMMENDER_REFERENCE_DIR not set")
+	}
+
+	testParity(t, dir, 1e-3)
+}
+
+func testParity(t *testing.T, dir string, tolerance float64) {
+	model, err := Load(path.Join(dir, "model.safetensors"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path.Join(dir, "reference.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ref reference
+
+	if err := json.Unmarshal(content, &ref); err != nil {
+		t.Fatal(err)
+	}
+
+	outputs, err := model.Forward(ref.Inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range ref.Outputs {
+		for j, expected := range ref.Outputs[i] {
+			if math.Abs(float64(outputs[i][j]-expected)) > tolerance {
+				t.Fatalf("output %d,%d is %f, expected %f", i, j, outputs[i][j], expected)
+			}
+		}
+	}
+
+	predictions, err := model.Predict(ref.Inputs, ref.EmbdMatrix, len(ref.EmbdMatrix))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	best := 0
+	for i, logit := range ref.Logits {
+		if logit > ref.Logits[best] {
+			best = i
+		}
+	}
+
+	if predictions[0].Movie != best {
+		t.Fatalf("predicted the movie %d first, expected %d", predictions[0].Movie, best)
+	}
+
+	for _, prediction := range predictions {
+		if math.Abs(float64(prediction.Logit-ref.Logits[prediction.Movie])) > tolerance {
+			t.Fatalf("logit of the movie %d is %f, expected %f", prediction.Movie, prediction.Logit, ref.Logits[prediction.Movie])
+		}
+	}
+
+	// The output of a position doesn't depend on the inputs after it
+	prefix, err := model.Forward(ref.Inputs[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for j := range prefix[1] {
+		if math.Abs(float64(prefix[1][j]-outputs[1][j])) > 1e-5 {
+			t.Fatalf("output of the position 1 changed with the inputs after it")
+		}
+	}
+}
+
+func TestForwardErrors(t *testing.T) {
+	model, err := Load("testdata/model.safetensors")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if model.Layers != 2 || model.Heads != 2 || model.Embd != 14 {
+		t.Fatalf("unexpected sizes %d layers, %d heads, %d embd", model.Layers, model.Heads, model.Embd)
+	}
+
+	if _, err := model.Forward([][]float32{make([]float32, 10)}); err == nil {
+		t.Fatal("expected an error for an input of the wrong size")
+	}
+
+	if _, err := model.Predict([][]float32{make([]float32, 14)}, [][]float32{make([]float32, 3)}, 1); err == nil {
+		t.Fatal("expected an error for a movie of the wrong size")
+	}
+
+	if _, err := FromTensors(map[string]Tensor{}); err == nil {
+		t.Fatal("expected an error for missing weights")
+	}
+}
+
+func TestHalfPrecision(t *testing.T) {
+	// 1.5, -2 and the smallest subnormal
+	f16 := []uint16{0x3e00, 0xc000, 0x0001}
+	raw := make([]byte, 2*len(f16))
+	for i, v := range f16 {
+		binary.LittleEndian.PutUint16(raw[i*2:], v)
+	}
+
+	values, err := decode("F16", raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if values[0] != 1.5 || values[1] != -2 || values[2] != float32(math.Ldexp(1, -24)) {
+		t.Fatalf("unexpected F16 values %v", values)
+	}
+
+	// bfloat16 is the upper half of a float32
+	binary.LittleEndian.PutUint16(raw, uint16(math.Float32bits(-3.5)>>16))
+
+	values, err = decode("BF16", raw[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if values[0] != -3.5 {
+		t.Fatalf("unexpected BF16 value %v", values[0])
+	}
+
+	if _, err := decode("I64", raw); err == nil {
+		t.Fatal("expected an error for an unsupported dtype")
+	}
+}
+
+// newTestModel return a model with random weights those maps embd inputs to out outputs, like the ones of the notebook.
+func newTestModel(t *testing.T, embd int, out int) *FilmRecommender {
+	rng := rand.New(rand.NewPCG(42, 0))
+
+	tensor := func(shape ...int) Tensor {
+		size := 1
+		for _, dim := range shape {
+			size *= dim
+		}
+
+		data := make([]float32, size)
+		for i := range data {
+			data[i] = float32(rng.NormFloat64() * 0.3)
+		}
+
+		return Tensor{Shape: shape, Data: data}
+	}
+
+	heads, headSize := 2, embd/2
+	tensors := map[string]Tensor{
+		"ln_f.weight":    tensor(embd),
+		"ln_f.bias":      tensor(embd),
+		"lm_head.weight": tensor(out, embd),
+		"lm_head.bias":   tensor(out),
+	}
+
+	for h := range heads {
+		tensors[fmt.Sprintf("blocks.0.sa.heads.%d.qkv.weight", h)] = tensor(3*headSize, embd)
+	}
+
+	for name, shape := range map[string][]int{
+		"sa.proj.weight": {embd, heads * headSize}, "sa.proj.bias": {embd},
+		"ffwd.net.0.weight": {4 * embd, embd}, "ffwd.net.0.bias": {4 * embd},
+		"ffwd.net.2.weight": {embd, 4 * embd}, "ffwd.net.2.bias": {embd},
+		"ln1.weight": {embd}, "ln1.bias": {embd}, "ln2.weight": {embd}, "ln2.bias": {embd},
+	} {
+		tensors["blocks.0."+name] = tensor(shape...)
+	}
+
+	model, err := FromTensors(tensors)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return model
+}
+
+func TestInputs(t *testing.T) {
+	movies := []features.EncodedMovie{
+		{Id: 3, Duration: 0.5, Genres: []float32{0, 1}},
+		{Id: 4, Duration: 0.7, Genres: []float32{1, 0}},
+	}
+	activities := []features.EncodedActivity{{UserId: 1, MovieId: 3, Rating: 0.8}, {UserId: 1, MovieId: 4, RatingMissing: 1}}
+
+	activityFeatures, movieFeatures := len(activities[0].Vector()), len(movies[0].Vector())
+
+	// A model trained on the encoded activities maps their inputs to the space of the movies
+	model := newTestModel(t, activityFeatures+movieFeatures, movieFeatures)
+	model.ActivityColumns = features.ActivityColumns
+
+	inputs, err := model.Inputs(activities, movies)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(inputs) != 2 || len(inputs[0]) != model.Embd || inputs[0][0] != 0.8 {
+		t.Fatalf("unexpected inputs %v", inputs)
+	}
+
+	matrix := [][]float32{movies[0].Vector(), movies[1].Vector()}
+
+	predictions, err := model.Predict(inputs, matrix, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(predictions) != 1 {
+		t.Fatalf("expected a single prediction, got %v", predictions)
+	}
+
+	if _, err := model.Predict(inputs, matrix, 0); err == nil {
+		t.Fatal("expected an error for k lower than 1")
+	}
+
+	// The model of the notebook is trained on 6 activity features, it can't be fed the encoded activities
+	notebook := newTestModel(t, 6+movieFeatures, movieFeatures)
+
+	if notebook.ActivityFeatures != 6 {
+		t.Fatalf("expected 6 activity features, got %d", notebook.ActivityFeatures)
+	}
+
+	if _, err := notebook.Inputs(activities, movies); err == nil {
+		t.Fatal("expected an error for activities of another layout than the model")
+	}
+
+	model.ActivityColumns = slices.Clone(features.ActivityColumns)
+	model.ActivityColumns[0], model.ActivityColumns[1] = model.ActivityColumns[1], model.ActivityColumns[0]
+
+	if _, err := model.Inputs(activities, movies); err == nil {
+		t.Fatal("expected an error for activities of other columns than the model")
+	}
+
+	model.ActivityColumns = features.ActivityColumns
+	activities[0].MovieId = 5
+
+	if _, err := model.Inputs(activities, movies); err == nil {
+		t.Fatal("expected an error for a movie not encoded")
+	}
+}
@@ -3,7 +3,10 @@ package utils
 import (
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
+	"os"
+	"path"
 	"reflect"
 	"strings"
 
@@ -11,45 +14,76 @@ import (
 	"github.com/chromedp/cdproto/page"
 	"github.com/chromedp/chromedp"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// InsertOrUpdate is a wrapper for GORM that insert a row to a table if the row not exist and update that row otherwise.
-// It takes [*gorm.io/gorm.DB] and [*slog.Logger] as the db connection and the logger.
-// It takes tableName as the name of the SQL table.
-// v is the pointer to the struct that the data is parsed onto.
-// query and args are the parameters those are parsed directly to [*gorm.io/gorm.DB.Where()]
-func InsertOrUpdate(db *gorm.DB, logger *slog.Logger, table string, dest interface{}, query interface{}, args ...interface{}) error {
-	var exists bool
+// BatchSize is the number of rows written by a single INSERT, it is kept low enough for the SQLite limit on bound variables.
+const BatchSize = 500
 
-	v := reflect.ValueOf(dest)
+// UpsertByUrl is a wrapper for GORM that write rows those are identified by their url to a table with INSERT ... ON CONFLICT.
+// rows is a slice of structs with an Url field, the rows with the same url are only written once.
+// The given columns of the rows already in the table are updated, they are left as is if no column is given.
+// It returns the ids of every row, new or not, by url.
+func UpsertByUrl[T any](tx *gorm.DB, table string, rows []T, columns ...string) (map[string]int, error) {
+	ids := map[string]int{}
 
-	if v.Kind() != reflect.Ptr {
-		return fmt.Errorf("dest is not of type pointer but %s instead", v.Type().String())
+	if len(rows) == 0 {
+		return ids, nil
 	}
 
-	elem := v.Elem().Interface()
+	urls := []string{}
+	unique := []T{}
 
-	if err := db.Table(table).Select("count(*) > 0").Where(query, args...).Find(&exists).Error; err != nil {
-		return err
-	}
+	for _, row := range rows {
+		url := reflect.ValueOf(row).FieldByName("Url")
+		if !url.IsValid() || url.Kind() != reflect.String {
+			return nil, fmt.Errorf("rows of %s have no Url field", table)
+		}
 
-	if exists {
-		if err := db.Table(table).Where(query, args...).First(dest).Error; err != nil {
-			return err
+		if _, ok := ids[url.String()]; ok {
+			continue
 		}
 
-		logger.Warn(fmt.Sprintf("this row is already in %s", table), "row", elem)
+		ids[url.String()] = 0
+		urls = append(urls, url.String())
+		unique = append(unique, row)
+	}
 
-		return nil
+	onConflict := clause.OnConflict{Columns: []clause.Column{{Name: "url"}}, DoNothing: true}
+	if len(columns) > 0 {
+		onConflict = clause.OnConflict{Columns: []clause.Column{{Name: "url"}}, DoUpdates: clause.AssignmentColumns(columns)}
 	}
 
-	if err := db.Table(table).Where(query, args...).Create(dest).Error; err != nil {
-		return err
+	if err := tx.Table(table).Omit("id").Clauses(onConflict).CreateInBatches(&unique, BatchSize).Error; err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < len(urls); i += BatchSize {
+		var resolved []struct {
+			Id  int
+			Url string
+		}
+
+		if err := tx.Table(table).Select("id, url").Where("url IN ?", urls[i:min(i+BatchSize, len(urls))]).Find(&resolved).Error; err != nil {
+			return nil, err
+		}
+
+		for _, r := range resolved {
+			ids[r.Url] = r.Id
+		}
 	}
 
-	logger.Info(fmt.Sprintf("new row inserted into %s", table), "row", elem)
+	return ids, nil
+}
+
+// InsertBatch is a wrapper for GORM that insert rows to a table with INSERT ... ON CONFLICT DO NOTHING.
+// The rows those are already in the table, according to any of its unique constraints, are left as is.
+func InsertBatch[T any](tx *gorm.DB, table string, rows []T) error {
+	if len(rows) == 0 {
+		return nil
+	}
 
-	return nil
+	return tx.Table(table).Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&rows, BatchSize).Error
 }
 
 // NewTab create a new chromium window with additional listeners for logging.
@@ -115,3 +149,40 @@ func InjectLibToCdp(script string, logger *slog.Logger) chromedp.ActionFunc {
 		return nil
 	}
 }
+
+// WriteFileAtomic write the file at filePath with write, the previous file is replaced at once. The content is written
+// to a temporary file of the same dir those is renamed once complete, it is removed if write or the rename fails.
+func WriteFileAtomic(filePath string, write func(w io.Writer) error) (err error) {
+	tmp := path.Join(path.Dir(filePath), "."+path.Base(filePath)+".tmp")
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			os.Remove(tmp)
+		}
+	}()
+
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filePath)
+}
+
+// OrEmpty return values, or an empty slice if it is nil (e.g. to encode an empty JSON array or Parquet list).
+func OrEmpty[T any](values []T) []T {
+	if values == nil {
+		return []T{}
+	}
+
+	return values
+}
@@ -1,8 +1,16 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path"
 	"testing"
+
+	"github.com/leminhohoho/movie-lens/scraper/pkg/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
 )
 
 func TestMultiSplit(t *testing.T) {
@@ -15,3 +23,83 @@ func TestMultiSplit(t *testing.T) {
 		fmt.Printf("%#v\n", MultiSplit(c, ", ", " and "))
 	}
 }
+
+func TestUpsertByUrl(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(path.Join(t.TempDir(), "upsert.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Exec("CREATE TABLE genres (id INTEGER PRIMARY KEY, url TEXT NOT NULL UNIQUE, name TEXT NOT NULL)").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := UpsertByUrl(db, "genres", []models.Genre{
+		{Url: "/films/genre/drama/", Name: "Drama"},
+		{Url: "/films/genre/action/", Name: "Action"},
+		{Url: "/films/genre/drama/", Name: "Drama"},
+	}, "name")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := UpsertByUrl(db, "genres", []models.Genre{
+		{Url: "/films/genre/drama/", Name: "Drama (renamed)"},
+		{Url: "/films/genre/horror/", Name: "Horror"},
+	}, "name")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(first) != 2 || first["/films/genre/drama/"] == 0 || second["/films/genre/drama/"] != first["/films/genre/drama/"] {
+		t.Fatalf("expected an existing genre to keep its id, got %v then %v", first, second)
+	}
+
+	var genres []models.Genre
+
+	if err := db.Table("genres").Order("id").Find(&genres).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if len(genres) != 3 || genres[0].Name != "Drama (renamed)" {
+		t.Fatalf("unexpected genres %#v", genres)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	filePath := path.Join(dir, "model.gob")
+
+	write := func(content string) func(w io.Writer) error {
+		return func(w io.Writer) error {
+			_, err := io.WriteString(w, content)
+			return err
+		}
+	}
+
+	if err := WriteFileAtomic(filePath, write("first")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed write leaves the previous file and no temporary file behind
+	if err := WriteFileAtomic(filePath, func(w io.Writer) error {
+		io.WriteString(w, "partial")
+		return errors.New("encode failed")
+	}); err == nil {
+		t.Fatal("expected the error of the write")
+	}
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "first" || len(entries) != 1 {
+		t.Fatalf("expected only the first file, got %q and %d files", content, len(entries))
+	}
+}